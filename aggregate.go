@@ -0,0 +1,229 @@
+package model
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/go-qbit/qerror"
+	"github.com/go-qbit/timelog"
+)
+
+// Virtual fields of the relations, e.g. "message.@count"
+const (
+	AGGREGATE_COUNT  = "@count"  // Number of the linked rows, uint64
+	AGGREGATE_EXISTS = "@exists" // Whether there are linked rows, bool
+)
+
+func isAggregateField(fieldName string) bool {
+	return fieldName == AGGREGATE_COUNT || fieldName == AGGREGATE_EXISTS
+}
+
+// CountGroups returns the number of rows matched the filter for every group of the groupBy fields values.
+// The result contains the groupBy fields and the AGGREGATE_COUNT field.
+func (m *BaseModel) CountGroups(ctx context.Context, groupBy []string, filter IExpression) (*Data, error) {
+	logMessage := newFilterLogMessage(ctx, m.GetId()+": CountGroups")
+	ctx = timelog.Start(ctx, logMessage)
+	defer timelog.Finish(ctx)
+
+	for _, fieldName := range groupBy {
+		if field := m.GetFieldDefinition(fieldName); field == nil || field.IsDerivable() {
+			return nil, qerror.Errorf("Invalid field '%s' in model '%s' for grouping", fieldName, m.GetId())
+		}
+	}
+
+	filter, err := m.countFilter(ctx, logMessage, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if storage, ok := m.storage.(IAggregateStorage); ok {
+		return storage.CountGroups(ctx, m, groupBy, filter)
+	}
+
+	data, err := m.storage.Query(ctx, m, groupBy, GetAllOptions{Filter: filter})
+	if err != nil {
+		return nil, err
+	}
+
+	return countRows(groupBy, data.Data())
+}
+
+// Count returns the number of rows matched the filter
+func (m *BaseModel) Count(ctx context.Context, filter IExpression) (uint64, error) {
+	logMessage := newFilterLogMessage(ctx, m.GetId()+": Count")
+	ctx = timelog.Start(ctx, logMessage)
+	defer timelog.Finish(ctx)
+
+	filter, err := m.countFilter(ctx, logMessage, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	switch storage := m.storage.(type) {
+	case ICountStorage:
+		return storage.Count(ctx, m, filter)
+	case IAggregateStorage:
+		data, err := storage.CountGroups(ctx, m, nil, filter)
+		if err != nil || data.Len() == 0 {
+			return 0, err
+		}
+		return toUint64(data.GetFieldsData([]string{AGGREGATE_COUNT}).Data()[0][0])
+	}
+
+	data, err := m.storage.Query(ctx, m, nil, GetAllOptions{Filter: filter})
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(data.Len()), nil
+}
+
+// Exists checks if there is any row matched the filter, the rows are not read
+func (m *BaseModel) Exists(ctx context.Context, filter IExpression) (bool, error) {
+	logMessage := newFilterLogMessage(ctx, m.GetId()+": Exists")
+	ctx = timelog.Start(ctx, logMessage)
+	defer timelog.Finish(ctx)
+
+	filter, err := m.countFilter(ctx, logMessage, filter)
+	if err != nil {
+		return false, err
+	}
+
+	if storage, ok := m.storage.(ICountStorage); ok {
+		return storage.Exists(ctx, m, filter)
+	}
+
+	data, err := m.storage.Query(ctx, m, nil, GetAllOptions{Filter: filter, Limit: 1})
+	if err != nil {
+		return false, err
+	}
+
+	return data.Len() > 0, nil
+}
+
+// countFilter returns the filter with the default one like in GetAll
+func (m *BaseModel) countFilter(ctx context.Context, logMessage *filterLogMessage, filter IExpression) (IExpression, error) {
+	filter, err := m.withDefaultFilter(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validate(ctx, m, filter); err != nil {
+		return nil, err
+	}
+	logMessage.filter = filter
+
+	return filter, nil
+}
+
+// countRows groups the rows by all the values, the rows order is kept
+func countRows(fieldsNames []string, rows [][]interface{}) (*Data, error) {
+	var groups [][]interface{}
+	counts := make(map[string]int)
+	for _, row := range rows {
+		key := linkKey(row)
+		if n, exists := counts[key]; exists {
+			groups[n][len(row)] = groups[n][len(row)].(uint64) + 1
+			continue
+		}
+
+		counts[key] = len(groups)
+		groups = append(groups, append(append(make([]interface{}, 0, len(row)+1), row...), uint64(1)))
+	}
+
+	res := NewEmptyData(append(append([]string{}, fieldsNames...), AGGREGATE_COUNT))
+	for _, group := range groups {
+		if err := res.Add(group); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// relationCounts returns the number of the rows linked by the relation with every local row by the key of the local fields values
+func (m *BaseModel) relationCounts(ctx context.Context, relation *Relation, filter IExpression, values []map[string]interface{}) (map[string]uint64, error) {
+	keys := make([][]interface{}, len(values))
+	for i, row := range values {
+		keys[i] = rowValues(row, relation.LocalFieldsNames)
+	}
+	keys = distinctKeys(keys)
+
+	res := make(map[string]uint64, len(keys))
+	if len(keys) == 0 {
+		return res, nil
+	}
+
+	countModel, groupBy := relation.ExtModel, relation.FkFieldsNames
+	if relation.JunctionModel != nil {
+		countModel, groupBy = relation.JunctionModel, relation.JunctionLocalFieldsNames
+
+		// The links are counted only if the external rows are not hidden by the default filter and soft delete
+		extRelation := junctionExtRelation(relation)
+		if extRelation == nil {
+			return nil, qerror.Errorf("There is no relation between junction model '%s' and model '%s'",
+				relation.JunctionModel.GetId(), relation.ExtModel.GetId())
+		}
+
+		defFilter, err := relation.ExtModel.GetDefaultFilter(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if defFilter != nil {
+			filter = andFilter(defFilter, filter)
+		}
+
+		filter = &exprAnyS{relation.JunctionModel, extRelation.Alias, filter}
+	}
+
+	groups, err := countModel.CountGroups(ctx, groupBy, andFilter(keysFilter(countModel, groupBy, keys), filter))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range groups.GetFieldsData(append(append([]string{}, groupBy...), AGGREGATE_COUNT)).Data() {
+		count, err := toUint64(row[len(groupBy)])
+		if err != nil {
+			return nil, err
+		}
+		res[linkKey(row[:len(groupBy)])] += count
+	}
+
+	return res, nil
+}
+
+func rowValues(row map[string]interface{}, fieldsNames []string) []interface{} {
+	res := make([]interface{}, len(fieldsNames))
+	for i, fieldName := range fieldsNames {
+		res[i] = row[fieldName]
+	}
+
+	return res
+}
+
+// junctionExtRelation returns the relation of the junction model to the external model of the many-to-many relation
+func junctionExtRelation(relation *Relation) *Relation {
+	for _, junctionRelation := range relation.JunctionModel.GetRelations() {
+		if fieldsNamesEqual(junctionRelation.LocalFieldsNames, relation.JunctionFkFieldsNames) {
+			return &junctionRelation
+		}
+	}
+
+	return nil
+}
+
+func toUint64(value interface{}) (uint64, error) {
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint(), nil
+	default:
+		return 0, qerror.Errorf("Invalid type %T of the rows count", value)
+	}
+}
@@ -30,14 +30,95 @@ func (e *exprInS) GetProcessor(processor IExpressionProcessor) interface{} {
 	return processor.In(e.op, e.values)
 }
 
+// Eq
+type exprEqS struct {
+	op1, op2 IExpression
+}
+
+func exprEq(op1, op2 IExpression) *exprEqS { return &exprEqS{op1, op2} }
+func (e *exprEqS) GetProcessor(processor IExpressionProcessor) interface{} {
+	return processor.Eq(e.op1, e.op2)
+}
+
+// Ne
+type exprNeS struct {
+	op1, op2 IExpression
+}
+
+func exprNe(op1, op2 IExpression) *exprNeS { return &exprNeS{op1, op2} }
+func (e *exprNeS) GetProcessor(processor IExpressionProcessor) interface{} {
+	return processor.Ne(e.op1, e.op2)
+}
+
+// Lt
+type exprLtS struct {
+	op1, op2 IExpression
+}
+
+func exprLt(op1, op2 IExpression) *exprLtS { return &exprLtS{op1, op2} }
+func (e *exprLtS) GetProcessor(processor IExpressionProcessor) interface{} {
+	return processor.Lt(e.op1, e.op2)
+}
+
+// Le
+type exprLeS struct {
+	op1, op2 IExpression
+}
+
+func exprLe(op1, op2 IExpression) *exprLeS { return &exprLeS{op1, op2} }
+func (e *exprLeS) GetProcessor(processor IExpressionProcessor) interface{} {
+	return processor.Le(e.op1, e.op2)
+}
+
+// Gt
+type exprGtS struct {
+	op1, op2 IExpression
+}
+
+func exprGt(op1, op2 IExpression) *exprGtS { return &exprGtS{op1, op2} }
+func (e *exprGtS) GetProcessor(processor IExpressionProcessor) interface{} {
+	return processor.Gt(e.op1, e.op2)
+}
+
+// Ge
+type exprGeS struct {
+	op1, op2 IExpression
+}
+
+func exprGe(op1, op2 IExpression) *exprGeS { return &exprGeS{op1, op2} }
+func (e *exprGeS) GetProcessor(processor IExpressionProcessor) interface{} {
+	return processor.Ge(e.op1, e.op2)
+}
+
 // And
 type exprAndS struct {
-	op1, op2 IExpression
+	ops []IExpression
 }
 
-func exprAnd(op1, op2 IExpression) *exprAndS { return &exprAndS{op1, op2} }
+func exprAnd(ops ...IExpression) *exprAndS { return &exprAndS{ops} }
 func (e *exprAndS) GetProcessor(processor IExpressionProcessor) interface{} {
-	return processor.And([]IExpression{e.op1, e.op2})
+	return processor.And(e.ops)
+}
+
+// Or
+type exprOrS struct {
+	ops []IExpression
+}
+
+func exprOr(ops ...IExpression) *exprOrS { return &exprOrS{ops} }
+func (e *exprOrS) GetProcessor(processor IExpressionProcessor) interface{} {
+	return processor.Or(e.ops)
+}
+
+// Any
+type exprAnyS struct {
+	localModel   IModel
+	relationName string
+	filter       IExpression
+}
+
+func (e *exprAnyS) GetProcessor(processor IExpressionProcessor) interface{} {
+	return processor.Any(e.localModel, e.relationName, e.filter)
 }
 
 // Model field
@@ -60,17 +141,13 @@ func (e *exprValueS) GetProcessor(processor IExpressionProcessor) interface{} {
 	return processor.Value(e.data)
 }
 
-type ModelLink struct {
-	Pk  []interface{}
-	Fks [][]interface{}
-}
-
 type BaseModel struct {
 	id                        string
 	fields                    []IFieldDefinition
 	fieldsMtx                 sync.RWMutex
 	nameToField               map[string]IFieldDefinition
 	pkFieldsNames             []string
+	uniqueKeys                [][]string
 	extModels                 map[string]Relation
 	extModelsMtx              sync.RWMutex
 	sharedData                map[string]interface{}
@@ -80,16 +157,23 @@ type BaseModel struct {
 	deletePermission          *rbac.Permission
 	defaultFilter             DefaultFilterFunc
 	prepareDerivableFieldsCtx PrepareDerivableFieldsCtxFunc
+	prefetchConcurrency       int
+	softDelete                bool
+	versioned                 bool
 }
 
 type BaseModelOpts struct {
 	PkFieldsNames             []string
+	UniqueKeys                [][]string // Sets of fields with unique values, the rows with NULL in any of the fields are not checked, see IUniqueStorage and GetSchema
 	SharedData                map[string]interface{}
 	AddPermission             *rbac.Permission
 	EditPermission            *rbac.Permission
 	DeletePermission          *rbac.Permission
 	DefaultFilter             DefaultFilterFunc
 	PrepareDerivableFieldsCtx PrepareDerivableFieldsCtxFunc
+	PrefetchConcurrency       int  // Max number of relations fetched concurrently by GetAll, 4 by default, 1 disables the concurrency
+	SoftDelete                bool // Delete sets the time to the SOFT_DELETE_FIELD field instead of deleting the rows, see WithDeleted
+	Versioned                 bool // Adds VERSION_FIELD field for the optimistic concurrency control, see EditWithVersion
 }
 
 type DefaultFilterFunc func(ctx context.Context, m IModel) (IExpression, error)
@@ -103,22 +187,52 @@ func NewBaseModel(id string, fields []IFieldDefinition, storage IStorage, opts B
 		extModels:                 make(map[string]Relation),
 		storage:                   storage,
 		pkFieldsNames:             opts.PkFieldsNames,
+		uniqueKeys:                opts.UniqueKeys,
 		sharedData:                opts.SharedData,
 		addPermission:             opts.AddPermission,
 		editPermission:            opts.EditPermission,
 		deletePermission:          opts.DeletePermission,
 		defaultFilter:             opts.DefaultFilter,
 		prepareDerivableFieldsCtx: opts.PrepareDerivableFieldsCtx,
+		prefetchConcurrency:       opts.PrefetchConcurrency,
+		softDelete:                opts.SoftDelete,
+		versioned:                 opts.Versioned,
+	}
+
+	m.fields = fields[:len(fields):len(fields)]
+	if opts.SoftDelete {
+		m.fields = append(m.fields, &TimeField{
+			Id:      SOFT_DELETE_FIELD,
+			Caption: "Deleted at",
+		})
+	}
+	if opts.Versioned {
+		m.fields = append(m.fields, &IntField{
+			Id:      VERSION_FIELD,
+			Caption: "Version",
+		})
+	}
+
+	if m.prefetchConcurrency <= 0 {
+		m.prefetchConcurrency = defaultPrefetchConcurrency
 	}
 
 	if err := storage.RegisterModel(m); err != nil {
 		panic(err)
 	}
 
-	for _, field := range fields {
+	for _, field := range m.fields {
 		m.nameToField[field.GetId()] = field
 	}
 
+	for _, key := range m.uniqueKeys {
+		for _, fieldName := range key {
+			if field := m.nameToField[fieldName]; field == nil || field.IsDerivable() {
+				panic(fmt.Sprintf("Invalid field '%s' of unique key in model '%s'", fieldName, m.id))
+			}
+		}
+	}
+
 	return m
 }
 
@@ -159,11 +273,7 @@ func (m *BaseModel) GetSharedData(key string) interface{} {
 }
 
 func (m *BaseModel) GetDefaultFilter(ctx context.Context) (IExpression, error) {
-	if m.defaultFilter == nil {
-		return nil, nil
-	}
-
-	return m.defaultFilter(ctx, m)
+	return m.withDefaultFilter(ctx, nil)
 }
 
 func (m *BaseModel) AddField(field IFieldDefinition) {
@@ -211,35 +321,45 @@ func (m *BaseModel) AddRelation(relation Relation, alias string, newFields []IFi
 	m.extModelsMtx.Lock()
 	defer m.extModelsMtx.Unlock()
 
-	if alias != "" {
-		m.extModels[alias] = relation
+	if alias == "" {
+		if relation.ExtModel.GetId() == m.id {
+			panic(fmt.Sprintf("Self-relation of model '%s' must have an alias", m.id))
+		}
+		alias = relation.ExtModel.GetId()
+	}
+
+	if _, exists := m.extModels[alias]; exists {
+		panic(fmt.Sprintf("Relation '%s' already exists in model '%s'", alias, m.id))
 	}
-	m.extModels[relation.ExtModel.GetId()] = relation // Ugly fix for any filter with alias relation
+
+	relation.Alias = alias
+	m.extModels[alias] = relation
 
 	if relation.PkFieldsNames != nil {
 		m.pkFieldsNames = relation.PkFieldsNames
 	}
 }
 
-func (m *BaseModel) GetRelations() []string {
+// GetRelations returns all the relations of the model sorted by the alias
+func (m *BaseModel) GetRelations() []Relation {
 	m.extModelsMtx.RLock()
 	defer m.extModelsMtx.RUnlock()
 
-	res := make([]string, 0, len(m.extModels))
-	for name := range m.extModels {
-		res = append(res, name)
+	res := make([]Relation, 0, len(m.extModels))
+	for _, relation := range m.extModels {
+		res = append(res, relation)
 	}
 
-	sort.Strings(res)
+	sort.Slice(res, func(i, j int) bool { return res[i].Alias < res[j].Alias })
 
 	return res
 }
 
-func (m *BaseModel) GetRelation(modelName string) *Relation {
+func (m *BaseModel) GetRelation(name string) *Relation {
 	m.extModelsMtx.RLock()
 	defer m.extModelsMtx.RUnlock()
 
-	relation, exists := m.extModels[modelName]
+	relation, exists := m.extModels[name]
 	if exists {
 		return &relation
 	} else {
@@ -255,10 +375,23 @@ func (m *BaseModel) AddMulti(ctx context.Context, data *Data, opts AddOptions) (
 		return nil, AddErrorf("You don't have permission")
 	}
 
+	if opts.OnConflict != nil {
+		if err := m.checkOnConflict(ctx, opts); err != nil {
+			return nil, err
+		}
+	}
+
 	if data.Len() == 0 {
 		return NewEmptyData(m.GetPKFieldsNames()), nil
 	}
 
+	if m.versioned {
+		if data.FieldNum(VERSION_FIELD) != -1 {
+			return nil, m.versionFieldError()
+		}
+		data = withInitialVersion(data)
+	}
+
 	fieldsMap := make(map[string]struct{})
 	fields := make([]IFieldDefinition, len(data.Fields()))
 	for i, fieldName := range data.Fields() {
@@ -304,74 +437,75 @@ func (m *BaseModel) AddMulti(ctx context.Context, data *Data, opts AddOptions) (
 		}
 	}
 
-	return m.storage.Add(ctx, m, data, opts)
-}
-
-func (m *BaseModel) Link(ctx context.Context, extModel IModel, links []ModelLink) error {
-	ctx = timelog.Start(ctx, m.GetId()+": Link to "+extModel.GetId())
-	defer timelog.Finish(ctx)
-
-	relation := m.GetRelation(extModel.GetId())
-	if relation == nil {
-		return qerror.Errorf("No relation found between %s and %s", m.GetId(), extModel.GetId())
+	references := m.requiredReferences(data.Fields())
+	checkUniqueKeys := m.checksUniqueKeys()
+	if len(references) == 0 && !checkUniqueKeys {
+		return m.storage.Add(ctx, m, data, opts)
 	}
 
-	switch relation.RelationType {
-	case RELATION_MANY_TO_MANY:
-		data := NewEmptyData(append(relation.JunctionLocalFieldsNames, relation.JunctionFkFieldsNames...))
-		for _, link := range links {
-			for _, fk := range link.Fks {
-				if err := data.Add(append(link.Pk, fk...)); err != nil {
-					return err
-				}
+	var res *Data
+	err := m.inTransaction(ctx, func(ctx context.Context) error {
+		if err := m.checkReferences(ctx, references, data); err != nil {
+			return err
+		}
+
+		if checkUniqueKeys {
+			if err := m.checkAddUniqueKeys(ctx, data, opts); err != nil {
+				return err
 			}
 		}
 
-		_, err := relation.JunctionModel.AddMulti(ctx, data, AddOptions{Replace: true})
+		var err error
+		res, err = m.storage.Add(ctx, m, data, opts)
 
 		return err
+	})
 
-	default:
-		panic("Not implemented") //ToDo
-	}
-
-	return nil
+	return res, err
 }
 
+// AddFromStructs adds the slice of structures. The fields mapped to relations are added too:
+// the referenced rows are added before, the referencing ones and the many-to-many links after.
+// The generated primary keys are set to the structures, the options are applied to the rows of the model only.
+// The fields changed by the model, VERSION_FIELD and SOFT_DELETE_FIELD, are not added.
 func (m *BaseModel) AddFromStructs(ctx context.Context, data interface{}, opts AddOptions) (*Data, error) {
 	rt := reflect.TypeOf(data)
 
-	if rt.Kind() != reflect.Slice || rt.Elem().Kind() != reflect.Struct {
-		return nil, qerror.Errorf("Invalid type '%s', must to slice of struct", rt.String())
-	}
-
-	fieldsNames := make([]string, 0, rt.Elem().NumField())
-	fieldsNums := make([]int, 0, rt.Elem().NumField())
-	for i := 0; i < rt.Elem().NumField(); i++ {
-		if fieldName := m.structFieldToFieldName(rt.Elem().Field(i)); fieldName != "-" {
-			fieldsNames = append(fieldsNames, fieldName)
-			fieldsNums = append(fieldsNums, i)
-		}
+	if rt == nil || rt.Kind() != reflect.Slice || indirectType(rt.Elem()).Kind() != reflect.Struct {
+		return nil, qerror.Errorf("Invalid type '%v', must to slice of struct", rt)
 	}
 
 	rData := reflect.ValueOf(data)
-	flatData := NewEmptyData(fieldsNames)
-
+	rows := make([]reflect.Value, 0, rData.Len())
 	for i := 0; i < rData.Len(); i++ {
-		flatRow := make([]interface{}, len(fieldsNames))
-		for j := 0; j < len(fieldsNames); j++ {
-			flatRow[j] = rData.Index(i).Field(fieldsNums[j]).Interface()
+		row, ok := nestedStruct(rData.Index(i))
+		if !ok && rData.Index(i).Kind() == reflect.Ptr {
+			return nil, qerror.Errorf("Nil element %d in the slice", i)
 		}
-		if err := flatData.Add(flatRow); err != nil {
-			return nil, err
+		if !ok {
+			row = rData.Index(i)
 		}
+		rows = append(rows, row)
 	}
 
-	return m.AddMulti(ctx, flatData, opts)
+	if _, nestedFields := m.structFields(indirectType(rt.Elem()), nil); len(nestedFields) == 0 {
+		return m.addStructs(ctx, rows, nil, opts)
+	}
+
+	var res *Data
+	err := m.inTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = m.addStructs(ctx, rows, nil, opts)
+
+		return err
+	})
+
+	return res, err
 }
 
 func (m *BaseModel) GetAll(ctx context.Context, fieldsNames []string, opts GetAllOptions) (*Data, error) {
-	ctx = timelog.Start(ctx, m.GetId()+": GetAll")
+	logMessage := newFilterLogMessage(ctx, m.GetId()+": GetAll")
+	ctx = timelog.Start(ctx, logMessage)
 	defer timelog.Finish(ctx)
 
 	requestedLocalFields := make(map[string]struct{})
@@ -380,6 +514,8 @@ func (m *BaseModel) GetAll(ctx context.Context, fieldsNames []string, opts GetAl
 	needLocalFields := make(map[string]struct{})
 	needDerivableFieldsNames := make(map[string]struct{})
 	extFields := make(map[string][]string)
+	recursionDepth := make(map[string]int)
+	aggregates := make(map[string]map[string]struct{})
 
 	for _, fieldName := range fieldsNames {
 		splittedFieldName := strings.SplitN(fieldName, ".", 2)
@@ -410,11 +546,50 @@ func (m *BaseModel) GetAll(ctx context.Context, fieldsNames []string, opts GetAl
 			needLocalFields[fieldName] = struct{}{}
 		} else {
 			// External fields
-			extFields[splittedFieldName[0]] = append(extFields[splittedFieldName[0]], splittedFieldName[1])
-			if _, exists := requestedExtFields[splittedFieldName[0]]; !exists {
-				requestedExtFields[splittedFieldName[0]] = make(map[string]struct{})
+			relationName, depth, err := parseRelationName(splittedFieldName[0])
+			if err != nil {
+				return nil, err
+			}
+
+			// Virtual fields of the relation
+			if isAggregateField(splittedFieldName[1]) {
+				if depth != 0 {
+					return nil, qerror.Errorf("The field '%s' cannot be fetched recursively", fieldName)
+				}
+				if _, exists := aggregates[relationName]; !exists {
+					aggregates[relationName] = make(map[string]struct{})
+				}
+				aggregates[relationName][splittedFieldName[1]] = struct{}{}
+				continue
+			}
+
+			if depth != 0 {
+				recursionDepth[relationName] = depth
 			}
-			requestedExtFields[splittedFieldName[0]][strings.SplitN(splittedFieldName[1], ".", 2)[0]] = struct{}{}
+
+			extFields[relationName] = append(extFields[relationName], splittedFieldName[1])
+			if _, exists := requestedExtFields[relationName]; !exists {
+				requestedExtFields[relationName] = make(map[string]struct{})
+			}
+			extFieldName := strings.SplitN(splittedFieldName[1], ".", 2)[0]
+			requestedExtFields[relationName][strings.SplitN(extFieldName, "*", 2)[0]] = struct{}{}
+		}
+	}
+
+	for relationName := range opts.RelationsOptions {
+		if _, exists := m.extModels[relationName]; !exists {
+			return nil, qerror.Errorf("There is no relation '%s' in model '%s' for the relation options", relationName, m.GetId())
+		}
+	}
+
+	for relationName := range aggregates {
+		relation, exists := m.extModels[relationName]
+		if !exists {
+			return nil, qerror.Errorf("There is no relation between '%s' and '%s'", m.GetId(), relationName)
+		}
+
+		for _, fieldName := range relation.LocalFieldsNames {
+			needLocalFields[fieldName] = struct{}{}
 		}
 	}
 
@@ -424,6 +599,29 @@ func (m *BaseModel) GetAll(ctx context.Context, fieldsNames []string, opts GetAl
 			return nil, qerror.Errorf("There is no relation between '%s' and '%s'", m.GetId(), extModelName)
 		}
 
+		if relation.JunctionModel == nil {
+			for _, extFieldName := range extFields[extModelName] {
+				if strings.HasPrefix(extFieldName, "@") {
+					return nil, qerror.Errorf("Junction field '%s' is requested for relation '%s' without junction model", extFieldName, extModelName)
+				}
+			}
+		}
+
+		if depth, exists := recursionDepth[extModelName]; exists {
+			if relation.ExtModel.GetId() != m.GetId() {
+				return nil, qerror.Errorf("Relation '%s' of model '%s' is not a self-relation, it cannot be fetched recursively", extModelName, m.GetId())
+			}
+
+			if depth != 1 {
+				requestedExtFields[extModelName][extModelName] = struct{}{}
+			}
+			extFields[extModelName] = append(extFields[extModelName], recursiveFieldsNames(extModelName, depth, extFields[extModelName])...)
+
+			for _, pkFieldName := range m.GetPKFieldsNames() {
+				needLocalFields[pkFieldName] = struct{}{}
+			}
+		}
+
 		for _, pkFieldName := range relation.LocalFieldsNames {
 			needLocalFields[pkFieldName] = struct{}{}
 		}
@@ -444,19 +642,29 @@ func (m *BaseModel) GetAll(ctx context.Context, fieldsNames []string, opts GetAl
 		return nil, err
 	}
 
+	if err := validate(ctx, m, resFilter); err != nil {
+		return nil, err
+	}
+	logMessage.filter = resFilter
+
 	opts.Filter = resFilter
-	valuesData, err := m.storage.Query(ctx, m, needLocalFieldsNamesArr, opts)
+	valuesData, err := m.query(ctx, needLocalFieldsNamesArr, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	resFields := make([]string, 0, len(requestedLocalFields)+len(requestedExtFields))
+	resFields := make([]string, 0, len(requestedLocalFields)+len(requestedExtFields)+len(aggregates))
 	for fieldName := range requestedLocalFields {
 		resFields = append(resFields, fieldName)
 	}
 	for fieldName := range requestedExtFields {
 		resFields = append(resFields, fieldName)
 	}
+	for relationName, relationAggregates := range aggregates {
+		for aggregate := range relationAggregates {
+			resFields = append(resFields, relationName+"."+aggregate)
+		}
+	}
 
 	if valuesData.Len() == 0 {
 		return NewEmptyData(resFields), nil
@@ -464,83 +672,57 @@ func (m *BaseModel) GetAll(ctx context.Context, fieldsNames []string, opts GetAl
 
 	values := valuesData.Maps()
 
-	extData := make(map[string]map[string][]map[string]interface{})
-	localPk := m.GetPKFieldsNames()
-	for extModelName, extFields := range extFields {
-		relation := m.extModels[extModelName]
-		extModel := relation.ExtModel
-
-		if len(localPk) != 1 { //ToDo: implement PKs with 2 and more keys
-			panic("Not implemented")
-		}
-
-		extValuesMap := make(map[string][]map[string]interface{})
+	// Fetch the external rows and the virtual fields of the relations concurrently
+	extModelsNames := make([]string, 0, len(extFields))
+	for extModelName := range extFields {
+		extModelsNames = append(extModelsNames, extModelName)
+	}
+	sort.Strings(extModelsNames)
 
-		if relation.JunctionModel != nil {
-			filter := exprIn(relation.JunctionModel.FieldExpr(relation.JunctionLocalFieldsNames[0]))
-			for _, row := range values {
-				filter.Add(exprValue(row[relation.LocalFieldsNames[0]]))
-			}
+	if len(extModelsNames) > 0 && len(m.GetPKFieldsNames()) != 1 { //ToDo: implement PKs with 2 and more keys
+		panic("Not implemented")
+	}
 
-			junctionFields := append(relation.JunctionLocalFieldsNames, relation.JunctionFkFieldsNames...)
-			junctionValues, err := relation.JunctionModel.GetAll(ctx, junctionFields, GetAllOptions{Filter: filter})
-			if err != nil {
-				return nil, err
-			}
+	aggregatesNames := make([]string, 0, len(aggregates))
+	for relationName := range aggregates {
+		aggregatesNames = append(aggregatesNames, relationName)
+	}
+	sort.Strings(aggregatesNames)
 
-			if junctionValues.Len() > 0 {
-				junctionModel := relation.JunctionModel
-				junctionValuesMap := make(map[string][]string)
-				uniq := make(map[interface{}]struct{})
-				for _, value := range junctionValues.Maps() {
-					key := junctionModel.FieldsToString(relation.JunctionFkFieldsNames, value)
-					junctionValuesMap[key] = append(junctionValuesMap[key], junctionModel.FieldsToString(relation.JunctionLocalFieldsNames, value))
-					uniq[value[relation.JunctionFkFieldsNames[0]]] = struct{}{}
-				}
+	extDataArr := make([]map[string][]map[string]interface{}, len(extModelsNames))
+	countsArr := make([]map[string]uint64, len(aggregatesNames))
 
-				filter = exprIn(extModel.FieldExpr(relation.FkFieldsNames[0]))
-				for v := range uniq {
-					filter.Add(exprValue(v))
-				}
+	jobs := make([]prefetchJob, 0, len(extModelsNames)+len(aggregatesNames))
+	for i, extModelName := range extModelsNames {
+		i, extModelName := i, extModelName
+		_, recursive := recursionDepth[extModelName]
 
-				orderBy := make([]Order, len(relation.FkFieldsNames))
-				for i := range relation.FkFieldsNames {
-					orderBy[i].FieldName = relation.FkFieldsNames[i]
-				}
-				extValues, err := extModel.GetAll(ctx, extFields, GetAllOptions{Filter: filter, OrderBy: orderBy})
-				if err != nil {
-					return nil, err
-				}
+		jobs = append(jobs, prefetchJob{m.GetId() + ": fetch " + extModelName, func(ctx context.Context) error {
+			var err error
+			extDataArr[i], err = m.fetchRelation(ctx, extModelName, extFields[extModelName], recursive, values, opts)
 
-				for _, extRow := range extValues.Maps() {
-					for _, fk := range junctionValuesMap[extModel.FieldsToString(relation.FkFieldsNames, extRow)] {
-						extValuesMap[fk] = append(extValuesMap[fk], extRow)
-					}
-				}
-			}
-		} else {
-			uniq := make(map[interface{}]struct{})
-			for _, row := range values {
-				uniq[row[relation.LocalFieldsNames[0]]] = struct{}{}
-			}
+			return err
+		}})
+	}
+	for i, relationName := range aggregatesNames {
+		i, relation := i, m.extModels[relationName]
+		filter := opts.RelationsOptions[relationName].Filter
 
-			filter := exprIn(extModel.FieldExpr(relation.FkFieldsNames[0]))
-			for v := range uniq {
-				filter.Add(exprValue(v))
-			}
+		jobs = append(jobs, prefetchJob{m.GetId() + ": count " + relationName, func(ctx context.Context) error {
+			var err error
+			countsArr[i], err = m.relationCounts(ctx, &relation, filter, values)
 
-			extValues, err := extModel.GetAll(ctx, extFields, GetAllOptions{Filter: filter})
-			if err != nil {
-				return nil, err
-			}
+			return err
+		}})
+	}
 
-			for _, extRow := range extValues.Maps() {
-				stringFk := extModel.FieldsToString(relation.FkFieldsNames, extRow)
-				extValuesMap[stringFk] = append(extValuesMap[stringFk], extRow)
-			}
-		}
+	if err := m.prefetch(ctx, jobs); err != nil {
+		return nil, err
+	}
 
-		extData[extModelName] = extValuesMap
+	extData := make(map[string]map[string][]map[string]interface{}, len(extModelsNames))
+	for i, extModelName := range extModelsNames {
+		extData[extModelName] = extDataArr[i]
 	}
 
 	// Fill external fields
@@ -571,6 +753,23 @@ func (m *BaseModel) GetAll(ctx context.Context, fieldsNames []string, opts GetAl
 		}
 	}
 
+	// Fill virtual fields of the relations, one grouped query per relation
+	for i, relationName := range aggregatesNames {
+		relation, relationAggregates, counts := m.extModels[relationName], aggregates[relationName], countsArr[i]
+
+		for _, value := range values {
+			count := counts[linkKey(rowValues(value, relation.LocalFieldsNames))]
+			for aggregate := range relationAggregates {
+				switch aggregate {
+				case AGGREGATE_COUNT:
+					value[relationName+"."+aggregate] = count
+				case AGGREGATE_EXISTS:
+					value[relationName+"."+aggregate] = count > 0
+				}
+			}
+		}
+	}
+
 	// Fill derivable fields
 	if len(needDerivableFieldsNames) > 0 {
 		if m.prepareDerivableFieldsCtx != nil {
@@ -596,8 +795,12 @@ func (m *BaseModel) GetAll(ctx context.Context, fieldsNames []string, opts GetAl
 		for key := range value {
 			_, isLocalField := requestedLocalFields[key]
 			_, isExtField := extFields[key]
+			isAggregateField := false
+			if splittedKey := strings.SplitN(key, ".", 2); len(splittedKey) == 2 {
+				_, isAggregateField = aggregates[splittedKey[0]][splittedKey[1]]
+			}
 
-			if !(isLocalField || isExtField) {
+			if !(isLocalField || isExtField || isAggregateField) {
 				delete(value, key)
 			}
 		}
@@ -619,6 +822,190 @@ func (m *BaseModel) GetAll(ctx context.Context, fieldsNames []string, opts GetAl
 	return res, nil
 }
 
+// fetchRelation returns the external rows linked with the values by the key of the local fields values
+func (m *BaseModel) fetchRelation(ctx context.Context, extModelName string, extFields []string, recursive bool, values []map[string]interface{}, opts GetAllOptions) (map[string][]map[string]interface{}, error) {
+	relation := m.extModels[extModelName]
+	extModel := relation.ExtModel
+
+	extValuesMap := make(map[string][]map[string]interface{})
+
+	relationOpts := opts.RelationsOptions[extModelName]
+	extRelationsOptions := relationOpts.RelationsOptions
+
+	sourceValues, extCtx := values, ctx
+	if recursive {
+		sourceValues, extCtx = m.recursionSources(ctx, extModelName, relation, values)
+
+		// The options are applied on every recursion level
+		if _, exists := opts.RelationsOptions[extModelName]; exists {
+			extRelationsOptions = make(map[string]GetAllOptions, len(relationOpts.RelationsOptions)+1)
+			for name, relationsOpts := range relationOpts.RelationsOptions {
+				extRelationsOptions[name] = relationsOpts
+			}
+			extRelationsOptions[extModelName] = relationOpts
+		}
+	}
+
+	if relation.JunctionModel != nil {
+		// Fields of the junction model are requested with '@' prefix
+		var junctionExtraFields, modelFields []string
+		for _, fieldName := range extFields {
+			if strings.HasPrefix(fieldName, "@") {
+				junctionExtraFields = append(junctionExtraFields, fieldName[1:])
+			} else {
+				modelFields = append(modelFields, fieldName)
+			}
+		}
+
+		filter := exprIn(relation.JunctionModel.FieldExpr(relation.JunctionLocalFieldsNames[0]))
+		for _, row := range sourceValues {
+			filter.Add(exprValue(row[relation.LocalFieldsNames[0]]))
+		}
+
+		junctionFields := append(append([]string{}, relation.JunctionLocalFieldsNames...), relation.JunctionFkFieldsNames...)
+		junctionFields = append(junctionFields, junctionExtraFields...)
+		junctionValues, err := relation.JunctionModel.GetAll(extCtx, junctionFields, GetAllOptions{Filter: filter})
+		if err != nil {
+			return nil, err
+		}
+
+		if junctionValues.Len() > 0 {
+			junctionModel := relation.JunctionModel
+			junctionValuesMap := make(map[string][]map[string]interface{})
+			uniq := make(map[interface{}]struct{})
+			for _, value := range junctionValues.Maps() {
+				key := junctionModel.FieldsToString(relation.JunctionFkFieldsNames, value)
+				junctionValuesMap[key] = append(junctionValuesMap[key], value)
+				uniq[value[relation.JunctionFkFieldsNames[0]]] = struct{}{}
+			}
+
+			filter = exprIn(extModel.FieldExpr(relation.FkFieldsNames[0]))
+			for v := range uniq {
+				filter.Add(exprValue(v))
+			}
+
+			orderBy := relationOpts.OrderBy
+			if orderBy == nil {
+				orderBy = make([]Order, len(relation.FkFieldsNames))
+				for i := range relation.FkFieldsNames {
+					orderBy[i].FieldName = relation.FkFieldsNames[i]
+				}
+			}
+			extValues, err := extModel.GetAll(extCtx, modelFields, GetAllOptions{
+				Distinct:         relationOpts.Distinct,
+				Filter:           andFilter(filter, relationOpts.Filter),
+				OrderBy:          orderBy,
+				RelationsOptions: extRelationsOptions,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			// Every local row gets the distinct rows, the same external row can be linked several times
+			var distinct map[string]struct{}
+			if relationOpts.Distinct {
+				distinct = make(map[string]struct{})
+			}
+
+			for _, extRow := range extValues.Maps() {
+				for _, junctionRow := range junctionValuesMap[extModel.FieldsToString(relation.FkFieldsNames, extRow)] {
+					fk := junctionModel.FieldsToString(relation.JunctionLocalFieldsNames, junctionRow)
+
+					// Every link has its own junction values, so the external row is copied
+					row := extRow
+					if len(junctionExtraFields) > 0 {
+						row = make(map[string]interface{}, len(extRow)+len(junctionExtraFields))
+						for k, v := range extRow {
+							row[k] = v
+						}
+						for _, fieldName := range junctionExtraFields {
+							if v, exists := junctionRow[fieldName]; exists {
+								row["@"+fieldName] = v
+							}
+						}
+					}
+
+					if distinct != nil {
+						key := fk + "\x00" + extModel.FieldsToString(extFields, row)
+						if _, exists := distinct[key]; exists {
+							continue
+						}
+						distinct[key] = struct{}{}
+					}
+
+					extValuesMap[fk] = append(extValuesMap[fk], row)
+				}
+			}
+
+			// The links are in the junction model, so Limit and Offset cannot be applied to the query of the external model
+			if relationOpts.Limit > 0 || relationOpts.Offset > 0 {
+				for fk, rows := range extValuesMap {
+					if rows = limitRows(rows, relationOpts.Offset, relationOpts.Limit); len(rows) > 0 {
+						extValuesMap[fk] = rows
+					} else {
+						delete(extValuesMap, fk)
+					}
+				}
+			}
+		}
+	} else {
+		uniq := make(map[interface{}]struct{})
+		for _, row := range sourceValues {
+			uniq[row[relation.LocalFieldsNames[0]]] = struct{}{}
+		}
+
+		filter := exprIn(extModel.FieldExpr(relation.FkFieldsNames[0]))
+		for v := range uniq {
+			filter.Add(exprValue(v))
+		}
+
+		extOpts := GetAllOptions{
+			Distinct:         relationOpts.Distinct,
+			Filter:           andFilter(filter, relationOpts.Filter),
+			OrderBy:          relationOpts.OrderBy,
+			Limit:            relationOpts.Limit,
+			Offset:           relationOpts.Offset,
+			RelationsOptions: extRelationsOptions,
+		}
+		if extOpts.Limit > 0 || extOpts.Offset > 0 {
+			extOpts.PartitionBy = relation.FkFieldsNames
+		}
+
+		extValues, err := extModel.GetAll(extCtx, extFields, extOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, extRow := range extValues.Maps() {
+			stringFk := extModel.FieldsToString(relation.FkFieldsNames, extRow)
+			extValuesMap[stringFk] = append(extValuesMap[stringFk], extRow)
+		}
+	}
+
+	return extValuesMap, nil
+}
+
+func andFilter(filter, extraFilter IExpression) IExpression {
+	if extraFilter == nil {
+		return filter
+	}
+
+	return exprAnd(filter, extraFilter)
+}
+
+func limitRows(rows []map[string]interface{}, offset, limit uint64) []map[string]interface{} {
+	if offset >= uint64(len(rows)) {
+		return nil
+	}
+	rows = rows[offset:]
+
+	if limit > 0 && limit < uint64(len(rows)) {
+		rows = rows[:limit]
+	}
+
+	return rows
+}
+
 func (m *BaseModel) GetAllToStruct(ctx context.Context, arr interface{}, options GetAllOptions) error {
 	ctx = timelog.Start(ctx, m.GetId()+": GetAllToStruct")
 	defer timelog.Finish(ctx)
@@ -657,47 +1044,152 @@ func (m *BaseModel) GetAllToStruct(ctx context.Context, arr interface{}, options
 }
 
 func (m *BaseModel) Edit(ctx context.Context, filter IExpression, newValues map[string]interface{}) error {
-	ctx = timelog.Start(ctx, m.GetId()+": Edit")
+	logMessage := newFilterLogMessage(ctx, m.GetId()+": Edit")
+	ctx = timelog.Start(ctx, logMessage)
 	defer timelog.Finish(ctx)
 
+	_, _, err := m.edit(ctx, logMessage, filter, newValues, nil)
+
+	return err
+}
+
+// edit changes the rows and returns the number of the matched rows and their new values of the returning fields
+func (m *BaseModel) edit(ctx context.Context, logMessage *filterLogMessage, filter IExpression, newValues map[string]interface{}, returning []string) (uint64, *Data, error) {
 	if m.editPermission != nil && !rbac.HasPermission(ctx, m.editPermission) {
-		return EditErrorf("You don't have permission")
+		return 0, nil, EditErrorf("You don't have permission")
 	}
 
 	for name := range newValues {
 		field := m.GetFieldDefinition(name)
 		if field == nil {
-			return qerror.Errorf("Unknown field '%s' in model '%s'", name, m.id)
+			return 0, nil, qerror.Errorf("Unknown field '%s' in model '%s'", name, m.id)
+		}
+
+		if m.versioned && name == VERSION_FIELD {
+			return 0, nil, m.versionFieldError()
 		}
 
 		if perm := field.GetEditPermission(); perm != nil && !rbac.HasPermission(ctx, perm) {
-			return qerror.Errorf("Need permission '%s' to edit field '%s' in model '%s'",
+			return 0, nil, qerror.Errorf("Need permission '%s' to edit field '%s' in model '%s'",
 				perm.GetGroupId()+"."+perm.GetId(), name, m.id)
 		}
 	}
 
+	if err := m.checkReturning(returning); err != nil {
+		return 0, nil, err
+	}
+
 	resFilter, err := m.withDefaultFilter(ctx, filter)
 	if err != nil {
-		return err
+		return 0, nil, err
+	}
+
+	if err := validate(ctx, m, resFilter); err != nil {
+		return 0, nil, err
 	}
+	logMessage.filter = resFilter
 
-	return m.storage.Edit(ctx, m, resFilter, newValues)
+	fieldsNames := make([]string, 0, len(newValues))
+	row := make([]interface{}, 0, len(newValues))
+	for name, value := range newValues {
+		fieldsNames = append(fieldsNames, name)
+		row = append(row, value)
+	}
+
+	references := m.requiredReferences(fieldsNames)
+	checkUniqueKeys := m.checksUniqueKeys()
+	if len(references) == 0 && !checkUniqueKeys {
+		return m.storageEditVersioned(ctx, resFilter, newValues, returning)
+	}
+
+	for _, relation := range references {
+		for _, fieldName := range relation.LocalFieldsNames {
+			if isNilValue(newValues[fieldName]) {
+				return 0, nil, FieldErrorf(fieldName, "Missed required field '%s' value in model '%s'", fieldName, m.id)
+			}
+		}
+	}
+
+	var (
+		count uint64
+		data  *Data
+	)
+	err = m.inTransaction(ctx, func(ctx context.Context) error {
+		if err := m.checkReferences(ctx, references, NewData(fieldsNames, [][]interface{}{row})); err != nil {
+			return err
+		}
+
+		if checkUniqueKeys {
+			if err := m.checkEditUniqueKeys(ctx, resFilter, newValues); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		count, data, err = m.storageEditVersioned(ctx, resFilter, newValues, returning)
+
+		return err
+	})
+
+	return count, data, err
 }
 
 func (m *BaseModel) Delete(ctx context.Context, filter IExpression) error {
-	ctx = timelog.Start(ctx, m.GetId()+": Delete")
+	logMessage := newFilterLogMessage(ctx, m.GetId()+": Delete")
+	ctx = timelog.Start(ctx, logMessage)
 	defer timelog.Finish(ctx)
 
+	_, _, err := m.delete(ctx, logMessage, filter, nil)
+
+	return err
+}
+
+// delete deletes the rows and returns the number of the deleted rows and their values of the returning fields
+func (m *BaseModel) delete(ctx context.Context, logMessage *filterLogMessage, filter IExpression, returning []string) (uint64, *Data, error) {
 	if m.deletePermission != nil && !rbac.HasPermission(ctx, m.deletePermission) {
-		return DeleteErrorf("You don't have permission")
+		return 0, nil, DeleteErrorf("You don't have permission")
+	}
+
+	if err := m.checkReturning(returning); err != nil {
+		return 0, nil, err
 	}
 
 	resFilter, err := m.withDefaultFilter(ctx, filter)
 	if err != nil {
-		return err
+		return 0, nil, err
+	}
+
+	if err := validate(ctx, m, resFilter); err != nil {
+		return 0, nil, err
+	}
+	logMessage.filter = resFilter
+
+	// The soft-deleted rows are kept, so the linked rows are not changed
+	if m.softDelete && !isHardDelete(ctx) {
+		return m.storageEditVersioned(ctx, resFilter, map[string]interface{}{SOFT_DELETE_FIELD: time.Now()}, returning)
 	}
 
-	return m.storage.Delete(ctx, m, resFilter)
+	relations := m.onDeleteRelations()
+	if len(relations) == 0 {
+		return m.storageDelete(ctx, resFilter, returning)
+	}
+
+	var (
+		count uint64
+		data  *Data
+	)
+	err = m.inTransaction(ctx, func(ctx context.Context) error {
+		if err := m.deleteLinked(ctx, relations, resFilter); err != nil {
+			return err
+		}
+
+		var err error
+		count, data, err = m.storageDelete(ctx, resFilter, returning)
+
+		return err
+	})
+
+	return count, data, err
 }
 
 func (m *BaseModel) FieldsToString(fieldsNames []string, row map[string]interface{}) string {
@@ -832,6 +1324,12 @@ func (m *BaseModel) FieldExpr(name string) *exprModelFieldS {
 }
 
 func (m *BaseModel) getFieldsFromStruct(t reflect.Type) ([]string, error) {
+	return m.structFieldsNames(t, map[reflect.Type]bool{t: false})
+}
+
+// structFieldsNames returns the fields names of the structure. The path contains the types of the parent structures,
+// the value is true if the type is fetched by a recursive field, e.g. `field:"children*"`.
+func (m *BaseModel) structFieldsNames(t reflect.Type, path map[reflect.Type]bool) ([]string, error) {
 	if t.Kind() != reflect.Struct {
 		return nil, qerror.Errorf("Invalid type `%s` for getting fields", t.String())
 	}
@@ -845,46 +1343,46 @@ func (m *BaseModel) getFieldsFromStruct(t reflect.Type) ([]string, error) {
 			continue
 		}
 
+		var extType reflect.Type
 		switch field.Type.Kind() {
 		case reflect.Struct:
-			if field.Type.PkgPath() == "time" {
+			if field.Type.PkgPath() != "time" {
 				// no need to inspect internal fields and store them as external table field relation
-				res = append(res, fieldName)
-				break
+				extType = field.Type
 			}
-			extFields, err := m.getFieldsFromStruct(field.Type)
-			if err != nil {
-				return nil, err
-			}
-			for _, extFieldName := range extFields {
-				res = append(res, fieldName+"."+extFieldName)
-			}
-		case reflect.Slice:
+		case reflect.Slice, reflect.Ptr:
 			if field.Type.Elem().Kind() == reflect.Struct {
-				extFields, err := m.getFieldsFromStruct(field.Type.Elem())
-				if err != nil {
-					return nil, err
-				}
-				for _, extFieldName := range extFields {
-					res = append(res, fieldName+"."+extFieldName)
-				}
-			} else {
-				res = append(res, fieldName)
-			}
-		case reflect.Ptr:
-			if field.Type.Elem().Kind() == reflect.Struct {
-				extFields, err := m.getFieldsFromStruct(field.Type.Elem())
-				if err != nil {
-					return nil, err
-				}
-				for _, extFieldName := range extFields {
-					res = append(res, fieldName+"."+extFieldName)
-				}
-			} else {
-				res = append(res, fieldName)
+				extType = field.Type.Elem()
 			}
-		default:
+		}
+
+		if extType == nil {
 			res = append(res, fieldName)
+			continue
+		}
+
+		isRecursive := strings.Contains(fieldName, "*")
+		isFetched, inPath := path[extType]
+		if inPath && !isRecursive {
+			return nil, qerror.Errorf("Field '%s' of the recursive type `%s` must be fetched recursively", fieldName, t.String())
+		}
+		if isFetched && isRecursive {
+			// The recursion is fetched by the parent field
+			continue
+		}
+
+		extPath := make(map[reflect.Type]bool, len(path)+1)
+		for pathType, isFetched := range path {
+			extPath[pathType] = isFetched
+		}
+		extPath[extType] = isRecursive
+
+		extFields, err := m.structFieldsNames(extType, extPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, extFieldName := range extFields {
+			res = append(res, fieldName+"."+extFieldName)
 		}
 	}
 
@@ -908,12 +1406,20 @@ func (m *BaseModel) mapToVar(v interface{}, s reflect.Value) error {
 		if s.Type().PkgPath() == "time" {
 			var str *string
 			switch v := v.(type) {
+			case time.Time:
+				s.Set(reflect.ValueOf(v))
+				return nil
+			case *time.Time:
+				if v != nil {
+					s.Set(reflect.ValueOf(*v))
+				}
+				return nil
 			case string:
 				str = &v
 			case *string:
 				str = v
 			default:
-				panic("unknown type")
+				return qerror.Errorf("Invalid type %T for converting to time", v)
 			}
 			if str == nil || *str == "0000-00-00 00:00:00" {
 				break
@@ -936,7 +1442,8 @@ func (m *BaseModel) mapToVar(v interface{}, s reflect.Value) error {
 
 		for i := 0; i < s.NumField(); i++ {
 			field := s.Field(i)
-			if fieldMap, exists := vMap[m.structFieldToFieldName(s.Type().Field(i))]; exists {
+			fieldName := strings.SplitN(m.structFieldToFieldName(s.Type().Field(i)), "*", 2)[0]
+			if fieldMap, exists := vMap[fieldName]; exists {
 				if err := m.mapToVar(fieldMap, field); err != nil {
 					return err
 				}
@@ -960,19 +1467,41 @@ func (m *BaseModel) mapToVar(v interface{}, s reflect.Value) error {
 			return qerror.Errorf("Invalid type %T for converting to slice", v)
 		}
 	default:
-		if reflect.TypeOf(v).Kind() == reflect.Ptr {
-			rv := reflect.ValueOf(v)
-			if !rv.IsNil() {
-				s.Set(rv.Elem())
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				break
 			}
-		} else {
-			s.Set(reflect.ValueOf(v))
+			rv = rv.Elem()
+		}
+
+		// e.g. uint64 of the rows count to int
+		if rv.Type() != s.Type() {
+			if !convertible(rv.Type(), s.Type()) {
+				return qerror.Errorf("Invalid type %T for converting to %s", v, s.Type().String())
+			}
+			rv = rv.Convert(s.Type())
 		}
+		s.Set(rv)
 	}
 
 	return nil
 }
 
+// convertible reports if the value of type from can be converted to type to.
+// The integers are not converted to strings, because Go makes the string of the code point, e.g. 65 to "A".
+func convertible(from, to reflect.Type) bool {
+	if to.Kind() == reflect.String {
+		switch from.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return false
+		}
+	}
+
+	return from.ConvertibleTo(to)
+}
+
 func (m *BaseModel) structFieldToFieldName(field reflect.StructField) string {
 	fieldName, ok := field.Tag.Lookup("field")
 	if !ok {
@@ -989,6 +1518,14 @@ func (m *BaseModel) structFieldToFieldName(field reflect.StructField) string {
 }
 
 func (m *BaseModel) withDefaultFilter(ctx context.Context, filter IExpression) (IExpression, error) {
+	if isIntegrity(ctx) {
+		return filter, nil
+	}
+
+	if m.softDelete && !isWithDeleted(ctx) {
+		filter = andFilter(exprEq(m.FieldExpr(SOFT_DELETE_FIELD), exprValue(nil)), filter)
+	}
+
 	if m.defaultFilter == nil {
 		return filter, nil
 	}
@@ -0,0 +1,550 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-qbit/timelog"
+)
+
+// WithBatching returns the context which coalesces the concurrent GetAll queries of the rows by the values
+// of a field, e.g. "id IN (1, 2)" and "id = 3", into one storage query. Any field of the model is batched,
+// not only the keys, so the relations loaded by the foreign keys are batched too. The queries with the same
+// model, fields and the rest of the filter are collected during the window and the results are split back
+// by the field values, the values must have the type of the field, otherwise the query is not batched.
+// It is intended for the request scope with many concurrent GetAll calls, e.g. GraphQL resolvers.
+// The queries with OrderBy, Limit, Offset, Distinct, PartitionBy, RowsWoLimit or ForUpdate are not batched,
+// neither are the queries in transactions, see WithTransaction, because the batched query is run outside of them.
+// The batched query gets the context values of the first caller, it is canceled when all the callers are canceled
+// and its deadline is the latest one of the callers.
+func WithBatching(ctx context.Context, window time.Duration) context.Context {
+	return context.WithValue(ctx, batcherCtx, &batcher{
+		window:  window,
+		batches: make(map[string]*batch),
+	})
+}
+
+type batcher struct {
+	window  time.Duration
+	mtx     sync.Mutex
+	batches map[string]*batch
+}
+
+type batch struct {
+	storage     IStorage
+	m           IModel
+	fieldsNames []string
+	keyField    string
+	rest        []IExpression
+	values      []interface{}
+	valuesKeys  map[string]struct{}
+	ctxs        []context.Context
+	done        chan struct{}
+	data        *Data
+	err         error
+}
+
+// query returns the rows using the batcher from the context if the query can be batched.
+// The partitions are limited in memory if the storage does not support PartitionBy.
+func (m *BaseModel) query(ctx context.Context, fieldsNames []string, opts GetAllOptions) (*Data, error) {
+	if len(opts.PartitionBy) > 0 && (opts.Limit > 0 || opts.Offset > 0) {
+		if storage, ok := m.storage.(IPartitionStorage); !ok || !storage.SupportsPartitionBy() {
+			return m.queryPartitions(ctx, fieldsNames, opts)
+		}
+	}
+
+	b, _ := ctx.Value(batcherCtx).(*batcher)
+	if b == nil || isTransaction(ctx) || opts.Distinct || len(opts.OrderBy) > 0 || opts.Limit > 0 || opts.Offset > 0 ||
+		opts.RowsWoLimit != nil || opts.ForUpdate || len(opts.PartitionBy) > 0 {
+		return m.storage.Query(ctx, m, fieldsNames, opts)
+	}
+
+	keyField, values, rest, ok := keyLookup(m, opts.Filter)
+	if !ok {
+		return m.storage.Query(ctx, m, fieldsNames, opts)
+	}
+
+	return b.query(ctx, m.storage, m, fieldsNames, keyField, values, rest)
+}
+
+// queryPartitions queries the rows without the limits and applies Limit and Offset to every partition in memory,
+// it is used for the storages which do not support PartitionBy
+func (m *BaseModel) queryPartitions(ctx context.Context, fieldsNames []string, opts GetAllOptions) (*Data, error) {
+	queryFieldsNames := fieldsNames
+	for _, fieldName := range opts.PartitionBy {
+		if !containsString(queryFieldsNames, fieldName) {
+			queryFieldsNames = append(append([]string{}, queryFieldsNames...), fieldName)
+		}
+	}
+
+	partitionBy, offset, limit := opts.PartitionBy, opts.Offset, opts.Limit
+	opts.PartitionBy, opts.Offset, opts.Limit = nil, 0, 0
+
+	data, err := m.storage.Query(ctx, m, queryFieldsNames, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	partitionsData := data.GetFieldsData(partitionBy).Data()
+	fieldsData := data.GetFieldsData(fieldsNames).Data()
+
+	// Number of the rows in every partition
+	partitions := make(map[string]uint64)
+
+	res := NewEmptyData(fieldsNames)
+	for i, row := range fieldsData {
+		partition := linkKey(partitionsData[i])
+		partitions[partition]++
+
+		if n := partitions[partition]; n <= offset || limit > 0 && n > offset+limit {
+			continue
+		}
+
+		if err := res.Add(row); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+func (b *batcher) query(ctx context.Context, storage IStorage, m IModel, fieldsNames []string, keyField string, values []interface{}, rest []IExpression) (*Data, error) {
+	sortedFields := append([]string{}, fieldsNames...)
+	sort.Strings(sortedFields)
+
+	key := m.GetId() + "\x00" + strings.Join(sortedFields, ",") + "\x00" + keyField
+	if len(rest) > 0 {
+		key += "\x00" + exprKey(exprAnd(rest...))
+	}
+
+	b.mtx.Lock()
+	bt, exists := b.batches[key]
+	if !exists {
+		bt = &batch{
+			storage:     storage,
+			m:           m,
+			fieldsNames: fieldsNames,
+			keyField:    keyField,
+			rest:        rest,
+			valuesKeys:  make(map[string]struct{}),
+			done:        make(chan struct{}),
+		}
+		b.batches[key] = bt
+
+		time.AfterFunc(b.window, func() {
+			b.mtx.Lock()
+			delete(b.batches, key)
+			b.mtx.Unlock()
+
+			ctx, cancel := callersCtx(bt.ctxs)
+			defer cancel()
+
+			bt.run(ctx)
+		})
+	}
+
+	bt.ctxs = append(bt.ctxs, ctx)
+	for _, value := range values {
+		valueKey := batchValueKey(value)
+		if _, exists := bt.valuesKeys[valueKey]; !exists {
+			bt.valuesKeys[valueKey] = struct{}{}
+			bt.values = append(bt.values, value)
+		}
+	}
+	b.mtx.Unlock()
+
+	select {
+	case <-bt.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if bt.err != nil {
+		return nil, bt.err
+	}
+
+	return bt.split(values)
+}
+
+func (bt *batch) run(ctx context.Context) {
+	defer close(bt.done)
+
+	if bt.err = ctx.Err(); bt.err != nil {
+		return
+	}
+
+	filter := exprIn(bt.m.FieldExpr(bt.keyField))
+	for _, value := range bt.values {
+		filter.Add(exprValue(value))
+	}
+
+	fieldsNames := bt.fieldsNames
+	if !containsString(fieldsNames, bt.keyField) {
+		fieldsNames = append(append([]string{}, fieldsNames...), bt.keyField)
+	}
+
+	bt.data, bt.err = bt.storage.Query(ctx, bt.m, fieldsNames, GetAllOptions{Filter: andFilter(filter, andExpr(bt.rest))})
+}
+
+// callersCtx returns the context of the batched query with the values of the first caller,
+// it is canceled when all the callers are canceled and its deadline is the latest one of the callers
+func callersCtx(ctxs []context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(batchCtx{ctxs[0]})
+
+	var latest time.Time
+	for _, callerCtx := range ctxs {
+		deadline, ok := callerCtx.Deadline()
+		if !ok {
+			latest = time.Time{}
+			break
+		}
+		if deadline.After(latest) {
+			latest = deadline
+		}
+	}
+
+	if !latest.IsZero() {
+		var cancelDeadline context.CancelFunc
+		ctx, cancelDeadline = context.WithDeadline(ctx, latest)
+		cancelCtx := cancel
+		cancel = func() {
+			cancelDeadline()
+			cancelCtx()
+		}
+	}
+
+	canceled := true
+	for _, callerCtx := range ctxs {
+		if callerCtx.Err() == nil {
+			canceled = false
+			break
+		}
+	}
+	if canceled {
+		cancel()
+		return ctx, cancel
+	}
+
+	go func() {
+		for _, callerCtx := range ctxs {
+			select {
+			case <-callerCtx.Done():
+			case <-ctx.Done():
+				return
+			}
+		}
+		cancel()
+	}()
+
+	return ctx, cancel
+}
+
+// batchCtx keeps the values of the caller context without its cancellation and hides the timelog,
+// it is not safe for concurrent use
+type batchCtx struct {
+	context.Context
+}
+
+func (c batchCtx) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (c batchCtx) Done() <-chan struct{}       { return nil }
+func (c batchCtx) Err() error                  { return nil }
+
+func (c batchCtx) Value(key interface{}) interface{} {
+	value := c.Context.Value(key)
+	if _, isTimelog := value.(*timelog.TlEntity); isTimelog {
+		return nil
+	}
+
+	return value
+}
+
+// split returns the rows of the batch with the key values
+func (bt *batch) split(values []interface{}) (*Data, error) {
+	keys := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		keys[batchValueKey(value)] = struct{}{}
+	}
+
+	keyNum := bt.data.FieldNum(bt.keyField)
+	fieldsData := bt.data.GetFieldsData(bt.fieldsNames)
+
+	res := NewEmptyData(bt.fieldsNames)
+	for i, row := range bt.data.Data() {
+		if _, exists := keys[batchValueKey(row[keyNum])]; !exists {
+			continue
+		}
+
+		if err := res.Add(append([]interface{}{}, fieldsData.Data()[i]...)); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// batchValueKey returns the key of the field value, the times of different locations are the same instant
+func batchValueKey(value interface{}) string {
+	if !isNilValue(value) {
+		rv := reflect.ValueOf(value)
+		for rv.Kind() == reflect.Ptr {
+			rv = rv.Elem()
+		}
+		if t, ok := rv.Interface().(time.Time); ok {
+			value = t.UTC()
+		}
+	}
+
+	return linkKey([]interface{}{value})
+}
+
+// batchable checks the value has the type of the field, so the rows are split back by the equal value keys,
+// the integers of different types are formatted equally
+func batchable(field IFieldDefinition, value interface{}) bool {
+	if field == nil || field.GetType() == nil {
+		return false
+	}
+
+	rt := indirectType(field.GetType())
+
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+
+	return rv.Type() == rt || isIntegerKind(rv.Kind()) && isIntegerKind(rt.Kind())
+}
+
+func isIntegerKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+// exprKey returns the key of the expression with the exact typed values, the equal expressions have the equal keys
+func exprKey(e IExpression) string {
+	w := &exprKeyWriter{}
+	e.GetProcessor(w)
+
+	return w.buf.String()
+}
+
+type exprKeyWriter struct {
+	buf strings.Builder
+}
+
+func (w *exprKeyWriter) write(name string, ops ...IExpression) interface{} {
+	w.buf.WriteString(name + "(")
+	for i, op := range ops {
+		if i > 0 {
+			w.buf.WriteByte(',')
+		}
+		op.GetProcessor(w)
+	}
+	w.buf.WriteByte(')')
+
+	return nil
+}
+
+func (w *exprKeyWriter) Eq(op1, op2 IExpression) interface{}    { return w.write("eq", op1, op2) }
+func (w *exprKeyWriter) Ne(op1, op2 IExpression) interface{}    { return w.write("ne", op1, op2) }
+func (w *exprKeyWriter) Lt(op1, op2 IExpression) interface{}    { return w.write("lt", op1, op2) }
+func (w *exprKeyWriter) Le(op1, op2 IExpression) interface{}    { return w.write("le", op1, op2) }
+func (w *exprKeyWriter) Gt(op1, op2 IExpression) interface{}    { return w.write("gt", op1, op2) }
+func (w *exprKeyWriter) Ge(op1, op2 IExpression) interface{}    { return w.write("ge", op1, op2) }
+func (w *exprKeyWriter) And(operands []IExpression) interface{} { return w.write("and", operands...) }
+func (w *exprKeyWriter) Or(operands []IExpression) interface{}  { return w.write("or", operands...) }
+
+func (w *exprKeyWriter) In(op IExpression, arr []IExpression) interface{} {
+	return w.write("in", append([]IExpression{op}, arr...)...)
+}
+
+func (w *exprKeyWriter) Func(name string, args ...IExpression) interface{} {
+	return w.write("func "+strconv.Quote(name), args...)
+}
+
+func (w *exprKeyWriter) Any(m IModel, relationName string, filter IExpression) interface{} {
+	if filter == nil {
+		return w.write("any " + strconv.Quote(m.GetId()+"."+relationName))
+	}
+
+	return w.write("any "+strconv.Quote(m.GetId()+"."+relationName), filter)
+}
+
+func (w *exprKeyWriter) ModelField(m IModel, fieldName string) interface{} {
+	w.buf.WriteString("field " + strconv.Quote(m.GetId()+"."+fieldName))
+	return nil
+}
+
+func (w *exprKeyWriter) Excluded(fieldName string) interface{} {
+	w.buf.WriteString("excluded " + strconv.Quote(fieldName))
+	return nil
+}
+
+// Value writes the type and the value, the times are written with the nanoseconds and the location
+func (w *exprKeyWriter) Value(value interface{}) interface{} {
+	if isNilValue(value) {
+		w.buf.WriteString("null")
+		return nil
+	}
+
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+
+	switch v := rv.Interface().(type) {
+	case time.Time:
+		w.buf.WriteString("time " + strconv.Quote(v.Format(time.RFC3339Nano)+" "+v.Location().String()))
+	default:
+		w.buf.WriteString("value " + strconv.Quote(fmt.Sprintf("%T:%#v", v, v)))
+	}
+
+	return nil
+}
+
+func andExpr(ops []IExpression) IExpression {
+	switch len(ops) {
+	case 0:
+		return nil
+	case 1:
+		return ops[0]
+	default:
+		return exprAnd(ops...)
+	}
+}
+
+func containsString(arr []string, s string) bool {
+	for _, v := range arr {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// keyLookup checks the filter is "field IN (values)" or "field = value" of the model fields with the values
+// of the field type, optionally combined by AND with the other conditions returned in rest
+func keyLookup(m IModel, filter IExpression) (string, []interface{}, []IExpression, bool) {
+	if filter == nil {
+		return "", nil, nil, false
+	}
+
+	d := &keyLookupDetector{m}
+	node := filter.GetProcessor(d).(*keyLookupNode)
+
+	switch node.kind {
+	case lookupKeys:
+		return node.field, node.values, nil, true
+
+	case lookupAnd:
+		var (
+			lookup *keyLookupNode
+			rest   []IExpression
+		)
+		for _, op := range node.ops {
+			if opNode := op.GetProcessor(d).(*keyLookupNode); lookup == nil && opNode.kind == lookupKeys {
+				lookup = opNode
+			} else {
+				rest = append(rest, op)
+			}
+		}
+
+		if lookup != nil {
+			return lookup.field, lookup.values, rest, true
+		}
+	}
+
+	return "", nil, nil, false
+}
+
+const (
+	lookupOther = iota
+	lookupField
+	lookupValue
+	lookupKeys
+	lookupAnd
+)
+
+type keyLookupNode struct {
+	kind   int
+	field  string
+	values []interface{}
+	ops    []IExpression
+}
+
+var lookupOtherNode = &keyLookupNode{kind: lookupOther}
+
+// keyLookupDetector recognizes the lookups of the rows by the field values
+type keyLookupDetector struct {
+	m IModel
+}
+
+func (d *keyLookupDetector) node(e IExpression) *keyLookupNode {
+	return e.GetProcessor(d).(*keyLookupNode)
+}
+
+func (d *keyLookupDetector) keys(op IExpression, arr []IExpression) interface{} {
+	field := d.node(op)
+	if field.kind != lookupField {
+		return lookupOtherNode
+	}
+
+	res := &keyLookupNode{kind: lookupKeys, field: field.field}
+	for _, e := range arr {
+		value := d.node(e)
+		if value.kind != lookupValue || isNilValue(value.values[0]) ||
+			!batchable(d.m.GetFieldDefinition(field.field), value.values[0]) {
+			return lookupOtherNode
+		}
+		res.values = append(res.values, value.values[0])
+	}
+
+	return res
+}
+
+func (d *keyLookupDetector) Eq(op1, op2 IExpression) interface{} {
+	if d.node(op1).kind == lookupValue {
+		op1, op2 = op2, op1
+	}
+
+	return d.keys(op1, []IExpression{op2})
+}
+
+func (d *keyLookupDetector) In(op IExpression, arr []IExpression) interface{} { return d.keys(op, arr) }
+
+func (d *keyLookupDetector) And(operands []IExpression) interface{} {
+	return &keyLookupNode{kind: lookupAnd, ops: operands}
+}
+
+func (d *keyLookupDetector) ModelField(m IModel, fieldName string) interface{} {
+	if m.GetId() != d.m.GetId() {
+		return lookupOtherNode
+	}
+
+	return &keyLookupNode{kind: lookupField, field: fieldName}
+}
+
+func (d *keyLookupDetector) Value(value interface{}) interface{} {
+	return &keyLookupNode{kind: lookupValue, values: []interface{}{value}}
+}
+
+func (d *keyLookupDetector) Ne(op1, op2 IExpression) interface{}         { return lookupOtherNode }
+func (d *keyLookupDetector) Lt(op1, op2 IExpression) interface{}         { return lookupOtherNode }
+func (d *keyLookupDetector) Le(op1, op2 IExpression) interface{}         { return lookupOtherNode }
+func (d *keyLookupDetector) Gt(op1, op2 IExpression) interface{}         { return lookupOtherNode }
+func (d *keyLookupDetector) Ge(op1, op2 IExpression) interface{}         { return lookupOtherNode }
+func (d *keyLookupDetector) Or(operands []IExpression) interface{}       { return lookupOtherNode }
+func (d *keyLookupDetector) Func(string, ...IExpression) interface{}     { return lookupOtherNode }
+func (d *keyLookupDetector) Any(IModel, string, IExpression) interface{} { return lookupOtherNode }
+func (d *keyLookupDetector) Excluded(string) interface{}                 { return lookupOtherNode }
@@ -0,0 +1,635 @@
+// Package conformance contains scenarios every model.IStorage implementation must pass.
+//
+// Run it from a test of the storage package:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, func() model.IStorage { return NewStorage() })
+//	}
+package conformance
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/go-qbit/model"
+	"github.com/go-qbit/model/expr"
+	"github.com/go-qbit/model/relation"
+	"github.com/go-qbit/model/test"
+)
+
+// StorageFactory must return a new empty storage on every call
+type StorageFactory func() model.IStorage
+
+// Run runs all the scenarios for storages created by the factory
+func Run(t *testing.T, newStorage StorageFactory) {
+	suite.Run(t, &storageSuite{newStorage: newStorage})
+}
+
+type storageSuite struct {
+	suite.Suite
+	newStorage StorageFactory
+	storage    model.IStorage
+	user       *test.User
+	phone      *test.Phone
+	address    *test.Address
+	message    *test.Message
+}
+
+func (s *storageSuite) SetupTest() {
+	ctx := context.Background()
+
+	s.storage = s.newStorage()
+
+	s.user = test.NewUser(s.storage)
+	s.phone = test.NewPhone(s.storage)
+	s.message = test.NewMessage(s.storage)
+	s.address = test.NewAddress(s.storage)
+
+	relation.AddOneToOne(s.phone, s.user)
+	relation.AddManyToOne(s.message, s.user)
+	relation.AddManyToMany(s.user, s.address, s.storage)
+
+	pk, err := s.storage.Add(ctx, s.user, model.NewData(
+		[]string{"id", "name", "lastname"},
+		[][]interface{}{
+			{1, "Ivan", "Sidorov"},
+			{2, "Petr", "Ivanov"},
+			{3, "James", "Bond"},
+			{4, "John", "Connor"},
+			{5, "Sara", "Connor"},
+		}), model.AddOptions{},
+	)
+	s.Require().NoError(err)
+	s.Require().Equal(normalize([][]interface{}{{1}, {2}, {3}, {4}, {5}}), normalize(pk.Data()))
+
+	_, err = s.storage.Add(ctx, s.phone, model.NewData(
+		[]string{"id", "country_code", "code", "number"},
+		[][]interface{}{
+			{1, 1, 111, 1111111},
+			{3, 3, 333, 3333333},
+		}), model.AddOptions{},
+	)
+	s.Require().NoError(err)
+
+	_, err = s.storage.Add(ctx, s.message, model.NewData(
+		[]string{"id", "text", "fk_user_id"},
+		[][]interface{}{
+			{10, "Message 1", 1},
+			{20, "Message 2", 1},
+			{30, "Message 3", 1},
+			{40, "Message 4", 2},
+		}), model.AddOptions{},
+	)
+	s.Require().NoError(err)
+
+	_, err = s.storage.Add(ctx, s.address, model.NewData(
+		[]string{"id", "country", "city", "address"},
+		[][]interface{}{
+			{100, "USA", "Arlington", "1022 Bridges Dr"},
+			{200, "USA", "Fort Worth", "7105 Plover Circle"},
+			{300, "USA", "Crowley", "524 Pecan Street"},
+			{400, "USA", "Arlington", "1022 Bridges Dr"},
+			{500, "USA", nil, "1246 Everett Avenue"},
+		}), model.AddOptions{},
+	)
+	s.Require().NoError(err)
+
+	s.Require().NoError(s.user.Link(ctx, "address", []model.ModelLink{
+		{Pk: []interface{}{1}, Fks: [][]interface{}{{100}, {200}}},
+		{Pk: []interface{}{2}, Fks: [][]interface{}{{200}, {300}}},
+		{Pk: []interface{}{3}, Fks: [][]interface{}{{300}}},
+		{Pk: []interface{}{4}, Fks: [][]interface{}{{400}}},
+	}))
+}
+
+// normalize converts the numbers to int64, uint64 or float64 in the values returned by the storage,
+// the storages can return any numeric types, e.g. SQL drivers return int64 for all the integer columns
+func normalize(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() <= math.MaxInt64 {
+			return int64(rv.Uint())
+		}
+		return rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.Slice:
+		if _, ok := v.([]byte); ok {
+			return v
+		}
+		res := make([]interface{}, rv.Len())
+		for i := range res {
+			res[i] = normalize(rv.Index(i).Interface())
+		}
+		return res
+	case reflect.Map:
+		res := make(map[interface{}]interface{}, rv.Len())
+		for _, key := range rv.MapKeys() {
+			res[key.Interface()] = normalize(rv.MapIndex(key).Interface())
+		}
+		return res
+	default:
+		return v
+	}
+}
+
+// equal compares the values returned by the storage with the expected ones after normalizing the numbers
+func (s *storageSuite) equal(expected, actual interface{}, msgAndArgs ...interface{}) bool {
+	return s.Equal(normalize(expected), normalize(actual), msgAndArgs...)
+}
+
+// elementsMatch compares the rows returned by the storage with the expected ones in any order after normalizing the numbers
+func (s *storageSuite) elementsMatch(expected, actual interface{}, msgAndArgs ...interface{}) bool {
+	return s.ElementsMatch(normalize(expected), normalize(actual), msgAndArgs...)
+}
+
+func in(op model.IExpression, values ...interface{}) model.IExpression {
+	res := expr.In(op)
+	for _, v := range values {
+		res.Add(expr.Value(v))
+	}
+
+	return res
+}
+
+func (s *storageSuite) query(m model.IModel, fieldsNames []string, opts model.GetAllOptions) [][]interface{} {
+	data, err := s.storage.Query(context.Background(), m, fieldsNames, opts)
+	s.Require().NoError(err)
+	s.Require().Equal(fieldsNames, data.Fields())
+
+	return data.Data()
+}
+
+func (s *storageSuite) ids(m model.IModel, filter model.IExpression) []interface{} {
+	var res []interface{}
+	for _, row := range s.query(m, []string{"id"}, model.GetAllOptions{Filter: filter, OrderBy: []model.Order{{FieldName: "id"}}}) {
+		res = append(res, row[0])
+	}
+
+	return res
+}
+
+func (s *storageSuite) TestAddAndQuery() {
+	s.equal([][]interface{}{
+		{1, "Ivan", "Sidorov"},
+		{2, "Petr", "Ivanov"},
+		{3, "James", "Bond"},
+		{4, "John", "Connor"},
+		{5, "Sara", "Connor"},
+	}, s.query(s.user, []string{"id", "name", "lastname"}, model.GetAllOptions{OrderBy: []model.Order{{FieldName: "id"}}}))
+
+	s.equal([][]interface{}{
+		{"Message 4", 2, 40},
+	}, s.query(s.message, []string{"text", "fk_user_id", "id"}, model.GetAllOptions{
+		Filter: expr.Eq(expr.ModelField(s.message, "id"), expr.Value(40)),
+	}))
+}
+
+func (s *storageSuite) TestAddDuplicate() {
+	_, err := s.storage.Add(context.Background(), s.user, model.NewData(
+		[]string{"id", "name", "lastname"},
+		[][]interface{}{{1, "Ivan", "Petrov"}},
+	), model.AddOptions{})
+	s.Error(err)
+
+	s.equal([][]interface{}{{"Sidorov"}}, s.query(s.user, []string{"lastname"}, model.GetAllOptions{
+		Filter: expr.Eq(expr.ModelField(s.user, "id"), expr.Value(1)),
+	}))
+}
+
+func (s *storageSuite) TestAddReplace() {
+	pk, err := s.storage.Add(context.Background(), s.user, model.NewData(
+		[]string{"id", "name", "lastname"},
+		[][]interface{}{{1, "Ivan", "Petrov"}, {6, "Anna", "Karenina"}},
+	), model.AddOptions{Replace: true})
+	s.NoError(err)
+	s.equal([][]interface{}{{1}, {6}}, pk.Data())
+
+	s.equal([][]interface{}{
+		{1, "Ivan", "Petrov"},
+		{6, "Anna", "Karenina"},
+	}, s.query(s.user, []string{"id", "name", "lastname"}, model.GetAllOptions{
+		Filter:  in(expr.ModelField(s.user, "id"), 1, 6),
+		OrderBy: []model.Order{{FieldName: "id"}},
+	}))
+}
+
+func (s *storageSuite) TestAddOnConflict() {
+	pk, err := s.storage.Add(context.Background(), s.user, model.NewData(
+		[]string{"id", "name", "lastname"},
+		[][]interface{}{{1, "Ivan2", "Petrov"}, {6, "Anna", "Karenina"}},
+	), model.AddOptions{OnConflict: &model.OnConflict{Update: map[string]model.IExpression{
+		"name": expr.Excluded("name"),
+	}}})
+	s.NoError(err)
+	s.equal([][]interface{}{{1}, {6}}, pk.Data())
+
+	pk, err = s.storage.Add(context.Background(), s.user, model.NewData(
+		[]string{"id", "name", "lastname"},
+		[][]interface{}{{2, "Sarah", "Connor"}},
+	), model.AddOptions{OnConflict: &model.OnConflict{Target: []string{"id"}}})
+	s.NoError(err)
+	s.equal([][]interface{}{{2}}, pk.Data())
+
+	s.equal([][]interface{}{
+		{1, "Ivan2", "Sidorov"},
+		{2, "Petr", "Ivanov"},
+		{6, "Anna", "Karenina"},
+	}, s.query(s.user, []string{"id", "name", "lastname"}, model.GetAllOptions{
+		Filter:  in(expr.ModelField(s.user, "id"), 1, 2, 6),
+		OrderBy: []model.Order{{FieldName: "id"}},
+	}))
+}
+
+func (s *storageSuite) TestUniqueKeys() {
+	if storage, ok := s.storage.(model.IUniqueStorage); !ok || !storage.SupportsUniqueKeys() {
+		s.T().Skip("The storage does not support unique keys")
+	}
+
+	ctx := context.Background()
+
+	tag := model.NewBaseModel("tag", []model.IFieldDefinition{
+		&model.IntField{Id: "id", Caption: "ID"},
+		&model.StringField{Id: "name", Caption: "Name"},
+		&model.StringField{Id: "slug", Caption: "Slug"},
+	}, s.storage, model.BaseModelOpts{PkFieldsNames: []string{"id"}, UniqueKeys: [][]string{{"slug"}}})
+
+	_, err := s.storage.Add(ctx, tag, model.NewData([]string{"id", "name", "slug"}, [][]interface{}{
+		{1, "Go", "go"}, {2, "Rust", "rust"}, {3, "C", nil}, {4, "C++", nil},
+	}), model.AddOptions{})
+	s.Require().NoError(err)
+
+	var uniqueErr *model.UniqueViolationError
+	for _, rows := range [][][]interface{}{
+		{{5, "Golang", "go"}},
+		{{5, "Python", "python"}, {6, "Python 3", "python"}},
+	} {
+		_, err = s.storage.Add(ctx, tag, model.NewData([]string{"id", "name", "slug"}, rows), model.AddOptions{})
+		s.Require().True(errors.As(err, &uniqueErr), "%v", err)
+		s.equal([]string{"slug"}, uniqueErr.Fields)
+	}
+
+	_, err = s.storage.Edit(ctx, tag, expr.Eq(expr.ModelField(tag, "id"), expr.Value(2)), map[string]interface{}{"slug": "go"})
+	s.True(errors.As(err, &uniqueErr), "%v", err)
+
+	pk, err := s.storage.Add(ctx, tag, model.NewData([]string{"id", "name", "slug"}, [][]interface{}{{7, "Golang", "go"}}),
+		model.AddOptions{OnConflict: &model.OnConflict{
+			Target: []string{"slug"},
+			Update: map[string]model.IExpression{"name": expr.Excluded("name")},
+		}})
+	s.NoError(err)
+	s.equal([][]interface{}{{1}}, pk.Data())
+
+	s.equal([][]interface{}{
+		{1, "Golang", "go"},
+		{2, "Rust", "rust"},
+		{3, "C", nil},
+		{4, "C++", nil},
+	}, s.query(tag, []string{"id", "name", "slug"}, model.GetAllOptions{OrderBy: []model.Order{{FieldName: "id"}}}))
+}
+
+func (s *storageSuite) TestEdit() {
+	n, err := s.storage.Edit(context.Background(), s.user, expr.Eq(expr.ModelField(s.user, "lastname"), expr.Value("Connor")),
+		map[string]interface{}{"lastname": "O'Connor"})
+	s.NoError(err)
+	s.equal(uint64(2), n)
+
+	s.equal([][]interface{}{
+		{1, "Sidorov"},
+		{2, "Ivanov"},
+		{3, "Bond"},
+		{4, "O'Connor"},
+		{5, "O'Connor"},
+	}, s.query(s.user, []string{"id", "lastname"}, model.GetAllOptions{OrderBy: []model.Order{{FieldName: "id"}}}))
+
+	n, err = s.storage.Edit(context.Background(), s.user, expr.Eq(expr.ModelField(s.user, "id"), expr.Value(10)),
+		map[string]interface{}{"lastname": "Reese"})
+	s.NoError(err)
+	s.equal(uint64(0), n)
+}
+
+func (s *storageSuite) TestEditMulti() {
+	storage, ok := s.storage.(model.IBatchEditStorage)
+	if !ok {
+		s.T().Skip("The storage does not support batch edit")
+	}
+
+	n, err := storage.EditMulti(context.Background(), s.user, model.NewData([]string{"lastname", "id"}, [][]interface{}{
+		{"Petrov", 1}, {"Reese", 4}, {"Smith", 10},
+	}), expr.Ne(expr.ModelField(s.user, "name"), expr.Value("John")))
+	s.NoError(err)
+	s.equal(uint64(1), n)
+
+	s.equal([][]interface{}{
+		{1, "Petrov"},
+		{2, "Ivanov"},
+		{3, "Bond"},
+		{4, "Connor"},
+		{5, "Connor"},
+	}, s.query(s.user, []string{"id", "lastname"}, model.GetAllOptions{OrderBy: []model.Order{{FieldName: "id"}}}))
+}
+
+func (s *storageSuite) TestDelete() {
+	n, err := s.storage.Delete(context.Background(), s.message, expr.Eq(expr.ModelField(s.message, "fk_user_id"), expr.Value(1)))
+	s.NoError(err)
+	s.equal(uint64(3), n)
+	s.equal([]interface{}{40}, s.ids(s.message, nil))
+
+	n, err = s.storage.Delete(context.Background(), s.message, expr.Eq(expr.ModelField(s.message, "fk_user_id"), expr.Value(1)))
+	s.NoError(err)
+	s.equal(uint64(0), n)
+}
+
+func (s *storageSuite) TestQueryWithoutFields() {
+	s.equal([][]interface{}{{}, {}}, s.query(s.user, []string{}, model.GetAllOptions{
+		Filter: expr.Eq(expr.ModelField(s.user, "lastname"), expr.Value("Connor")),
+	}))
+	s.equal([][]interface{}{{}}, s.query(s.user, []string{}, model.GetAllOptions{Limit: 1}))
+}
+
+func (s *storageSuite) TestCount() {
+	storage, ok := s.storage.(model.ICountStorage)
+	if !ok {
+		s.T().Skip("The storage does not support counting")
+	}
+
+	n, err := storage.Count(context.Background(), s.user, expr.Eq(expr.ModelField(s.user, "lastname"), expr.Value("Connor")))
+	s.NoError(err)
+	s.equal(uint64(2), n)
+
+	n, err = storage.Count(context.Background(), s.user, nil)
+	s.NoError(err)
+	s.equal(uint64(5), n)
+
+	exists, err := storage.Exists(context.Background(), s.user, expr.Eq(expr.ModelField(s.user, "name"), expr.Value("Kyle")))
+	s.NoError(err)
+	s.False(exists)
+
+	exists, err = storage.Exists(context.Background(), s.user, expr.Eq(expr.ModelField(s.user, "name"), expr.Value("John")))
+	s.NoError(err)
+	s.True(exists)
+}
+
+func (s *storageSuite) TestReturning() {
+	storage, ok := s.storage.(model.IReturningStorage)
+	if !ok {
+		s.T().Skip("The storage does not support returning")
+	}
+
+	data, err := storage.EditReturning(context.Background(), s.user, expr.Eq(expr.ModelField(s.user, "lastname"), expr.Value("Connor")),
+		map[string]interface{}{"name": "Kyle"}, []string{"id", "name"})
+	s.Require().NoError(err)
+	s.equal([]string{"id", "name"}, data.Fields())
+	s.elementsMatch([][]interface{}{{4, "Kyle"}, {5, "Kyle"}}, data.Data())
+
+	data, err = storage.DeleteReturning(context.Background(), s.message, expr.Eq(expr.ModelField(s.message, "fk_user_id"), expr.Value(1)),
+		[]string{"id", "text"})
+	s.Require().NoError(err)
+	s.elementsMatch([][]interface{}{{10, "Message 1"}, {20, "Message 2"}, {30, "Message 3"}}, data.Data())
+	s.equal([]interface{}{40}, s.ids(s.message, nil))
+
+	data, err = storage.DeleteReturning(context.Background(), s.message, expr.Eq(expr.ModelField(s.message, "id"), expr.Value(10)),
+		[]string{"id"})
+	s.Require().NoError(err)
+	s.equal(0, data.Len())
+}
+
+func (s *storageSuite) TestOperators() {
+	id := expr.ModelField(s.user, "id")
+	lastname := expr.ModelField(s.user, "lastname")
+
+	for _, tt := range []struct {
+		name   string
+		filter model.IExpression
+		ids    []interface{}
+	}{
+		{"Eq", expr.Eq(lastname, expr.Value("Connor")), []interface{}{4, 5}},
+		{"Ne", expr.Ne(lastname, expr.Value("Connor")), []interface{}{1, 2, 3}},
+		{"Lt", expr.Lt(id, expr.Value(3)), []interface{}{1, 2}},
+		{"Le", expr.Le(id, expr.Value(3)), []interface{}{1, 2, 3}},
+		{"Gt", expr.Gt(id, expr.Value(3)), []interface{}{4, 5}},
+		{"Ge", expr.Ge(id, expr.Value(3)), []interface{}{3, 4, 5}},
+		{"Value on the left", expr.Gt(expr.Value(3), id), []interface{}{1, 2}},
+		{"String order", expr.Lt(lastname, expr.Value("Connor")), []interface{}{3}},
+		{"In", in(id, 2, 4, 6), []interface{}{2, 4}},
+		{"Empty in", in(id), nil},
+		{"And", expr.And(expr.Gt(id, expr.Value(1)), expr.Lt(id, expr.Value(5)), expr.Ne(id, expr.Value(3))), []interface{}{2, 4}},
+		{"Or", expr.Or(expr.Eq(id, expr.Value(1)), expr.Eq(lastname, expr.Value("Connor"))), []interface{}{1, 4, 5}},
+		{"Nested", expr.And(expr.Or(expr.Eq(id, expr.Value(1)), expr.Eq(id, expr.Value(5))), expr.Eq(lastname, expr.Value("Connor"))), []interface{}{5}},
+		{"Any one to many", expr.Any(s.user, "message", expr.Eq(expr.ModelField(s.message, "text"), expr.Value("Message 4"))), []interface{}{2}},
+		{"Any one to one", expr.Any(s.user, "phone", nil), []interface{}{1, 3}},
+		{"Any many to many", expr.Any(s.user, "address", expr.Eq(expr.ModelField(s.address, "city"), expr.Value("Crowley"))), []interface{}{2, 3}},
+	} {
+		s.equal(tt.ids, s.ids(s.user, tt.filter), tt.name)
+	}
+}
+
+func (s *storageSuite) TestNull() {
+	city := expr.ModelField(s.address, "city")
+
+	s.equal([]interface{}{500}, s.ids(s.address, expr.Eq(city, expr.Value(nil))), "IS NULL")
+	s.equal([]interface{}{100, 200, 300, 400}, s.ids(s.address, expr.Ne(city, expr.Value(nil))), "IS NOT NULL")
+	s.equal([]interface{}{100, 300, 400}, s.ids(s.address, expr.Lt(city, expr.Value("D"))), "NULL is not ordered")
+
+	s.equal([][]interface{}{{nil, "1246 Everett Avenue"}}, s.query(s.address, []string{"city", "address"}, model.GetAllOptions{
+		Filter: expr.Eq(expr.ModelField(s.address, "id"), expr.Value(500)),
+	}))
+
+	_, err := s.storage.Edit(context.Background(), s.address, expr.Eq(city, expr.Value("Crowley")), map[string]interface{}{"city": nil})
+	s.NoError(err)
+	s.equal([]interface{}{300, 500}, s.ids(s.address, expr.Eq(city, expr.Value(nil))))
+}
+
+func (s *storageSuite) TestOrderBy() {
+	s.equal([][]interface{}{
+		{1, "Sidorov"},
+		{3, "Bond"},
+		{4, "Connor"},
+		{2, "Ivanov"},
+		{5, "Connor"},
+	}, s.query(s.user, []string{"id", "lastname"}, model.GetAllOptions{
+		OrderBy: []model.Order{{FieldName: "name"}},
+	}))
+
+	s.equal([][]interface{}{
+		{"Sidorov", 1},
+		{"Ivanov", 2},
+		{"Connor", 5},
+		{"Connor", 4},
+		{"Bond", 3},
+	}, s.query(s.user, []string{"lastname", "id"}, model.GetAllOptions{
+		OrderBy: []model.Order{{FieldName: "lastname", Desc: true}, {FieldName: "id", Desc: true}},
+	}))
+}
+
+func (s *storageSuite) TestLimit() {
+	var total uint64
+
+	s.equal([][]interface{}{{2}, {3}}, s.query(s.user, []string{"id"}, model.GetAllOptions{
+		OrderBy:     []model.Order{{FieldName: "id"}},
+		Limit:       2,
+		Offset:      1,
+		RowsWoLimit: &total,
+	}))
+	s.equal(uint64(5), total)
+
+	s.equal([][]interface{}{{5}}, s.query(s.user, []string{"id"}, model.GetAllOptions{
+		Filter:  expr.Gt(expr.ModelField(s.user, "id"), expr.Value(1)),
+		OrderBy: []model.Order{{FieldName: "id", Desc: true}},
+		Limit:   1,
+	}))
+
+	s.Empty(s.query(s.user, []string{"id"}, model.GetAllOptions{
+		OrderBy: []model.Order{{FieldName: "id"}},
+		Offset:  10,
+	}))
+}
+
+func (s *storageSuite) TestPartitionBy() {
+	if storage, ok := s.storage.(model.IPartitionStorage); !ok || !storage.SupportsPartitionBy() {
+		s.T().Skip("The storage does not support partitions")
+	}
+
+	var total uint64
+
+	s.equal([][]interface{}{{"Bond", 3}, {"Connor", 5}, {"Ivanov", 2}, {"Sidorov", 1}}, s.query(s.user, []string{"lastname", "id"}, model.GetAllOptions{
+		OrderBy:     []model.Order{{FieldName: "lastname"}, {FieldName: "id", Desc: true}},
+		PartitionBy: []string{"lastname"},
+		Limit:       1,
+		RowsWoLimit: &total,
+	}))
+	s.equal(uint64(5), total)
+
+	s.equal([][]interface{}{{"Connor", 4}}, s.query(s.user, []string{"lastname", "id"}, model.GetAllOptions{
+		OrderBy:     []model.Order{{FieldName: "lastname"}, {FieldName: "id", Desc: true}},
+		PartitionBy: []string{"lastname"},
+		Offset:      1,
+	}))
+}
+
+func (s *storageSuite) TestDistinct() {
+	s.equal([][]interface{}{{"Bond"}, {"Connor"}, {"Ivanov"}, {"Sidorov"}}, s.query(s.user, []string{"lastname"}, model.GetAllOptions{
+		Distinct: true,
+		OrderBy:  []model.Order{{FieldName: "lastname"}},
+	}))
+
+	var total uint64
+	s.equal([][]interface{}{{"Connor"}}, s.query(s.user, []string{"lastname"}, model.GetAllOptions{
+		Distinct:    true,
+		OrderBy:     []model.Order{{FieldName: "lastname"}},
+		Offset:      1,
+		Limit:       1,
+		RowsWoLimit: &total,
+	}))
+	s.equal(uint64(4), total)
+}
+
+func (s *storageSuite) TestRelations() {
+	data, err := s.user.GetAll(context.Background(), []string{"id", "phone.number", "message.text", "address.id"}, model.GetAllOptions{
+		Filter:  in(expr.ModelField(s.user, "id"), 2, 3),
+		OrderBy: []model.Order{{FieldName: "id"}},
+	})
+	s.NoError(err)
+
+	s.equal([]map[string]interface{}{
+		{
+			"id":      2,
+			"message": []map[string]interface{}{{"text": "Message 4"}},
+			"address": []map[string]interface{}{{"id": 200}, {"id": 300}},
+		},
+		{
+			"id":      3,
+			"phone":   map[string]interface{}{"number": 3333333},
+			"address": []map[string]interface{}{{"id": 300}},
+		},
+	}, data.Maps())
+}
+
+func (s *storageSuite) TestJunctionLinks() {
+	junction := s.user.GetRelation("address").JunctionModel
+
+	s.equal([][]interface{}{
+		{1, 100},
+		{1, 200},
+		{2, 200},
+		{2, 300},
+		{3, 300},
+		{4, 400},
+	}, s.query(junction, []string{"fk_user_id", "fk_address_id"}, model.GetAllOptions{
+		OrderBy: []model.Order{{FieldName: "fk_user_id"}, {FieldName: "fk_address_id"}},
+	}))
+
+	s.NoError(s.user.Link(context.Background(), "address", []model.ModelLink{
+		{Pk: []interface{}{1}, Fks: [][]interface{}{{100}, {500}}},
+	}))
+
+	s.equal([]interface{}{1, 2}, s.ids(s.user, expr.Any(s.user, "address", expr.Eq(expr.ModelField(s.address, "city"), expr.Value("Fort Worth")))))
+	s.equal([]interface{}{1}, s.ids(s.user, expr.Any(s.user, "address", expr.Eq(expr.ModelField(s.address, "city"), expr.Value(nil)))))
+}
+
+func (s *storageSuite) TestTransaction() {
+	storage, ok := s.storage.(model.ITransactionalStorage)
+	if !ok {
+		s.T().Skip("The storage does not support transactions")
+	}
+
+	ctx := context.Background()
+	errRollback := errors.New("rollback")
+
+	s.equal(errRollback, storage.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := storage.Add(ctx, s.user, model.NewData([]string{"id", "name", "lastname"}, [][]interface{}{
+			{6, "Kyle", "Reese"},
+		}), model.AddOptions{}); err != nil {
+			return err
+		}
+
+		if err := storage.RunInTransaction(ctx, func(ctx context.Context) error {
+			_, err := storage.Delete(ctx, s.user, expr.Eq(expr.ModelField(s.user, "id"), expr.Value(1)))
+			return err
+		}); err != nil {
+			return err
+		}
+
+		s.equal([]interface{}{2, 3, 4, 5, 6}, s.ids(s.user, nil))
+
+		return errRollback
+	}))
+	s.equal([]interface{}{1, 2, 3, 4, 5}, s.ids(s.user, nil))
+
+	s.NoError(storage.RunInTransaction(ctx, func(ctx context.Context) error {
+		_, err := storage.Edit(ctx, s.user, expr.Eq(expr.ModelField(s.user, "id"), expr.Value(1)), map[string]interface{}{"name": "Ivan2"})
+		return err
+	}))
+	s.equal([]interface{}{1}, s.ids(s.user, expr.Eq(expr.ModelField(s.user, "name"), expr.Value("Ivan2"))))
+}
+
+func (s *storageSuite) TestCountGroups() {
+	storage, ok := s.storage.(model.IAggregateStorage)
+	if !ok {
+		s.T().Skip("The storage does not support aggregates")
+	}
+
+	data, err := storage.CountGroups(context.Background(), s.user, []string{"lastname"}, expr.Gt(expr.ModelField(s.user, "id"), expr.Value(1)))
+	s.Require().NoError(err)
+	s.elementsMatch([][]interface{}{
+		{"Bond", uint64(1)},
+		{"Connor", uint64(2)},
+		{"Ivanov", uint64(1)},
+	}, data.GetFieldsData([]string{"lastname", model.AGGREGATE_COUNT}).Data())
+
+	data, err = storage.CountGroups(context.Background(), s.user, nil, nil)
+	s.Require().NoError(err)
+	s.equal([][]interface{}{{uint64(5)}}, data.GetFieldsData([]string{model.AGGREGATE_COUNT}).Data())
+}
@@ -17,3 +17,64 @@ func SetDerivableFieldsData(ctx context.Context, key string, data interface{}) {
 func GetDerivableFieldsData(ctx context.Context, key string) interface{} {
 	return ctx.Value(derivableFieldsCtx).(map[string]interface{})[key]
 }
+
+var batcherCtx modelCtxType = 1
+
+var withDeletedCtx modelCtxType = 2
+
+// WithDeleted returns the context in which the soft-deleted rows are not excluded from the queries
+func WithDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withDeletedCtx, true)
+}
+
+var hardDeleteCtx modelCtxType = 3
+
+func isHardDelete(ctx context.Context) bool {
+	hardDelete, _ := ctx.Value(hardDeleteCtx).(bool)
+	return hardDelete
+}
+
+func isWithDeleted(ctx context.Context) bool {
+	withDeleted, _ := ctx.Value(withDeletedCtx).(bool)
+	return withDeleted
+}
+
+var logFilterValuesCtx modelCtxType = 4
+
+// WithFilterValuesLogging returns the context in which the values of the filters are written to timelog messages and errors.
+// The values are replaced with '?' by default, because they can contain private data.
+func WithFilterValuesLogging(ctx context.Context) context.Context {
+	return context.WithValue(ctx, logFilterValuesCtx, true)
+}
+
+func isLogFilterValues(ctx context.Context) bool {
+	logValues, _ := ctx.Value(logFilterValuesCtx).(bool)
+	return logValues
+}
+
+var integrityCtx modelCtxType = 5
+
+// withIntegrity returns the context of the relations OnDelete actions, the linked rows hidden by DefaultFilter
+// and by soft delete are processed too and the cascade deletes are hard ones
+func withIntegrity(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, integrityCtx, true)
+	return context.WithValue(WithDeleted(ctx), hardDeleteCtx, true)
+}
+
+func isIntegrity(ctx context.Context) bool {
+	integrity, _ := ctx.Value(integrityCtx).(bool)
+	return integrity
+}
+
+var transactionCtx modelCtxType = 6
+
+// WithTransaction returns the context of the transaction, the queries in it are not batched.
+// The transactional storages should pass such a context to the function run in the transaction.
+func WithTransaction(ctx context.Context) context.Context {
+	return context.WithValue(ctx, transactionCtx, true)
+}
+
+func isTransaction(ctx context.Context) bool {
+	inTransaction, _ := ctx.Value(transactionCtx).(bool)
+	return inTransaction
+}
@@ -0,0 +1,130 @@
+package model
+
+import (
+	"context"
+
+	"github.com/go-qbit/qerror"
+	"github.com/go-qbit/rbac"
+	"github.com/go-qbit/timelog"
+)
+
+// EditMulti changes the rows with the primary keys from the data to the values of the other data fields.
+// The rows missed in the storage or not matched the default filter are skipped.
+func (m *BaseModel) EditMulti(ctx context.Context, data *Data) error {
+	logMessage := newFilterLogMessage(ctx, m.GetId()+": EditMulti")
+	ctx = timelog.Start(ctx, logMessage)
+	defer timelog.Finish(ctx)
+
+	if m.editPermission != nil && !rbac.HasPermission(ctx, m.editPermission) {
+		return EditErrorf("You don't have permission")
+	}
+
+	if len(m.pkFieldsNames) == 0 {
+		return EditErrorf("Model '%s' has no primary key", m.id)
+	}
+
+	pkFields := make(map[string]struct{}, len(m.pkFieldsNames))
+	for _, name := range m.pkFieldsNames {
+		if data.FieldNum(name) == -1 {
+			return FieldErrorf(name, "Missed primary key field '%s' in model '%s'", name, m.id)
+		}
+		pkFields[name] = struct{}{}
+	}
+
+	var valuesNames []string
+	for _, name := range data.Fields() {
+		if _, exists := pkFields[name]; exists {
+			continue
+		}
+
+		field := m.GetFieldDefinition(name)
+		if field == nil || field.IsDerivable() {
+			return qerror.Errorf("Unknown field '%s' in model '%s'", name, m.id)
+		}
+
+		if m.versioned && name == VERSION_FIELD {
+			return m.versionFieldError()
+		}
+
+		if perm := field.GetEditPermission(); perm != nil && !rbac.HasPermission(ctx, perm) {
+			return qerror.Errorf("Need permission '%s' to edit field '%s' in model '%s'",
+				perm.GetGroupId()+"."+perm.GetId(), name, m.id)
+		}
+
+		valuesNames = append(valuesNames, name)
+	}
+
+	if data.Len() == 0 || len(valuesNames) == 0 {
+		return nil
+	}
+
+	for _, row := range data.GetFieldsData(m.pkFieldsNames).Data() {
+		for i, value := range row {
+			if isNilValue(value) {
+				return FieldErrorf(m.pkFieldsNames[i], "Missed primary key field '%s' value in model '%s'", m.pkFieldsNames[i], m.id)
+			}
+		}
+	}
+
+	filter, err := m.withDefaultFilter(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := validate(ctx, m, filter); err != nil {
+		return err
+	}
+	logMessage.filter = filter
+
+	references := m.requiredReferences(valuesNames)
+	for _, relation := range references {
+		for _, row := range data.GetFieldsData(relation.LocalFieldsNames).Data() {
+			for i, value := range row {
+				if isNilValue(value) {
+					fieldName := relation.LocalFieldsNames[i]
+					return FieldErrorf(fieldName, "Missed required field '%s' value in model '%s'", fieldName, m.id)
+				}
+			}
+		}
+	}
+
+	return m.inTransaction(ctx, func(ctx context.Context) error {
+		if err := m.checkReferences(ctx, references, data); err != nil {
+			return err
+		}
+
+		if m.versioned {
+			var err error
+			if data, err = m.withNextVersions(ctx, data, filter); err != nil {
+				return err
+			}
+			valuesNames = append(valuesNames, VERSION_FIELD)
+		}
+
+		return m.storageEditMulti(ctx, data, valuesNames, filter)
+	})
+}
+
+// storageEditMulti changes the rows in the storage, the rows are changed one by one
+// if the storage does not support IBatchEditStorage
+func (m *BaseModel) storageEditMulti(ctx context.Context, data *Data, valuesNames []string, filter IExpression) error {
+	if storage, ok := m.storage.(IBatchEditStorage); ok {
+		_, err := storage.EditMulti(ctx, m, data, filter)
+		return err
+	}
+
+	keys := data.GetFieldsData(m.pkFieldsNames).Data()
+	for i, row := range data.GetFieldsData(valuesNames).Data() {
+		newValues := make(map[string]interface{}, len(valuesNames))
+		for j, name := range valuesNames {
+			newValues[name] = row[j]
+		}
+
+		keyFilter := andFilter(keysFilter(m, m.pkFieldsNames, keys[i:i+1]), filter)
+		if _, err := m.storage.Edit(ctx, m, keyFilter, newValues); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/go-qbit/qerror"
@@ -45,6 +46,76 @@ func (e *DeleteError) Error() string {
 	return e.Message + "\n" + e.BaseError.Error()
 }
 
+// ConflictError is returned by EditWithVersion if the row was changed or deleted after it was read
+type ConflictError struct {
+	*qerror.BaseError
+	Message string
+}
+
+func ConflictErrorf(message string, a ...interface{}) *ConflictError {
+	return &ConflictError{qerror.New(1), fmt.Sprintf(message, a...)}
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message + "\n" + e.BaseError.Error()
+}
+
+// UniqueViolationError is returned if the rows have the same values of the unique key fields
+type UniqueViolationError struct {
+	*qerror.BaseError
+	Fields  []string
+	Message string
+}
+
+func UniqueViolationErrorf(fields []string, message string, a ...interface{}) *UniqueViolationError {
+	return &UniqueViolationError{qerror.New(1), fields, fmt.Sprintf(message, a...)}
+}
+
+func (e *UniqueViolationError) Error() string {
+	return e.Message + "\n" + e.BaseError.Error()
+}
+
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrMultipleRows = errors.New("multiple rows")
+)
+
+// NotFoundError is returned by GetOne and GetByPK if there is no row, errors.Is(err, ErrNotFound) is true for it
+type NotFoundError struct {
+	*qerror.BaseError
+	Message string
+}
+
+func NotFoundErrorf(message string, a ...interface{}) *NotFoundError {
+	return &NotFoundError{qerror.New(1), fmt.Sprintf(message, a...)}
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Message + "\n" + e.BaseError.Error()
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// MultipleRowsError is returned by GetOne if there are several rows, errors.Is(err, ErrMultipleRows) is true for it
+type MultipleRowsError struct {
+	*qerror.BaseError
+	Message string
+}
+
+func MultipleRowsErrorf(message string, a ...interface{}) *MultipleRowsError {
+	return &MultipleRowsError{qerror.New(1), fmt.Sprintf(message, a...)}
+}
+
+func (e *MultipleRowsError) Error() string {
+	return e.Message + "\n" + e.BaseError.Error()
+}
+
+func (e *MultipleRowsError) Is(target error) bool {
+	return target == ErrMultipleRows
+}
+
 type FieldError struct {
 	*qerror.BaseError
 	Field   string
@@ -58,3 +129,16 @@ func FieldErrorf(field, message string, a ...interface{}) *FieldError {
 func (e *FieldError) Error() string {
 	return e.Message + "\n" + e.BaseError.Error()
 }
+
+type FilterError struct {
+	*qerror.BaseError
+	Message string
+}
+
+func FilterErrorf(message string, a ...interface{}) *FilterError {
+	return &FilterError{qerror.New(1), fmt.Sprintf(message, a...)}
+}
+
+func (e *FilterError) Error() string {
+	return e.Message + "\n" + e.BaseError.Error()
+}
@@ -106,17 +106,17 @@ func (e *or) GetProcessor(processor model.IExpressionProcessor) interface{} {
 
 // Any
 type any struct {
-	localModel model.IModel
-	extModel   model.IModel
-	filter     model.IExpression
+	localModel   model.IModel
+	relationName string
+	filter       model.IExpression
 }
 
-func Any(localModel, extModel model.IModel, filter model.IExpression) *any {
-	return &any{localModel, extModel, filter}
+func Any(localModel model.IModel, relationName string, filter model.IExpression) *any {
+	return &any{localModel, relationName, filter}
 }
 
 func (e *any) GetProcessor(processor model.IExpressionProcessor) interface{} {
-	return processor.Any(e.localModel, e.extModel, e.filter)
+	return processor.Any(e.localModel, e.relationName, e.filter)
 }
 
 // Model field
@@ -150,3 +150,13 @@ func Func(name string, params ...model.IExpression) *function { return &function
 func (e *function) GetProcessor(processor model.IExpressionProcessor) interface{} {
 	return processor.Func(e.name, e.params...)
 }
+
+// Excluded is the value of the field of the added row in model.OnConflict updates
+type excluded struct {
+	field string
+}
+
+func Excluded(field string) *excluded { return &excluded{field} }
+func (e *excluded) GetProcessor(processor model.IExpressionProcessor) interface{} {
+	return processor.Excluded(e.field)
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"context"
 	"reflect"
+	"time"
 
 	"github.com/go-qbit/rbac"
 )
@@ -32,6 +33,7 @@ type IFieldsDefinitions interface {
 var (
 	_ IFieldDefinition = &IntField{}
 	_ IFieldDefinition = &StringField{}
+	_ IFieldDefinition = &TimeField{}
 	_ IFieldDefinition = &DerivableField{}
 )
 
@@ -88,7 +90,7 @@ type StringField struct {
 
 func (f *StringField) GetId() string                       { return f.Id }
 func (f *StringField) GetCaption() string                  { return f.Caption }
-func (f *StringField) GetType() reflect.Type               { return reflect.TypeOf(0) }
+func (f *StringField) GetType() reflect.Type               { return reflect.TypeOf("") }
 func (f *StringField) GetStorageType() string              { return "string" }
 func (f *StringField) IsRequired() bool                    { return f.Required }
 func (f *StringField) GetViewPermission() *rbac.Permission { return f.ViewPermission }
@@ -116,6 +118,46 @@ func (f *StringField) CloneForFK(id string, caption string, required bool) IFiel
 	return &StringField{id, caption, required, f.ViewPermission, f.EditPermission, f.CheckFunc, f.CleanFunc}
 }
 
+type TimeField struct {
+	Id             string
+	Caption        string
+	Required       bool
+	ViewPermission *rbac.Permission
+	EditPermission *rbac.Permission
+	CheckFunc      func(interface{}) error
+	CleanFunc      func(interface{}) (interface{}, error)
+}
+
+func (f *TimeField) GetId() string                       { return f.Id }
+func (f *TimeField) GetCaption() string                  { return f.Caption }
+func (f *TimeField) GetType() reflect.Type               { return reflect.TypeOf(time.Time{}) }
+func (f *TimeField) GetStorageType() string              { return "time" }
+func (f *TimeField) IsRequired() bool                    { return f.Required }
+func (f *TimeField) GetViewPermission() *rbac.Permission { return f.ViewPermission }
+func (f *TimeField) GetEditPermission() *rbac.Permission { return f.EditPermission }
+func (f *TimeField) IsDerivable() bool                   { return false }
+func (f *TimeField) GetDependsOn() []string              { return nil }
+func (f *TimeField) Calc(context.Context, map[string]interface{}) (interface{}, error) {
+	return nil, nil
+}
+func (f *TimeField) Check(_ context.Context, v interface{}) error {
+	if f.CheckFunc != nil {
+		return f.CheckFunc(v)
+	} else {
+		return nil
+	}
+}
+func (f *TimeField) Clean(_ context.Context, v interface{}) (interface{}, error) {
+	if f.CleanFunc != nil {
+		return f.CleanFunc(v)
+	} else {
+		return v, nil
+	}
+}
+func (f *TimeField) CloneForFK(id string, caption string, required bool) IFieldDefinition {
+	return &TimeField{id, caption, required, f.ViewPermission, f.EditPermission, f.CheckFunc, f.CleanFunc}
+}
+
 type DerivableField struct {
 	Id             string
 	Caption        string
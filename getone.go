@@ -0,0 +1,116 @@
+package model
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/go-qbit/qerror"
+	"github.com/go-qbit/timelog"
+)
+
+// GetOne returns the single row matched the filter, NotFoundError is returned if there is no such row
+// and MultipleRowsError if there are several ones
+func (m *BaseModel) GetOne(ctx context.Context, fieldsNames []string, filter IExpression) (map[string]interface{}, error) {
+	ctx = timelog.Start(ctx, m.GetId()+": GetOne")
+	defer timelog.Finish(ctx)
+
+	data, err := m.getOne(ctx, fieldsNames, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.Maps()[0], nil
+}
+
+// GetByPK returns the row with the primary key values, NotFoundError is returned if there is no such row
+func (m *BaseModel) GetByPK(ctx context.Context, fieldsNames []string, pk ...interface{}) (map[string]interface{}, error) {
+	ctx = timelog.Start(ctx, m.GetId()+": GetByPK")
+	defer timelog.Finish(ctx)
+
+	filter, err := m.pkFilter(pk)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := m.getOne(ctx, fieldsNames, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.Maps()[0], nil
+}
+
+// GetOneToStruct sets the single row matched the filter to the structure like GetAllToStruct
+func (m *BaseModel) GetOneToStruct(ctx context.Context, data interface{}, filter IExpression) error {
+	ctx = timelog.Start(ctx, m.GetId()+": GetOneToStruct")
+	defer timelog.Finish(ctx)
+
+	return m.getOneToStruct(ctx, data, filter)
+}
+
+// GetByPKToStruct sets the row with the primary key values to the structure like GetAllToStruct
+func (m *BaseModel) GetByPKToStruct(ctx context.Context, data interface{}, pk ...interface{}) error {
+	ctx = timelog.Start(ctx, m.GetId()+": GetByPKToStruct")
+	defer timelog.Finish(ctx)
+
+	filter, err := m.pkFilter(pk)
+	if err != nil {
+		return err
+	}
+
+	return m.getOneToStruct(ctx, data, filter)
+}
+
+func (m *BaseModel) getOne(ctx context.Context, fieldsNames []string, filter IExpression) (*Data, error) {
+	data, err := m.GetAll(ctx, fieldsNames, GetAllOptions{Filter: filter, Limit: 2})
+	if err != nil {
+		return nil, err
+	}
+
+	switch data.Len() {
+	case 0:
+		return nil, NotFoundErrorf("There is no row of model '%s'", m.GetId())
+	case 1:
+		return data, nil
+	default:
+		return nil, MultipleRowsErrorf("There are several rows of model '%s'", m.GetId())
+	}
+}
+
+func (m *BaseModel) getOneToStruct(ctx context.Context, data interface{}, filter IExpression) error {
+	rt := reflect.TypeOf(data)
+	if rt == nil || rt.Kind() != reflect.Ptr || rt.Elem().Kind() != reflect.Struct {
+		return qerror.Errorf("Invalid type '%v', must be pointer to struct", rt)
+	}
+
+	fields, err := m.getFieldsFromStruct(rt.Elem())
+	if err != nil {
+		return err
+	}
+
+	row, err := m.getOne(ctx, fields, filter)
+	if err != nil {
+		return err
+	}
+
+	return m.mapToVar(row.Maps()[0], reflect.ValueOf(data).Elem())
+}
+
+// pkFilter returns the filter of the row with the primary key values
+func (m *BaseModel) pkFilter(pk []interface{}) (IExpression, error) {
+	if len(m.pkFieldsNames) == 0 {
+		return nil, qerror.Errorf("Model '%s' has no primary key", m.GetId())
+	}
+
+	if len(pk) != len(m.pkFieldsNames) {
+		return nil, qerror.Errorf("Invalid primary key %v of model '%s', must have %d values", pk, m.GetId(), len(m.pkFieldsNames))
+	}
+
+	for i, value := range pk {
+		if isNilValue(value) {
+			return nil, FieldErrorf(m.pkFieldsNames[i], "Missed primary key field '%s' value in model '%s'", m.pkFieldsNames[i], m.GetId())
+		}
+	}
+
+	return keysFilter(m, m.pkFieldsNames, [][]interface{}{pk}), nil
+}
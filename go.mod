@@ -1,11 +1,17 @@
 module github.com/go-qbit/model
 
-go 1.16
+go 1.18
 
 require (
 	github.com/go-qbit/qerror v1.2.3
 	github.com/go-qbit/rbac v0.0.0-20200326053441-69d621298d66
 	github.com/go-qbit/timelog v0.0.0-20200505103456-44613501a8f1
-	github.com/opentracing/opentracing-go v1.2.0 // indirect
 	github.com/stretchr/testify v1.7.0
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/opentracing/opentracing-go v1.2.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
+)
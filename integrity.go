@@ -0,0 +1,217 @@
+package model
+
+import (
+	"context"
+)
+
+// inTransaction runs f in a transaction if the storage supports them, otherwise f is just called
+func (m *BaseModel) inTransaction(ctx context.Context, f func(context.Context) error) error {
+	if storage, ok := m.storage.(ITransactionalStorage); ok {
+		return storage.RunInTransaction(ctx, func(ctx context.Context) error {
+			return f(WithTransaction(ctx))
+		})
+	}
+
+	return f(ctx)
+}
+
+// relations returns the pointers to the model relations
+func (m *BaseModel) relations() []*Relation {
+	relations := m.GetRelations()
+
+	res := make([]*Relation, len(relations))
+	for i := range relations {
+		res[i] = &relations[i]
+	}
+
+	return res
+}
+
+// requiredReferences returns the required relations which FK fields are all in the given fields
+func (m *BaseModel) requiredReferences(fieldsNames []string) []*Relation {
+	fields := make(map[string]struct{}, len(fieldsNames))
+	for _, fieldName := range fieldsNames {
+		fields[fieldName] = struct{}{}
+	}
+
+	var res []*Relation
+	for _, relation := range m.relations() {
+		if !relation.IsRequired || relation.IsBack || linkStorage(m, relation) != linkLocalFk {
+			continue
+		}
+
+		found := true
+		for _, fieldName := range relation.LocalFieldsNames {
+			if _, exists := fields[fieldName]; !exists {
+				found = false
+				break
+			}
+		}
+
+		if found {
+			res = append(res, relation)
+		}
+	}
+
+	return res
+}
+
+// checkReferences checks the external rows referenced by the FK values exist
+func (m *BaseModel) checkReferences(ctx context.Context, relations []*Relation, data *Data) error {
+	for _, relation := range relations {
+		keys := distinctKeys(data.GetFieldsData(relation.LocalFieldsNames).Data())
+		if len(keys) == 0 {
+			continue
+		}
+
+		extModel := relation.ExtModel
+		extData, err := extModel.GetAll(ctx, relation.FkFieldsNames, GetAllOptions{
+			Filter: keysFilter(extModel, relation.FkFieldsNames, keys),
+		})
+		if err != nil {
+			return err
+		}
+
+		existing := make(map[string]struct{}, extData.Len())
+		for _, row := range extData.GetFieldsData(relation.FkFieldsNames).Data() {
+			existing[linkKey(row)] = struct{}{}
+		}
+
+		for _, key := range keys {
+			if _, exists := existing[linkKey(key)]; !exists {
+				return FieldErrorf(relation.LocalFieldsNames[0], "There is no row with key '%s' in model '%s' referenced by model '%s'",
+					linkKey(key), extModel.GetId(), m.GetId())
+			}
+		}
+	}
+
+	return nil
+}
+
+// onDeleteRelations returns the relations which rows must be processed on deleting the model rows
+func (m *BaseModel) onDeleteRelations() []*Relation {
+	var res []*Relation
+	for _, relation := range m.relations() {
+		switch linkStorage(m, relation) {
+		case linkJunction:
+			res = append(res, relation)
+		case linkExtFk, linkSharedPk:
+			if relation.OnDelete != ON_DELETE_NO_ACTION {
+				res = append(res, relation)
+			}
+		}
+	}
+
+	return res
+}
+
+// deleteLinked applies the relations OnDelete actions to the rows linked with the rows matched the filter.
+// All the linked rows are processed including the ones hidden by DefaultFilter and soft delete to leave no orphans.
+func (m *BaseModel) deleteLinked(ctx context.Context, relations []*Relation, filter IExpression) error {
+	var fieldsNames []string
+	fields := make(map[string]struct{})
+	for _, relation := range relations {
+		for _, fieldName := range relation.LocalFieldsNames {
+			if _, exists := fields[fieldName]; !exists {
+				fields[fieldName] = struct{}{}
+				fieldsNames = append(fieldsNames, fieldName)
+			}
+		}
+	}
+
+	data, err := m.storage.Query(ctx, m, fieldsNames, GetAllOptions{Filter: filter, ForUpdate: true})
+	if err != nil {
+		return err
+	}
+
+	relationsKeys := make([][][]interface{}, len(relations))
+	for i, relation := range relations {
+		relationsKeys[i] = distinctKeys(data.GetFieldsData(relation.LocalFieldsNames).Data())
+	}
+
+	extCtx := withIntegrity(ctx)
+
+	// Check all the restrictions before changing anything
+	for i, relation := range relations {
+		if relation.OnDelete != ON_DELETE_RESTRICT || len(relationsKeys[i]) == 0 {
+			continue
+		}
+
+		linkedModel, linkedFields := relation.ExtModel, relation.FkFieldsNames
+		if relation.JunctionModel != nil {
+			linkedModel, linkedFields = relation.JunctionModel, relation.JunctionLocalFieldsNames
+		}
+
+		linked, err := linkedModel.GetAll(extCtx, linkedFields, GetAllOptions{
+			Filter: keysFilter(linkedModel, linkedFields, relationsKeys[i]),
+			Limit:  1,
+		})
+		if err != nil {
+			return err
+		}
+
+		if linked.Len() > 0 {
+			return DeleteErrorf("Cannot delete rows of model '%s', there are linked rows of model '%s'",
+				m.GetId(), relation.ExtModel.GetId())
+		}
+	}
+
+	for i, relation := range relations {
+		keys := relationsKeys[i]
+		if len(keys) == 0 || relation.OnDelete == ON_DELETE_RESTRICT {
+			continue
+		}
+
+		extModel := relation.ExtModel
+
+		switch {
+		case relation.JunctionModel != nil:
+			junction := relation.JunctionModel
+			if err := junction.Delete(extCtx, keysFilter(junction, relation.JunctionLocalFieldsNames, keys)); err != nil {
+				return err
+			}
+
+		case relation.OnDelete == ON_DELETE_CASCADE:
+			if err := extModel.Delete(extCtx, keysFilter(extModel, relation.FkFieldsNames, keys)); err != nil {
+				return err
+			}
+
+		case relation.OnDelete == ON_DELETE_SET_NULL:
+			newValues := make(map[string]interface{}, len(relation.FkFieldsNames))
+			for _, fieldName := range relation.FkFieldsNames {
+				newValues[fieldName] = nil
+			}
+
+			if err := extModel.Edit(extCtx, keysFilter(extModel, relation.FkFieldsNames, keys), newValues); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// distinctKeys returns the rows without duplicates and rows with NULL values
+func distinctKeys(rows [][]interface{}) [][]interface{} {
+	var res [][]interface{}
+
+	keys := make(map[string]struct{}, len(rows))
+rows:
+	for _, row := range rows {
+		for _, value := range row {
+			if isNilValue(value) {
+				continue rows
+			}
+		}
+
+		key := linkKey(row)
+		if _, exists := keys[key]; exists {
+			continue
+		}
+		keys[key] = struct{}{}
+
+		res = append(res, row)
+	}
+
+	return res
+}
@@ -0,0 +1,482 @@
+package model
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-qbit/qerror"
+	"github.com/go-qbit/timelog"
+)
+
+// ModelLink links the row of the local model with the rows of the external model.
+// Pk contains the values of the local model primary key, Fks contains the values of the external model primary keys.
+type ModelLink struct {
+	Pk  []interface{}
+	Fks [][]interface{}
+}
+
+// JunctionLink links two rows of many-to-many relation, Values are set to the other fields of the junction model
+type JunctionLink struct {
+	Pk     []interface{}
+	Fk     []interface{}
+	Values map[string]interface{}
+}
+
+// How the link between two rows is stored
+const (
+	linkJunction = iota // Rows of the junction model
+	linkLocalFk         // FK fields of the local model
+	linkExtFk           // FK fields of the external model
+	linkSharedPk        // Both models have the same primary key
+)
+
+// Link adds the links between the rows, existing links are kept.
+// For the relations which allow only one external row (many-to-one, one-to-one) the link is replaced.
+func (m *BaseModel) Link(ctx context.Context, relationName string, links []ModelLink) error {
+	ctx = timelog.Start(ctx, m.GetId()+": Link to "+relationName)
+	defer timelog.Finish(ctx)
+
+	relation, err := m.linkRelation(relationName, links)
+	if err != nil {
+		return err
+	}
+
+	return m.inTransaction(ctx, func(ctx context.Context) error {
+		return m.link(ctx, relation, links)
+	})
+}
+
+// LinkWithValues adds the links of many-to-many relation with the values of the junction model fields,
+// the existing links are replaced
+func (m *BaseModel) LinkWithValues(ctx context.Context, relationName string, links []JunctionLink) error {
+	ctx = timelog.Start(ctx, m.GetId()+": LinkWithValues to "+relationName)
+	defer timelog.Finish(ctx)
+
+	modelLinks := make([]ModelLink, len(links))
+	for i, link := range links {
+		modelLinks[i] = ModelLink{Pk: link.Pk, Fks: [][]interface{}{link.Fk}}
+	}
+
+	relation, err := m.linkRelation(relationName, modelLinks)
+	if err != nil {
+		return err
+	}
+
+	if relation.JunctionModel == nil {
+		return qerror.Errorf("The relation '%s' of model '%s' has no junction model", relationName, m.GetId())
+	}
+
+	fieldsNames := append(append([]string{}, relation.JunctionLocalFieldsNames...), relation.JunctionFkFieldsNames...)
+	valuesFields := make(map[string]int)
+	for _, link := range links {
+		for name := range link.Values {
+			if _, exists := valuesFields[name]; !exists {
+				valuesFields[name] = len(fieldsNames)
+				fieldsNames = append(fieldsNames, name)
+			}
+		}
+	}
+
+	data := NewEmptyData(fieldsNames)
+	for _, link := range links {
+		row := make([]interface{}, len(fieldsNames))
+		copy(row, link.Pk)
+		copy(row[len(link.Pk):], link.Fk)
+		for name, value := range link.Values {
+			row[valuesFields[name]] = value
+		}
+
+		if err := data.Add(row); err != nil {
+			return err
+		}
+	}
+
+	if data.Len() == 0 {
+		return nil
+	}
+
+	_, err = relation.JunctionModel.AddMulti(ctx, data, AddOptions{Replace: true})
+
+	return err
+}
+
+// Unlink removes the links between the rows. The links which don't exist are ignored.
+func (m *BaseModel) Unlink(ctx context.Context, relationName string, links []ModelLink) error {
+	ctx = timelog.Start(ctx, m.GetId()+": Unlink from "+relationName)
+	defer timelog.Finish(ctx)
+
+	relation, err := m.linkRelation(relationName, links)
+	if err != nil {
+		return err
+	}
+
+	return m.inTransaction(ctx, func(ctx context.Context) error {
+		return m.unlink(ctx, relation, links)
+	})
+}
+
+// SetLinks replaces all the links of the local rows with the given ones, empty Fks removes all the links of the row
+func (m *BaseModel) SetLinks(ctx context.Context, relationName string, links []ModelLink) error {
+	ctx = timelog.Start(ctx, m.GetId()+": SetLinks to "+relationName)
+	defer timelog.Finish(ctx)
+
+	relation, err := m.linkRelation(relationName, links)
+	if err != nil {
+		return err
+	}
+
+	return m.inTransaction(ctx, func(ctx context.Context) error {
+		pks := make([][]interface{}, len(links))
+		for i, link := range links {
+			pks[i] = link.Pk
+		}
+
+		current, err := m.getLinks(ctx, relation, pks)
+		if err != nil {
+			return err
+		}
+
+		var toUnlink, toLink []ModelLink
+		for _, link := range links {
+			newFks := make(map[string]struct{}, len(link.Fks))
+			for _, fk := range link.Fks {
+				newFks[linkKey(fk)] = struct{}{}
+			}
+
+			oldFks := make(map[string]struct{})
+			unlink := ModelLink{Pk: link.Pk}
+			for _, fk := range current[linkKey(link.Pk)] {
+				oldFks[linkKey(fk)] = struct{}{}
+				if _, exists := newFks[linkKey(fk)]; !exists {
+					unlink.Fks = append(unlink.Fks, fk)
+				}
+			}
+
+			newLink := ModelLink{Pk: link.Pk}
+			for _, fk := range link.Fks {
+				if _, exists := oldFks[linkKey(fk)]; !exists {
+					newLink.Fks = append(newLink.Fks, fk)
+				}
+			}
+
+			// The local FK is overwritten by the new link, so there is no need to clear it first
+			if len(unlink.Fks) > 0 && !(linkStorage(m, relation) == linkLocalFk && len(newLink.Fks) > 0) {
+				toUnlink = append(toUnlink, unlink)
+			}
+			if len(newLink.Fks) > 0 {
+				toLink = append(toLink, newLink)
+			}
+		}
+
+		if len(toUnlink) > 0 {
+			if err := m.unlink(ctx, relation, toUnlink); err != nil {
+				return err
+			}
+		}
+
+		if len(toLink) > 0 {
+			if err := m.link(ctx, relation, toLink); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (m *BaseModel) linkRelation(relationName string, links []ModelLink) (*Relation, error) {
+	relation := m.GetRelation(relationName)
+	if relation == nil {
+		return nil, qerror.Errorf("No relation '%s' found in model '%s'", relationName, m.GetId())
+	}
+	extModel := relation.ExtModel
+
+	single := relation.RelationType == RELATION_MANY_TO_ONE || relation.RelationType == RELATION_ONE_TO_ONE
+	for _, link := range links {
+		if len(link.Pk) != len(m.GetPKFieldsNames()) {
+			return nil, qerror.Errorf("Invalid link: %d primary key values for model '%s', expected %d",
+				len(link.Pk), m.GetId(), len(m.GetPKFieldsNames()))
+		}
+
+		if single && len(link.Fks) > 1 {
+			return nil, qerror.Errorf("Invalid link: row of model '%s' can be linked with one row of model '%s' only",
+				m.GetId(), extModel.GetId())
+		}
+
+		for _, fk := range link.Fks {
+			if len(fk) != len(relation.FkFieldsNames) {
+				return nil, qerror.Errorf("Invalid link: %d primary key values for model '%s', expected %d",
+					len(fk), extModel.GetId(), len(relation.FkFieldsNames))
+			}
+		}
+	}
+
+	return relation, nil
+}
+
+func (m *BaseModel) link(ctx context.Context, relation *Relation, links []ModelLink) error {
+	switch linkStorage(m, relation) {
+	case linkJunction:
+		data := NewEmptyData(append(append([]string{}, relation.JunctionLocalFieldsNames...), relation.JunctionFkFieldsNames...))
+		for _, link := range links {
+			for _, fk := range link.Fks {
+				if err := data.Add(append(append([]interface{}{}, link.Pk...), fk...)); err != nil {
+					return err
+				}
+			}
+		}
+
+		if data.Len() == 0 {
+			return nil
+		}
+
+		_, err := relation.JunctionModel.AddMulti(ctx, data, AddOptions{Replace: true})
+
+		return err
+
+	case linkLocalFk:
+		for _, link := range links {
+			if len(link.Fks) == 0 {
+				continue
+			}
+
+			newValues := make(map[string]interface{}, len(relation.LocalFieldsNames))
+			for i, fieldName := range relation.LocalFieldsNames {
+				newValues[fieldName] = link.Fks[0][i]
+			}
+
+			if err := m.Edit(ctx, keysFilter(m, m.GetPKFieldsNames(), [][]interface{}{link.Pk}), newValues); err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	case linkExtFk:
+		for _, link := range links {
+			if len(link.Fks) == 0 {
+				continue
+			}
+
+			newValues := make(map[string]interface{}, len(relation.FkFieldsNames))
+			for i, fieldName := range relation.FkFieldsNames {
+				newValues[fieldName] = link.Pk[i]
+			}
+
+			extModel := relation.ExtModel
+			if err := extModel.Edit(ctx, keysFilter(extModel, extModel.GetPKFieldsNames(), link.Fks), newValues); err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	default:
+		for _, link := range links {
+			for _, fk := range link.Fks {
+				if linkKey(fk) != linkKey(link.Pk) {
+					return qerror.Errorf("Rows of models '%s' and '%s' are linked by the primary key and cannot be relinked",
+						m.GetId(), relation.ExtModel.GetId())
+				}
+			}
+		}
+
+		return nil
+	}
+}
+
+func (m *BaseModel) unlink(ctx context.Context, relation *Relation, links []ModelLink) error {
+	storage := linkStorage(m, relation)
+
+	if (storage == linkLocalFk || storage == linkExtFk) && relationFksRequired(m, relation, storage) {
+		return qerror.Errorf("The relation between '%s' and '%s' is required and cannot be unlinked",
+			m.GetId(), relation.ExtModel.GetId())
+	}
+
+	switch storage {
+	case linkJunction:
+		var keys [][]interface{}
+		for _, link := range links {
+			for _, fk := range link.Fks {
+				keys = append(keys, append(append([]interface{}{}, link.Pk...), fk...))
+			}
+		}
+
+		if len(keys) == 0 {
+			return nil
+		}
+
+		junction := relation.JunctionModel
+		fieldsNames := append(append([]string{}, relation.JunctionLocalFieldsNames...), relation.JunctionFkFieldsNames...)
+
+		return junction.Delete(ctx, keysFilter(junction, fieldsNames, keys))
+
+	case linkLocalFk:
+		fieldsNames := append(append([]string{}, m.GetPKFieldsNames()...), relation.LocalFieldsNames...)
+		newValues := make(map[string]interface{}, len(relation.LocalFieldsNames))
+		for _, fieldName := range relation.LocalFieldsNames {
+			newValues[fieldName] = nil
+		}
+
+		var keys [][]interface{}
+		for _, link := range links {
+			for _, fk := range link.Fks {
+				keys = append(keys, append(append([]interface{}{}, link.Pk...), fk...))
+			}
+		}
+
+		if len(keys) == 0 {
+			return nil
+		}
+
+		return m.Edit(ctx, keysFilter(m, fieldsNames, keys), newValues)
+
+	case linkExtFk:
+		extModel := relation.ExtModel
+		fieldsNames := append(append([]string{}, extModel.GetPKFieldsNames()...), relation.FkFieldsNames...)
+		newValues := make(map[string]interface{}, len(relation.FkFieldsNames))
+		for _, fieldName := range relation.FkFieldsNames {
+			newValues[fieldName] = nil
+		}
+
+		var keys [][]interface{}
+		for _, link := range links {
+			for _, fk := range link.Fks {
+				keys = append(keys, append(append([]interface{}{}, fk...), link.Pk...))
+			}
+		}
+
+		if len(keys) == 0 {
+			return nil
+		}
+
+		return extModel.Edit(ctx, keysFilter(extModel, fieldsNames, keys), newValues)
+
+	default:
+		return qerror.Errorf("Rows of models '%s' and '%s' are linked by the primary key and cannot be unlinked, delete the row instead",
+			m.GetId(), relation.ExtModel.GetId())
+	}
+}
+
+// getLinks returns the primary keys of the external rows linked with the given local rows
+func (m *BaseModel) getLinks(ctx context.Context, relation *Relation, pks [][]interface{}) (map[string][][]interface{}, error) {
+	res := make(map[string][][]interface{}, len(pks))
+	if len(pks) == 0 {
+		return res, nil
+	}
+
+	var (
+		queryModel            IModel
+		localFields, fkFields []string
+	)
+
+	switch linkStorage(m, relation) {
+	case linkJunction:
+		queryModel = relation.JunctionModel
+		localFields, fkFields = relation.JunctionLocalFieldsNames, relation.JunctionFkFieldsNames
+	case linkLocalFk:
+		queryModel = m
+		localFields, fkFields = m.GetPKFieldsNames(), relation.LocalFieldsNames
+	case linkExtFk:
+		queryModel = relation.ExtModel
+		localFields, fkFields = relation.FkFieldsNames, relation.ExtModel.GetPKFieldsNames()
+	default:
+		for _, pk := range pks {
+			res[linkKey(pk)] = [][]interface{}{pk}
+		}
+		return res, nil
+	}
+
+	fieldsNames := append(append([]string{}, localFields...), fkFields...)
+	data, err := queryModel.GetAll(ctx, fieldsNames, GetAllOptions{
+		Filter: keysFilter(queryModel, localFields, pks),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range data.GetFieldsData(fieldsNames).Data() {
+		pk, fk := row[:len(localFields)], row[len(localFields):]
+		if isNilValue(fk[0]) {
+			continue
+		}
+
+		res[linkKey(pk)] = append(res[linkKey(pk)], fk)
+	}
+
+	return res, nil
+}
+
+func linkStorage(m IModel, relation *Relation) int {
+	switch {
+	case relation.JunctionModel != nil:
+		return linkJunction
+	case !fieldsNamesEqual(relation.LocalFieldsNames, m.GetPKFieldsNames()):
+		return linkLocalFk
+	case !fieldsNamesEqual(relation.FkFieldsNames, relation.ExtModel.GetPKFieldsNames()):
+		return linkExtFk
+	default:
+		return linkSharedPk
+	}
+}
+
+func relationFksRequired(m IModel, relation *Relation, storage int) bool {
+	fkModel, fieldsNames := m, relation.LocalFieldsNames
+	if storage == linkExtFk {
+		fkModel, fieldsNames = relation.ExtModel, relation.FkFieldsNames
+	}
+
+	for _, fieldName := range fieldsNames {
+		if field := fkModel.GetFieldDefinition(fieldName); field != nil && field.IsRequired() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fieldsNamesEqual(names1, names2 []string) bool {
+	if len(names1) != len(names2) {
+		return false
+	}
+
+	for i := range names1 {
+		if names1[i] != names2[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// keysFilter returns the filter matched the rows with any of the given values of the fields
+func keysFilter(m IModel, fieldsNames []string, keys [][]interface{}) IExpression {
+	if len(fieldsNames) == 1 {
+		in := exprIn(&exprModelFieldS{m, fieldsNames[0]})
+		for _, key := range keys {
+			in.Add(&exprValueS{key[0]})
+		}
+
+		return in
+	}
+
+	ops := make([]IExpression, len(keys))
+	for i, key := range keys {
+		eqs := make([]IExpression, len(fieldsNames))
+		for j, fieldName := range fieldsNames {
+			eqs[j] = exprEq(&exprModelFieldS{m, fieldName}, &exprValueS{key[j]})
+		}
+		ops[i] = exprAnd(eqs...)
+	}
+
+	return exprOr(ops...)
+}
+
+func linkKey(values []interface{}) string {
+	strs := make([]string, len(values))
+	for i, value := range values {
+		strs[i] = formatExprValue(value, false)
+	}
+
+	return strings.Join(strs, "|")
+}
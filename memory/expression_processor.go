@@ -0,0 +1,482 @@
+package memory
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/go-qbit/model"
+)
+
+// ExprProcessor evaluates expressions for a row.
+// NULL values are equal to each other only, ordering comparisons with NULL are false.
+type ExprProcessor struct {
+	tables   map[string]*table
+	excluded model.IModelRow // The added row in the conflict updates
+}
+
+type EvalFunc func(row model.IModelRow) (interface{}, error)
+
+func (p *ExprProcessor) Eq(op1, op2 model.IExpression) interface{} {
+	return EvalFunc(func(row model.IModelRow) (interface{}, error) {
+		return p.equal(op1, op2, row)
+	})
+}
+
+func (p *ExprProcessor) Ne(op1, op2 model.IExpression) interface{} {
+	return EvalFunc(func(row model.IModelRow) (interface{}, error) {
+		eq, err := p.equal(op1, op2, row)
+		if err != nil {
+			return nil, err
+		}
+
+		return !eq, nil
+	})
+}
+
+func (p *ExprProcessor) Lt(op1, op2 model.IExpression) interface{} {
+	return p.order(op1, op2, func(res int) bool { return res < 0 })
+}
+
+func (p *ExprProcessor) Le(op1, op2 model.IExpression) interface{} {
+	return p.order(op1, op2, func(res int) bool { return res <= 0 })
+}
+
+func (p *ExprProcessor) Gt(op1, op2 model.IExpression) interface{} {
+	return p.order(op1, op2, func(res int) bool { return res > 0 })
+}
+
+func (p *ExprProcessor) Ge(op1, op2 model.IExpression) interface{} {
+	return p.order(op1, op2, func(res int) bool { return res >= 0 })
+}
+
+func (p *ExprProcessor) In(op model.IExpression, values []model.IExpression) interface{} {
+	return EvalFunc(func(row model.IModelRow) (interface{}, error) {
+		for _, op2 := range values {
+			eq, err := p.equal(op, op2, row)
+			if err != nil {
+				return nil, err
+			}
+			if eq {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	})
+}
+
+func (p *ExprProcessor) And(operands []model.IExpression) interface{} {
+	return EvalFunc(func(row model.IModelRow) (interface{}, error) {
+		for _, op := range operands {
+			v, err := evalBool(p, op, row)
+			if err != nil {
+				return nil, err
+			}
+			if !v {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+}
+
+func (p *ExprProcessor) Or(operands []model.IExpression) interface{} {
+	return EvalFunc(func(row model.IModelRow) (interface{}, error) {
+		for _, op := range operands {
+			v, err := evalBool(p, op, row)
+			if err != nil {
+				return nil, err
+			}
+			if v {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
+
+// Any reads the storage data directly, the tables of the external and junction models must be locked by the caller
+func (p *ExprProcessor) Any(localModel model.IModel, relationName string, filter model.IExpression) interface{} {
+	return EvalFunc(func(row model.IModelRow) (interface{}, error) {
+		relation := localModel.GetRelation(relationName)
+		if relation == nil {
+			return nil, fmt.Errorf("There is no relation '%s' in model '%s'", relationName, localModel.GetId())
+		}
+		extModel := relation.ExtModel
+
+		localValues, err := rowValues(row, relation.LocalFieldsNames)
+		if err != nil {
+			return nil, err
+		}
+
+		if relation.JunctionModel == nil {
+			return p.anyExtRow(extModel, relation.FkFieldsNames, localValues, filter)
+		}
+
+		junctionTable, err := p.table(relation.JunctionModel)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, junctionRow := range junctionTable.rows {
+			junctionValues, err := rowValues(junctionRow, relation.JunctionLocalFieldsNames)
+			if err != nil {
+				return nil, err
+			}
+
+			if equal, err := valuesEqual(localValues, junctionValues); err != nil || !equal {
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			fkValues, err := rowValues(junctionRow, relation.JunctionFkFieldsNames)
+			if err != nil {
+				return nil, err
+			}
+
+			matched, err := p.anyExtRow(extModel, relation.FkFieldsNames, fkValues, filter)
+			if err != nil {
+				return nil, err
+			}
+			if matched {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	})
+}
+
+func (p *ExprProcessor) ModelField(m model.IModel, fieldName string) interface{} {
+	return EvalFunc(func(row model.IModelRow) (interface{}, error) {
+		return row.GetValue(fieldName)
+	})
+}
+
+func (p *ExprProcessor) Value(value interface{}) interface{} {
+	return EvalFunc(func(row model.IModelRow) (interface{}, error) {
+		return value, nil
+	})
+}
+
+func (p *ExprProcessor) Func(name string, params ...model.IExpression) interface{} {
+	return EvalFunc(func(row model.IModelRow) (interface{}, error) {
+		f := getFunction(name)
+		if f == nil {
+			return nil, fmt.Errorf("Unknown function '%s'", name)
+		}
+
+		args := make([]interface{}, len(params))
+		for i, param := range params {
+			var err error
+			if args[i], err = param.GetProcessor(p).(EvalFunc)(row); err != nil {
+				return nil, err
+			}
+		}
+
+		return f(args...)
+	})
+}
+
+func (p *ExprProcessor) Excluded(fieldName string) interface{} {
+	return EvalFunc(func(row model.IModelRow) (interface{}, error) {
+		if p.excluded == nil {
+			return nil, fmt.Errorf("The field excluded.%s can be used in the conflict updates only", fieldName)
+		}
+
+		return p.excluded.GetValue(fieldName)
+	})
+}
+
+func (p *ExprProcessor) table(m model.IModel) (*table, error) {
+	t, exists := p.tables[m.GetId()]
+	if !exists {
+		return nil, fmt.Errorf("The table of model '%s' is not locked", m.GetId())
+	}
+
+	return t, nil
+}
+
+func (p *ExprProcessor) operands(op1, op2 model.IExpression, row model.IModelRow) (interface{}, interface{}, error) {
+	v1, err := op1.GetProcessor(p).(EvalFunc)(row)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v2, err := op2.GetProcessor(p).(EvalFunc)(row)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return v1, v2, nil
+}
+
+func (p *ExprProcessor) equal(op1, op2 model.IExpression, row model.IModelRow) (bool, error) {
+	v1, v2, err := p.operands(op1, op2, row)
+	if err != nil {
+		return false, err
+	}
+
+	if isNull(v1) || isNull(v2) {
+		return isNull(v1) && isNull(v2), nil
+	}
+
+	res, err := compareValues(v1, v2)
+	if err != nil {
+		return false, err
+	}
+
+	return res == 0, nil
+}
+
+func (p *ExprProcessor) order(op1, op2 model.IExpression, check func(int) bool) EvalFunc {
+	return func(row model.IModelRow) (interface{}, error) {
+		v1, v2, err := p.operands(op1, op2, row)
+		if err != nil {
+			return nil, err
+		}
+
+		if isNull(v1) || isNull(v2) {
+			return false, nil
+		}
+
+		res, err := compareValues(v1, v2)
+		if err != nil {
+			return nil, err
+		}
+
+		return check(res), nil
+	}
+}
+
+// anyExtRow checks if there is a row of the external model with given FK values matched the filter
+func (p *ExprProcessor) anyExtRow(extModel model.IModel, fkFieldsNames []string, values []interface{}, filter model.IExpression) (bool, error) {
+	extTable, err := p.table(extModel)
+	if err != nil {
+		return false, err
+	}
+
+	for _, extRow := range extTable.rows {
+		extValues, err := rowValues(extRow, fkFieldsNames)
+		if err != nil {
+			return false, err
+		}
+
+		if equal, err := valuesEqual(values, extValues); err != nil || !equal {
+			if err != nil {
+				return false, err
+			}
+			continue
+		}
+
+		if filter == nil {
+			return true, nil
+		}
+
+		matched, err := evalBool(p, filter, extRow)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func evalBool(p *ExprProcessor, filter model.IExpression, row model.IModelRow) (bool, error) {
+	filterRes, err := filter.GetProcessor(p).(EvalFunc)(row)
+	if err != nil {
+		return false, err
+	}
+
+	matched, ok := filterRes.(bool)
+	if !ok {
+		return false, fmt.Errorf("Invalid filter, must have bool type, not %T", filterRes)
+	}
+
+	return matched, nil
+}
+
+func rowValues(row model.IModelRow, fieldsNames []string) ([]interface{}, error) {
+	res := make([]interface{}, len(fieldsNames))
+	for i, fieldName := range fieldsNames {
+		var err error
+		if res[i], err = row.GetValue(fieldName); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+func valuesEqual(values1, values2 []interface{}) (bool, error) {
+	for i := range values1 {
+		if isNull(values1[i]) || isNull(values2[i]) {
+			return false, nil
+		}
+
+		res, err := compareValues(values1[i], values2[i])
+		if err != nil {
+			return false, err
+		}
+		if res != 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func isNull(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
+
+func deref(v interface{}) reflect.Value {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	return rv
+}
+
+// compareValues compares two not NULL values, numbers of different types are compared by their values
+func compareValues(v1, v2 interface{}) (int, error) {
+	rv1, rv2 := deref(v1), deref(v2)
+
+	switch {
+	case isInt(rv1) && isInt(rv2):
+		return compareOrdered(rv1.Int() < rv2.Int(), rv1.Int() > rv2.Int()), nil
+	case isUint(rv1) && isUint(rv2):
+		return compareOrdered(rv1.Uint() < rv2.Uint(), rv1.Uint() > rv2.Uint()), nil
+	case isInt(rv1) && isUint(rv2):
+		if rv1.Int() < 0 {
+			return -1, nil
+		}
+		return compareOrdered(uint64(rv1.Int()) < rv2.Uint(), uint64(rv1.Int()) > rv2.Uint()), nil
+	case isUint(rv1) && isInt(rv2):
+		res, err := compareValues(v2, v1)
+		return -res, err
+	case isNumber(rv1) && isNumber(rv2):
+		f1, f2 := toFloat(rv1), toFloat(rv2)
+		return compareOrdered(f1 < f2, f1 > f2), nil
+	}
+
+	// The times can be given as strings
+	if t1, ok := rv1.Interface().(time.Time); ok && rv2.Kind() == reflect.String {
+		t2, err := parseTime(rv2.String())
+		if err != nil {
+			return 0, err
+		}
+		return compareOrdered(t1.Before(t2), t1.After(t2)), nil
+	}
+	if _, ok := rv2.Interface().(time.Time); ok && rv1.Kind() == reflect.String {
+		res, err := compareValues(v2, v1)
+		return -res, err
+	}
+
+	if rv1.Kind() != rv2.Kind() {
+		return 0, fmt.Errorf("%s and %s cannot be compared", rv1.Kind(), rv2.Kind())
+	}
+
+	switch rv1.Kind() {
+	case reflect.String:
+		return compareOrdered(rv1.String() < rv2.String(), rv1.String() > rv2.String()), nil
+	case reflect.Bool:
+		return compareOrdered(!rv1.Bool() && rv2.Bool(), rv1.Bool() && !rv2.Bool()), nil
+	case reflect.Slice:
+		if b1, ok := rv1.Interface().([]byte); ok {
+			if b2, ok := rv2.Interface().([]byte); ok {
+				return bytes.Compare(b1, b2), nil
+			}
+		}
+	case reflect.Struct:
+		if t1, ok := rv1.Interface().(time.Time); ok {
+			if t2, ok := rv2.Interface().(time.Time); ok {
+				return compareOrdered(t1.Before(t2), t1.After(t2)), nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("%s and %s cannot be compared", rv1.Type(), rv2.Type())
+}
+
+// parseTime parses the time given as a string in the formats of the model
+func parseTime(str string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, str); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("Invalid time '%s'", str)
+}
+
+// compareForSort compares values with NULL, NULL is less than any value
+func compareForSort(v1, v2 interface{}) (int, error) {
+	switch {
+	case isNull(v1) && isNull(v2):
+		return 0, nil
+	case isNull(v1):
+		return -1, nil
+	case isNull(v2):
+		return 1, nil
+	default:
+		return compareValues(v1, v2)
+	}
+}
+
+func isInt(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	default:
+		return false
+	}
+}
+
+func isUint(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+func isNumber(rv reflect.Value) bool {
+	return isInt(rv) || isUint(rv) || rv.Kind() == reflect.Float32 || rv.Kind() == reflect.Float64
+}
+
+func toFloat(rv reflect.Value) float64 {
+	switch {
+	case isInt(rv):
+		return float64(rv.Int())
+	case isUint(rv):
+		return float64(rv.Uint())
+	default:
+		return rv.Float()
+	}
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,211 @@
+package memory
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ScalarFunc is a function which can be called from filters with expr.Func
+type ScalarFunc func(args ...interface{}) (interface{}, error)
+
+var (
+	functions = map[string]ScalarFunc{
+		"lower":  stringFunc("lower", strings.ToLower),
+		"upper":  stringFunc("upper", strings.ToUpper),
+		"length": funcLength,
+		"now":    funcNow,
+		"abs":    funcAbs,
+		"concat": funcConcat,
+		"add":    funcAdd,
+	}
+	functionsMtx sync.RWMutex
+)
+
+// RegisterFunc registers a new function or replaces an existing one
+func RegisterFunc(name string, f ScalarFunc) {
+	functionsMtx.Lock()
+	defer functionsMtx.Unlock()
+
+	functions[name] = f
+}
+
+func getFunction(name string) ScalarFunc {
+	functionsMtx.RLock()
+	defer functionsMtx.RUnlock()
+
+	return functions[name]
+}
+
+func checkArgsNum(name string, args []interface{}, num int) error {
+	if len(args) != num {
+		return fmt.Errorf("Function '%s' needs %d arguments, got %d", name, num, len(args))
+	}
+
+	return nil
+}
+
+func stringFunc(name string, f func(string) string) ScalarFunc {
+	return func(args ...interface{}) (interface{}, error) {
+		if err := checkArgsNum(name, args, 1); err != nil {
+			return nil, err
+		}
+
+		switch v := args[0].(type) {
+		case nil:
+			return nil, nil
+		case string:
+			return f(v), nil
+		case *string:
+			if v == nil {
+				return nil, nil
+			}
+			return f(*v), nil
+		default:
+			return nil, fmt.Errorf("Function '%s' needs a string argument, not %T", name, v)
+		}
+	}
+}
+
+func funcLength(args ...interface{}) (interface{}, error) {
+	if err := checkArgsNum("length", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch v := args[0].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return utf8.RuneCountInString(v), nil
+	case *string:
+		if v == nil {
+			return nil, nil
+		}
+		return utf8.RuneCountInString(*v), nil
+	case []byte:
+		return len(v), nil
+	default:
+		return nil, fmt.Errorf("Function 'length' needs a string argument, not %T", v)
+	}
+}
+
+func funcNow(args ...interface{}) (interface{}, error) {
+	if err := checkArgsNum("now", args, 0); err != nil {
+		return nil, err
+	}
+
+	return time.Now(), nil
+}
+
+func funcAbs(args ...interface{}) (interface{}, error) {
+	if err := checkArgsNum("abs", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch v := args[0].(type) {
+	case nil:
+		return nil, nil
+	case int:
+		if v < 0 {
+			return -v, nil
+		}
+		return v, nil
+	case int8:
+		if v < 0 {
+			return -v, nil
+		}
+		return v, nil
+	case int16:
+		if v < 0 {
+			return -v, nil
+		}
+		return v, nil
+	case int32:
+		if v < 0 {
+			return -v, nil
+		}
+		return v, nil
+	case int64:
+		if v < 0 {
+			return -v, nil
+		}
+		return v, nil
+	case uint, uint8, uint16, uint32, uint64:
+		return v, nil
+	case float32:
+		return float32(math.Abs(float64(v))), nil
+	case float64:
+		return math.Abs(v), nil
+	default:
+		return nil, fmt.Errorf("Function 'abs' needs a numeric argument, not %T", v)
+	}
+}
+
+func funcConcat(args ...interface{}) (interface{}, error) {
+	buf := &strings.Builder{}
+
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case nil:
+			return nil, nil
+		case string:
+			buf.WriteString(v)
+		case *string:
+			if v == nil {
+				return nil, nil
+			}
+			buf.WriteString(*v)
+		default:
+			buf.WriteString(fmt.Sprint(v))
+		}
+	}
+
+	return buf.String(), nil
+}
+
+// funcAdd returns the sum of the numbers, it is float64 if any argument is a float and has the type of the first argument otherwise
+func funcAdd(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("Function 'add' needs at least 1 argument")
+	}
+
+	var (
+		intSum   int64
+		floatSum float64
+		isFloat  bool
+	)
+	for _, arg := range args {
+		if isNull(arg) {
+			return nil, nil
+		}
+
+		rv := deref(arg)
+		switch {
+		case isInt(rv):
+			intSum += rv.Int()
+		case isUint(rv):
+			intSum += int64(rv.Uint())
+		case isNumber(rv):
+			floatSum += rv.Float()
+			isFloat = true
+		default:
+			return nil, fmt.Errorf("Function 'add' needs numeric arguments, not %T", arg)
+		}
+	}
+
+	if isFloat {
+		return floatSum + float64(intSum), nil
+	}
+
+	// The negative sum does not fit the unsigned type
+	resType := deref(args[0]).Type()
+	if intSum < 0 && isUint(deref(args[0])) {
+		return intSum, nil
+	}
+
+	return reflect.ValueOf(intSum).Convert(resType).Interface(), nil
+}
@@ -0,0 +1,1001 @@
+package memory
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/go-qbit/model"
+	"github.com/go-qbit/qerror"
+	"github.com/go-qbit/timelog"
+)
+
+// Storage keeps the data of models in memory.
+// Every model has its own lock, the primary keys are unique, the secondary indexes are declared by AddIndex and AddOrderedIndex.
+// A single integer primary key is generated for rows without it.
+// Transactions are serialized with each other and are rolled back on error,
+// the changes outside of transactions wait for the transactions which changed the same tables,
+// the reads outside of transactions are not isolated from them.
+type Storage struct {
+	tables    map[string]*table
+	tablesMtx sync.RWMutex
+	txMtx     sync.Mutex
+}
+
+type txCtxKey struct{}
+
+type tableSnapshot struct {
+	rows          []DataRow
+	autoIncrement int64
+}
+
+func NewStorage() *Storage {
+	return &Storage{
+		tables: make(map[string]*table),
+	}
+}
+
+func (s *Storage) NewModel(id string, fields []model.IFieldDefinition, opts model.BaseModelOpts) model.IModel {
+	return model.NewBaseModel(id, fields, s, opts)
+}
+
+func (s *Storage) RegisterModel(m model.IModel) error {
+	s.tablesMtx.Lock()
+	defer s.tablesMtx.Unlock()
+
+	if _, exists := s.tables[m.GetId()]; exists {
+		return qerror.Errorf("Model '%s' is already exists", m.GetId())
+	}
+
+	s.tables[m.GetId()] = newTable(m)
+
+	return nil
+}
+
+func (s *Storage) GetModelsNames() []string {
+	s.tablesMtx.RLock()
+	defer s.tablesMtx.RUnlock()
+
+	res := make([]string, 0, len(s.tables))
+	for k := range s.tables {
+		res = append(res, k)
+	}
+
+	sort.Strings(res)
+
+	return res
+}
+
+// AddIndex adds a hash index by the fields, it is used for equality lookups by a single field
+func (s *Storage) AddIndex(m model.IModel, fieldsNames ...string) error {
+	return s.addIndex(m, &index{fields: fieldsNames})
+}
+
+// AddOrderedIndex adds an ordered index by the field, it is used for equality and range lookups
+func (s *Storage) AddOrderedIndex(m model.IModel, fieldName string) error {
+	return s.addIndex(m, &index{fields: []string{fieldName}, ordered: true})
+}
+
+func (s *Storage) addIndex(m model.IModel, idx *index) error {
+	if len(idx.fields) == 0 {
+		return qerror.Errorf("No fields for index in model '%s'", m.GetId())
+	}
+
+	for _, fieldName := range idx.fields {
+		field := m.GetFieldDefinition(fieldName)
+		if field == nil {
+			return qerror.Errorf("Unknown field '%s' in model '%s'", fieldName, m.GetId())
+		}
+		if field.IsDerivable() {
+			return qerror.Errorf("The field '%s' is derivable in model '%s', it cannot be indexed", fieldName, m.GetId())
+		}
+	}
+
+	t, err := s.getTable(m)
+	if err != nil {
+		return err
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if err := idx.build(t.rows); err != nil {
+		return err
+	}
+
+	t.indexes = append(t.indexes, idx)
+
+	return nil
+}
+
+func (s *Storage) Add(ctx context.Context, m model.IModel, data *model.Data, opts model.AddOptions) (*model.Data, error) {
+	ctx = timelog.Start(ctx, "Storage.Add")
+	defer timelog.Finish(ctx)
+
+	if opts.OnConflict != nil {
+		return s.upsert(ctx, m, data, opts.OnConflict)
+	}
+
+	p, unlock, err := s.lockTables(ctx, m, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	t := p.tables[m.GetId()]
+
+	pkFieldsNames := m.GetPKFieldsNames()
+	pKeys := model.NewEmptyData(pkFieldsNames)
+
+	newRows := make([]DataRow, 0, data.Len())
+	replaced := make(map[int]DataRow)
+	newKeys := make(map[string]int)
+	autoIncrement := t.autoIncrement
+
+	for _, row := range data.Data() {
+		dataRow, err := newDataRow(m, data.Fields(), row, &autoIncrement)
+		if err != nil {
+			return nil, err
+		}
+
+		pk := make([]interface{}, len(pkFieldsNames))
+		for i, pkName := range pkFieldsNames {
+			pk[i] = dataRow[pkName]
+		}
+		if err := pKeys.Add(pk); err != nil {
+			return nil, err
+		}
+
+		if len(pkFieldsNames) > 0 {
+			key := t.pkKey(dataRow)
+
+			if pos, exists := t.pk[key]; exists {
+				if !opts.Replace {
+					return nil, model.AddErrorf("Duplicate primary key '%s' in model '%s'", key, m.GetId())
+				}
+				replaced[pos] = dataRow
+				continue
+			}
+
+			if i, exists := newKeys[key]; exists {
+				if !opts.Replace {
+					return nil, model.AddErrorf("Duplicate primary key '%s' in model '%s'", key, m.GetId())
+				}
+				newRows[i] = dataRow
+				continue
+			}
+
+			newKeys[key] = len(newRows)
+		}
+
+		newRows = append(newRows, dataRow)
+	}
+
+	if len(replaced) > 0 {
+		oldRows := t.rows
+		t.rows = make([]DataRow, len(oldRows), len(oldRows)+len(newRows))
+		copy(t.rows, oldRows)
+
+		for pos, row := range replaced {
+			t.rows[pos] = row
+		}
+		t.rows = append(t.rows, newRows...)
+
+		if err := t.rebuild(); err != nil {
+			t.rows = oldRows
+			if rebuildErr := t.rebuild(); rebuildErr != nil {
+				return nil, rebuildErr
+			}
+			return nil, err
+		}
+	} else {
+		if err := t.checkUnique(newRows); err != nil {
+			return nil, err
+		}
+
+		if err := t.append(newRows...); err != nil {
+			return nil, err
+		}
+	}
+
+	t.autoIncrement = autoIncrement
+
+	return pKeys, nil
+}
+
+// upsert adds the rows, the rows conflicting with the existing ones by the target fields are merged into them
+func (s *Storage) upsert(ctx context.Context, m model.IModel, data *model.Data, onConflict *model.OnConflict) (*model.Data, error) {
+	updates := make([]model.IExpression, 0, len(onConflict.Update))
+	for _, e := range onConflict.Update {
+		updates = append(updates, e)
+	}
+
+	// The tables used in Any of the updates are locked too
+	p, unlock, err := s.lockTables(ctx, m, true, updates...)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	t := p.tables[m.GetId()]
+
+	pkFieldsNames := m.GetPKFieldsNames()
+	target := onConflict.Target
+	if len(target) == 0 {
+		target = pkFieldsNames
+	}
+
+	rows := make([]DataRow, len(t.rows), len(t.rows)+data.Len())
+	copy(rows, t.rows)
+
+	// Positions of the rows by the target fields values, the rows with NULL values never conflict
+	positions := make(map[string]int, len(rows))
+	for pos, row := range rows {
+		if key, ok := conflictKey(row, target); ok {
+			positions[key] = pos
+		}
+	}
+
+	autoIncrement := t.autoIncrement
+	resPositions := make([]int, 0, data.Len())
+
+	for _, row := range data.Data() {
+		dataRow, err := newDataRow(m, data.Fields(), row, &autoIncrement)
+		if err != nil {
+			return nil, err
+		}
+
+		key, ok := conflictKey(dataRow, target)
+		pos, exists := positions[key]
+		if !ok || !exists {
+			if ok {
+				positions[key] = len(rows)
+			}
+			resPositions = append(resPositions, len(rows))
+			rows = append(rows, dataRow)
+			continue
+		}
+
+		resPositions = append(resPositions, pos)
+		if len(onConflict.Update) == 0 {
+			continue
+		}
+
+		// All the expressions are evaluated with the existing values
+		p.excluded = dataRow
+		newRow := make(DataRow, len(rows[pos]))
+		for name, value := range rows[pos] {
+			newRow[name] = value
+		}
+		for name, e := range onConflict.Update {
+			value, err := e.GetProcessor(p).(EvalFunc)(rows[pos])
+			if err != nil {
+				return nil, err
+			}
+			if err := newRow.SetValue(name, value); err != nil {
+				return nil, err
+			}
+		}
+
+		delete(positions, key)
+		if newKey, ok := conflictKey(newRow, target); ok {
+			positions[newKey] = pos
+		}
+		rows[pos] = newRow
+	}
+
+	oldRows := t.rows
+	t.rows = rows
+	if err := t.rebuild(); err != nil {
+		t.rows = oldRows
+		if rebuildErr := t.rebuild(); rebuildErr != nil {
+			return nil, rebuildErr
+		}
+		if dupErr, ok := err.(*duplicateKeyError); ok {
+			return nil, model.AddErrorf("Duplicate primary key '%s' in model '%s'", dupErr.key, m.GetId())
+		}
+		return nil, err
+	}
+	t.autoIncrement = autoIncrement
+
+	pKeys := model.NewEmptyData(pkFieldsNames)
+	for _, pos := range resPositions {
+		pk := make([]interface{}, len(pkFieldsNames))
+		for i, pkName := range pkFieldsNames {
+			pk[i] = rows[pos][pkName]
+		}
+		if err := pKeys.Add(pk); err != nil {
+			return nil, err
+		}
+	}
+
+	return pKeys, nil
+}
+
+// newDataRow returns the added row with the generated primary key if it is missed
+func newDataRow(m model.IModel, fieldsNames []string, row []interface{}, autoIncrement *int64) (DataRow, error) {
+	dataRow := make(DataRow, len(row))
+	for i, field := range fieldsNames {
+		dataRow[field] = row[i]
+	}
+
+	pkFieldsNames := m.GetPKFieldsNames()
+	if len(pkFieldsNames) == 1 {
+		if isNull(dataRow[pkFieldsNames[0]]) {
+			v, ok := nextAutoIncrement(m, pkFieldsNames[0], autoIncrement)
+			if !ok {
+				return nil, model.AddErrorf("Missed primary key '%s' in model '%s'", pkFieldsNames[0], m.GetId())
+			}
+			dataRow[pkFieldsNames[0]] = v
+		} else if rv := deref(dataRow[pkFieldsNames[0]]); isInt(rv) && rv.Int() > *autoIncrement {
+			*autoIncrement = rv.Int()
+		}
+	}
+
+	return dataRow, nil
+}
+
+// conflictKey returns the key of the fields values, it is false if any of the values is NULL
+func conflictKey(row DataRow, fieldsNames []string) (string, bool) {
+	for _, fieldName := range fieldsNames {
+		if isNull(row[fieldName]) {
+			return "", false
+		}
+	}
+
+	return rowKey(row, fieldsNames), true
+}
+
+func (s *Storage) Query(ctx context.Context, m model.IModel, fieldsNames []string, options model.GetAllOptions) (*model.Data, error) {
+	ctx = timelog.Start(ctx, "Storage.Query")
+	defer timelog.Finish(ctx)
+
+	p, unlock, err := s.lockTables(ctx, m, false, options.Filter)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	t := p.tables[m.GetId()]
+
+	positions, err := t.find(p, options.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]DataRow, len(positions))
+	for i, pos := range positions {
+		rows[i] = t.rows[pos]
+	}
+
+	if len(options.OrderBy) > 0 {
+		if err := sortRows(rows, options.OrderBy); err != nil {
+			return nil, err
+		}
+	}
+
+	res := model.NewEmptyData(fieldsNames)
+
+	var (
+		total    uint64
+		distinct map[string]struct{}
+	)
+	if options.Distinct {
+		distinct = make(map[string]struct{})
+	}
+
+	// Number of the rows in every partition, there is the single partition if PartitionBy is empty
+	partitions := make(map[string]uint64)
+	partitionValues := make([]interface{}, len(options.PartitionBy))
+
+	for _, row := range rows {
+		resRow := make([]interface{}, len(fieldsNames))
+		for i, fieldName := range fieldsNames {
+			resRow[i] = row[fieldName]
+		}
+
+		if distinct != nil {
+			key := valuesKey(resRow)
+			if _, exists := distinct[key]; exists {
+				continue
+			}
+			distinct[key] = struct{}{}
+		}
+
+		total++
+
+		for i, fieldName := range options.PartitionBy {
+			partitionValues[i] = row[fieldName]
+		}
+		partition := valuesKey(partitionValues)
+		partitions[partition]++
+
+		if partitions[partition] <= options.Offset {
+			continue
+		}
+
+		if options.Limit > 0 && partitions[partition] > options.Offset+options.Limit {
+			if options.RowsWoLimit == nil && len(options.PartitionBy) == 0 {
+				break
+			}
+			continue
+		}
+
+		if err := res.Add(resRow); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.RowsWoLimit != nil {
+		*options.RowsWoLimit = total
+	}
+
+	return res, nil
+}
+
+func (s *Storage) Edit(ctx context.Context, m model.IModel, filter model.IExpression, newValues map[string]interface{}) (uint64, error) {
+	ctx = timelog.Start(ctx, "Storage.Edit")
+	defer timelog.Finish(ctx)
+
+	rows, err := s.edit(ctx, m, filter, newValues)
+
+	return uint64(len(rows)), err
+}
+
+func (s *Storage) EditReturning(ctx context.Context, m model.IModel, filter model.IExpression, newValues map[string]interface{}, fieldsNames []string) (*model.Data, error) {
+	ctx = timelog.Start(ctx, "Storage.EditReturning")
+	defer timelog.Finish(ctx)
+
+	rows, err := s.edit(ctx, m, filter, newValues)
+	if err != nil {
+		return nil, err
+	}
+
+	return rowsData(rows, fieldsNames)
+}
+
+// edit changes the rows matched the filter and returns the changed rows
+func (s *Storage) edit(ctx context.Context, m model.IModel, filter model.IExpression, newValues map[string]interface{}) ([]DataRow, error) {
+	p, unlock, err := s.lockTables(ctx, m, true, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	t := p.tables[m.GetId()]
+
+	positions, err := t.find(p, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	oldRows := make(map[int]DataRow, len(positions))
+	newRows := make([]DataRow, len(positions))
+	for i, pos := range positions {
+		oldRows[pos] = t.rows[pos]
+
+		newRow := make(DataRow, len(t.rows[pos])+len(newValues))
+		for name, value := range t.rows[pos] {
+			newRow[name] = value
+		}
+		for name, value := range newValues {
+			if err := newRow.SetValue(name, value); err != nil {
+				return nil, err
+			}
+		}
+		t.rows[pos] = newRow
+		newRows[i] = newRow
+	}
+
+	if !t.isIndexed(newValues) {
+		return newRows, nil
+	}
+
+	if err := t.rebuild(); err != nil {
+		for pos, row := range oldRows {
+			t.rows[pos] = row
+		}
+		if rebuildErr := t.rebuild(); rebuildErr != nil {
+			return nil, rebuildErr
+		}
+		if dupErr, ok := err.(*duplicateKeyError); ok {
+			return nil, model.EditErrorf("Duplicate primary key '%s' in model '%s'", dupErr.key, m.GetId())
+		}
+		return nil, err
+	}
+
+	return newRows, nil
+}
+
+func (s *Storage) EditMulti(ctx context.Context, m model.IModel, data *model.Data, filter model.IExpression) (uint64, error) {
+	ctx = timelog.Start(ctx, "Storage.EditMulti")
+	defer timelog.Finish(ctx)
+
+	p, unlock, err := s.lockTables(ctx, m, true, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	t := p.tables[m.GetId()]
+
+	pkFields := make(map[string]struct{})
+	for _, fieldName := range m.GetPKFieldsNames() {
+		pkFields[fieldName] = struct{}{}
+	}
+
+	newValues := make(map[string]interface{}, len(data.Fields()))
+	for _, fieldName := range data.Fields() {
+		if _, exists := pkFields[fieldName]; !exists {
+			newValues[fieldName] = nil
+		}
+	}
+
+	oldRows := make(map[int]DataRow, data.Len())
+	rollback := func() error {
+		for pos, row := range oldRows {
+			t.rows[pos] = row
+		}
+
+		return t.rebuild()
+	}
+
+	var count uint64
+	for _, row := range data.Data() {
+		dataRow := make(DataRow, len(row))
+		for i, fieldName := range data.Fields() {
+			dataRow[fieldName] = row[i]
+		}
+
+		pos, exists := t.pk[t.pkKey(dataRow)]
+		if !exists {
+			continue
+		}
+
+		if filter != nil {
+			matched, err := evalBool(p, filter, t.rows[pos])
+			if err != nil {
+				if rollbackErr := rollback(); rollbackErr != nil {
+					return 0, rollbackErr
+				}
+				return 0, err
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		if _, exists := oldRows[pos]; !exists {
+			oldRows[pos] = t.rows[pos]
+		}
+
+		newRow := make(DataRow, len(t.rows[pos])+len(newValues))
+		for name, value := range t.rows[pos] {
+			newRow[name] = value
+		}
+		for name := range newValues {
+			if err := newRow.SetValue(name, dataRow[name]); err != nil {
+				if rollbackErr := rollback(); rollbackErr != nil {
+					return 0, rollbackErr
+				}
+				return 0, err
+			}
+		}
+		t.rows[pos] = newRow
+		count++
+	}
+
+	if !t.isIndexed(newValues) {
+		return count, nil
+	}
+
+	if err := t.rebuild(); err != nil {
+		if rollbackErr := rollback(); rollbackErr != nil {
+			return 0, rollbackErr
+		}
+		if dupErr, ok := err.(*duplicateKeyError); ok {
+			return 0, model.EditErrorf("Duplicate primary key '%s' in model '%s'", dupErr.key, m.GetId())
+		}
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (s *Storage) Delete(ctx context.Context, m model.IModel, filter model.IExpression) (uint64, error) {
+	ctx = timelog.Start(ctx, "Storage.Delete")
+	defer timelog.Finish(ctx)
+
+	rows, err := s.delete(ctx, m, filter)
+
+	return uint64(len(rows)), err
+}
+
+func (s *Storage) DeleteReturning(ctx context.Context, m model.IModel, filter model.IExpression, fieldsNames []string) (*model.Data, error) {
+	ctx = timelog.Start(ctx, "Storage.DeleteReturning")
+	defer timelog.Finish(ctx)
+
+	rows, err := s.delete(ctx, m, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return rowsData(rows, fieldsNames)
+}
+
+// delete deletes the rows matched the filter and returns the deleted rows
+func (s *Storage) delete(ctx context.Context, m model.IModel, filter model.IExpression) ([]DataRow, error) {
+	p, unlock, err := s.lockTables(ctx, m, true, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	t := p.tables[m.GetId()]
+
+	positions, err := t.find(p, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(positions) == 0 {
+		return nil, nil
+	}
+
+	deletedRows := make([]DataRow, len(positions))
+	for i, pos := range positions {
+		deletedRows[i] = t.rows[pos]
+	}
+	t.remove(positions)
+
+	return deletedRows, nil
+}
+
+// SupportsUniqueKeys reports Add and Edit check the unique keys of the models
+func (s *Storage) SupportsUniqueKeys() bool {
+	return true
+}
+
+// SupportsPartitionBy reports Query applies Limit and Offset to every partition of the rows
+func (s *Storage) SupportsPartitionBy() bool {
+	return true
+}
+
+func (s *Storage) CountGroups(ctx context.Context, m model.IModel, groupBy []string, filter model.IExpression) (*model.Data, error) {
+	ctx = timelog.Start(ctx, "Storage.CountGroups")
+	defer timelog.Finish(ctx)
+
+	p, unlock, err := s.lockTables(ctx, m, false, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	t := p.tables[m.GetId()]
+
+	positions, err := t.find(p, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups [][]interface{}
+	groupsNums := make(map[string]int)
+	for _, pos := range positions {
+		group := make([]interface{}, len(groupBy), len(groupBy)+1)
+		for i, fieldName := range groupBy {
+			group[i] = t.rows[pos][fieldName]
+		}
+
+		key := valuesKey(group)
+		if n, exists := groupsNums[key]; exists {
+			groups[n][len(groupBy)] = groups[n][len(groupBy)].(uint64) + 1
+			continue
+		}
+
+		groupsNums[key] = len(groups)
+		groups = append(groups, append(group, uint64(1)))
+	}
+
+	res := model.NewEmptyData(append(append([]string{}, groupBy...), model.AGGREGATE_COUNT))
+	for _, group := range groups {
+		if err := res.Add(group); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+func (s *Storage) Count(ctx context.Context, m model.IModel, filter model.IExpression) (uint64, error) {
+	ctx = timelog.Start(ctx, "Storage.Count")
+	defer timelog.Finish(ctx)
+
+	positions, err := s.findRows(ctx, m, filter)
+
+	return uint64(len(positions)), err
+}
+
+func (s *Storage) Exists(ctx context.Context, m model.IModel, filter model.IExpression) (bool, error) {
+	ctx = timelog.Start(ctx, "Storage.Exists")
+	defer timelog.Finish(ctx)
+
+	positions, err := s.findRows(ctx, m, filter)
+
+	return len(positions) > 0, err
+}
+
+// findRows returns the positions of the rows matched the filter
+func (s *Storage) findRows(ctx context.Context, m model.IModel, filter model.IExpression) ([]int, error) {
+	p, unlock, err := s.lockTables(ctx, m, false, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return p.tables[m.GetId()].find(p, filter)
+}
+
+// RunInTransaction runs f and restores the data of the tables changed in it if it returns an error.
+// The changes of the tables changed in the transaction outside of it wait for the end of the transaction.
+// A nested call joins the outer transaction.
+func (s *Storage) RunInTransaction(ctx context.Context, f func(context.Context) error) error {
+	if s.transaction(ctx) != nil {
+		return f(ctx)
+	}
+
+	s.txMtx.Lock()
+	defer s.txMtx.Unlock()
+
+	tx := &transaction{
+		storage:   s,
+		snapshots: make(map[*table]tableSnapshot),
+		done:      make(chan struct{}),
+	}
+	defer close(tx.done)
+
+	if err := f(model.WithTransaction(context.WithValue(ctx, txCtxKey{}, tx))); err != nil {
+		if restoreErr := tx.finish(true); restoreErr != nil {
+			return restoreErr
+		}
+		return err
+	}
+
+	return tx.finish(false)
+}
+
+// transaction returns the transaction of the storage in the context
+func (s *Storage) transaction(ctx context.Context) *transaction {
+	if tx, ok := ctx.Value(txCtxKey{}).(*transaction); ok && tx.storage == s {
+		return tx
+	}
+
+	return nil
+}
+
+// transaction keeps the data of the tables changed in it to restore them on rollback
+type transaction struct {
+	storage   *Storage
+	mtx       sync.Mutex
+	snapshots map[*table]tableSnapshot
+	done      chan struct{} // It is closed at the end of the transaction
+}
+
+// join saves the data of the locked for writing table before its first change in the transaction
+func (tx *transaction) join(t *table) {
+	if t.tx == tx {
+		return
+	}
+
+	tx.mtx.Lock()
+	// Rows are never changed in place, so the copy of the slice is enough
+	tx.snapshots[t] = tableSnapshot{append([]DataRow(nil), t.rows...), t.autoIncrement}
+	tx.mtx.Unlock()
+
+	t.tx = tx
+}
+
+// finish releases the tables changed in the transaction, their data is restored on rollback
+func (tx *transaction) finish(rollback bool) error {
+	var err error
+	for t, data := range tx.snapshots {
+		t.mtx.Lock()
+		if rollback {
+			t.rows, t.autoIncrement = data.rows, data.autoIncrement
+			if rebuildErr := t.rebuild(); rebuildErr != nil && err == nil {
+				err = rebuildErr
+			}
+		}
+		t.tx = nil
+		t.mtx.Unlock()
+	}
+
+	return err
+}
+
+func (s *Storage) getTable(m model.IModel) (*table, error) {
+	s.tablesMtx.RLock()
+	defer s.tablesMtx.RUnlock()
+
+	t, exists := s.tables[m.GetId()]
+	if !exists {
+		return nil, qerror.Errorf("Model '%s' is not registered", m.GetId())
+	}
+
+	return t, nil
+}
+
+// lockTables locks the table of the model and the tables used in the expressions in the order of models ids to avoid deadlocks.
+// The table locked for writing joins the transaction of the context, a change outside of the transaction waits for its end.
+func (s *Storage) lockTables(ctx context.Context, m model.IModel, write bool, exprs ...model.IExpression) (*ExprProcessor, func(), error) {
+	ids := map[string]struct{}{m.GetId(): {}}
+	(&anyCollector{ids}).visit(exprs...)
+
+	sortedIds := make([]string, 0, len(ids))
+	for id := range ids {
+		sortedIds = append(sortedIds, id)
+	}
+	sort.Strings(sortedIds)
+
+	p := &ExprProcessor{tables: make(map[string]*table, len(ids))}
+
+	s.tablesMtx.RLock()
+	for _, id := range sortedIds {
+		t, exists := s.tables[id]
+		if !exists {
+			s.tablesMtx.RUnlock()
+			return nil, nil, qerror.Errorf("Model '%s' is not registered", id)
+		}
+		p.tables[id] = t
+	}
+	s.tablesMtx.RUnlock()
+
+	unlock := func() {
+		for i := len(sortedIds) - 1; i >= 0; i-- {
+			if write && sortedIds[i] == m.GetId() {
+				p.tables[sortedIds[i]].mtx.Unlock()
+			} else {
+				p.tables[sortedIds[i]].mtx.RUnlock()
+			}
+		}
+	}
+
+	tx := s.transaction(ctx)
+	for {
+		for _, id := range sortedIds {
+			if write && id == m.GetId() {
+				p.tables[id].mtx.Lock()
+			} else {
+				p.tables[id].mtx.RLock()
+			}
+		}
+
+		if !write {
+			return p, unlock, nil
+		}
+
+		t := p.tables[m.GetId()]
+		if tx != nil {
+			tx.join(t)
+			return p, unlock, nil
+		}
+
+		if t.tx == nil {
+			return p, unlock, nil
+		}
+
+		done := t.tx.done
+		unlock()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+func nextAutoIncrement(m model.IModel, fieldName string, autoIncrement *int64) (interface{}, bool) {
+	field := m.GetFieldDefinition(fieldName)
+	if field == nil || field.GetType() == nil {
+		return nil, false
+	}
+
+	rt := field.GetType()
+	switch rt.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		*autoIncrement++
+		v := reflect.New(rt).Elem()
+		v.SetInt(*autoIncrement)
+		return v.Interface(), true
+	default:
+		return nil, false
+	}
+}
+
+// rowsData returns the values of the fields of the rows
+func rowsData(rows []DataRow, fieldsNames []string) (*model.Data, error) {
+	res := model.NewEmptyData(fieldsNames)
+	for _, row := range rows {
+		resRow := make([]interface{}, len(fieldsNames))
+		for i, fieldName := range fieldsNames {
+			resRow[i] = row[fieldName]
+		}
+
+		if err := res.Add(resRow); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+func sortRows(rows []DataRow, orderBy []model.Order) error {
+	var err error
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, order := range orderBy {
+			res, cmpErr := compareForSort(rows[i][order.FieldName], rows[j][order.FieldName])
+			if cmpErr != nil {
+				err = cmpErr
+				return false
+			}
+
+			if res != 0 {
+				return res < 0 != order.Desc
+			}
+		}
+		return false
+	})
+
+	return err
+}
+
+// anyCollector collects ids of the models used in Any expressions
+type anyCollector struct {
+	ids map[string]struct{}
+}
+
+func (c *anyCollector) visit(operands ...model.IExpression) interface{} {
+	for _, op := range operands {
+		if op != nil {
+			op.GetProcessor(c)
+		}
+	}
+
+	return nil
+}
+
+func (c *anyCollector) Eq(op1, op2 model.IExpression) interface{} { return c.visit(op1, op2) }
+func (c *anyCollector) Ne(op1, op2 model.IExpression) interface{} { return c.visit(op1, op2) }
+func (c *anyCollector) Lt(op1, op2 model.IExpression) interface{} { return c.visit(op1, op2) }
+func (c *anyCollector) Le(op1, op2 model.IExpression) interface{} { return c.visit(op1, op2) }
+func (c *anyCollector) Gt(op1, op2 model.IExpression) interface{} { return c.visit(op1, op2) }
+func (c *anyCollector) Ge(op1, op2 model.IExpression) interface{} { return c.visit(op1, op2) }
+
+func (c *anyCollector) In(op model.IExpression, arr []model.IExpression) interface{} {
+	return c.visit(append([]model.IExpression{op}, arr...)...)
+}
+
+func (c *anyCollector) And(operands []model.IExpression) interface{} { return c.visit(operands...) }
+func (c *anyCollector) Or(operands []model.IExpression) interface{}  { return c.visit(operands...) }
+
+func (c *anyCollector) Any(localModel model.IModel, relationName string, filter model.IExpression) interface{} {
+	if relation := localModel.GetRelation(relationName); relation != nil {
+		c.ids[relation.ExtModel.GetId()] = struct{}{}
+		if relation.JunctionModel != nil {
+			c.ids[relation.JunctionModel.GetId()] = struct{}{}
+		}
+	}
+
+	return c.visit(filter)
+}
+
+func (c *anyCollector) ModelField(model.IModel, string) interface{} { return nil }
+func (c *anyCollector) Value(interface{}) interface{}               { return nil }
+
+func (c *anyCollector) Func(name string, params ...model.IExpression) interface{} {
+	return c.visit(params...)
+}
+
+func (c *anyCollector) Excluded(string) interface{} { return nil }
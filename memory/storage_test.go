@@ -0,0 +1,294 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/go-qbit/model"
+	"github.com/go-qbit/model/conformance"
+	"github.com/go-qbit/model/expr"
+	"github.com/go-qbit/model/memory"
+	"github.com/go-qbit/model/relation"
+	"github.com/go-qbit/model/test"
+)
+
+type StorageTestSuite struct {
+	suite.Suite
+	storage *memory.Storage
+	address *test.Address
+}
+
+func TestStorageTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageTestSuite))
+}
+
+func (s *StorageTestSuite) SetupTest() {
+	s.storage = memory.NewStorage()
+	s.address = test.NewAddress(s.storage)
+
+	s.NoError(s.storage.AddIndex(s.address, "city"))
+	s.NoError(s.storage.AddOrderedIndex(s.address, "address"))
+
+	_, err := s.address.AddMulti(context.Background(), model.NewData(
+		[]string{"id", "country", "city", "address"},
+		[][]interface{}{
+			{100, "USA", "Arlington", "1022 Bridges Dr"},
+			{200, "USA", "Fort Worth", "7105 Plover Circle"},
+			{300, "USA", "Crowley", "524 Pecan Street"},
+			{400, "USA", "Arlington", "1022 Bridges Dr"},
+			{500, "USA", "Louisville", "1246 Everett Avenue"},
+		}), model.AddOptions{},
+	)
+	s.NoError(err)
+}
+
+func (s *StorageTestSuite) getIds(opts model.GetAllOptions) []interface{} {
+	data, err := s.address.GetAll(context.Background(), []string{"id"}, opts)
+	s.Require().NoError(err)
+
+	res := make([]interface{}, data.Len())
+	for i, row := range data.Data() {
+		res[i] = row[0]
+	}
+
+	return res
+}
+
+func (s *StorageTestSuite) TestStorage_PrimaryKey() {
+	_, err := s.address.AddMulti(context.Background(), model.NewData(
+		[]string{"id", "country"},
+		[][]interface{}{{600, "USA"}, {100, "Canada"}},
+	), model.AddOptions{})
+	s.Error(err)
+	s.Equal([]interface{}{100, 200, 300, 400, 500}, s.getIds(model.GetAllOptions{}), "Nothing must be added")
+
+	pk, err := s.address.AddMulti(context.Background(), model.NewData(
+		[]string{"id", "country"},
+		[][]interface{}{{600, "USA"}, {100, "Canada"}, {nil, "Mexico"}},
+	), model.AddOptions{Replace: true})
+	s.NoError(err)
+	s.Equal([][]interface{}{{600}, {100}, {601}}, pk.Data())
+
+	data, err := s.address.GetAll(context.Background(), []string{"id", "country", "city"}, model.GetAllOptions{
+		Filter: expr.Eq(expr.ModelField(s.address, "id"), expr.Value(100)),
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"id": 100, "country": "Canada"}}, data.Maps())
+
+	s.Error(s.address.Edit(context.Background(), expr.Eq(expr.ModelField(s.address, "id"), expr.Value(200)), map[string]interface{}{"id": 300}))
+	s.Equal([]interface{}{100, 200, 300, 400, 500, 600, 601}, s.getIds(model.GetAllOptions{}))
+}
+
+func (s *StorageTestSuite) TestStorage_Indexes() {
+	s.Equal([]interface{}{100, 400}, s.getIds(model.GetAllOptions{
+		Filter: expr.Eq(expr.ModelField(s.address, "city"), expr.Value("Arlington")),
+	}))
+
+	s.Equal([]interface{}{200, 300}, s.getIds(model.GetAllOptions{
+		Filter: expr.And(
+			expr.Gt(expr.ModelField(s.address, "address"), expr.Value("1246 Everett Avenue")),
+			expr.Le(expr.Value(200), expr.ModelField(s.address, "id")),
+		),
+	}))
+
+	s.NoError(s.address.Edit(context.Background(), expr.Eq(expr.ModelField(s.address, "id"), expr.Value(100)), map[string]interface{}{
+		"city":    "Dallas",
+		"address": "9 Elm Street",
+	}))
+
+	s.Equal([]interface{}{400}, s.getIds(model.GetAllOptions{
+		Filter: expr.Eq(expr.ModelField(s.address, "city"), expr.Value("Arlington")),
+	}))
+	s.Equal([]interface{}{100, 200}, s.getIds(model.GetAllOptions{
+		Filter: expr.Ge(expr.ModelField(s.address, "address"), expr.Value("7")),
+	}))
+
+	s.NoError(s.address.Delete(context.Background(), expr.Eq(expr.ModelField(s.address, "city"), expr.Value("Fort Worth"))))
+	s.Equal([]interface{}{100}, s.getIds(model.GetAllOptions{
+		Filter: expr.Ge(expr.ModelField(s.address, "address"), expr.Value("7")),
+	}))
+
+	s.NoError(s.address.Delete(context.Background(), expr.Eq(expr.ModelField(s.address, "id"), expr.Value(300))))
+	s.Equal([]interface{}{400, 500}, s.getIds(model.GetAllOptions{
+		Filter: expr.Lt(expr.ModelField(s.address, "address"), expr.Value("5")),
+	}))
+	s.Equal([]interface{}{400}, s.getIds(model.GetAllOptions{
+		Filter: expr.Eq(expr.ModelField(s.address, "city"), expr.Value("Arlington")),
+	}))
+	s.Equal([]interface{}{500}, s.getIds(model.GetAllOptions{
+		Filter: expr.Eq(expr.ModelField(s.address, "id"), expr.Value(500)),
+	}))
+
+	_, err := s.address.AddMulti(context.Background(), model.NewData(
+		[]string{"id", "country", "city", "address"},
+		[][]interface{}{
+			{600, "USA", "Arlington", "3 Oak Lane"},
+			{700, "USA", "Austin", "2 Oak Lane"},
+		}), model.AddOptions{},
+	)
+	s.NoError(err)
+	s.Equal([]interface{}{400, 500, 600, 700}, s.getIds(model.GetAllOptions{
+		Filter: expr.Lt(expr.ModelField(s.address, "address"), expr.Value("5")),
+	}))
+	s.Equal([]interface{}{400, 600}, s.getIds(model.GetAllOptions{
+		Filter: expr.Eq(expr.ModelField(s.address, "city"), expr.Value("Arlington")),
+	}))
+}
+
+func (s *StorageTestSuite) TestStorage_IndexLookupValue() {
+	ctx := context.Background()
+
+	event := model.NewBaseModel("event", []model.IFieldDefinition{
+		&model.IntField{Id: "id", Caption: "ID"},
+		&model.TimeField{Id: "at", Caption: "At"},
+	}, s.storage, model.BaseModelOpts{PkFieldsNames: []string{"id"}})
+	s.Require().NoError(s.storage.AddIndex(event, "at"))
+
+	_, err := event.AddMulti(ctx, model.NewData([]string{"id", "at"}, [][]interface{}{
+		{1, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{2, time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC)},
+	}), model.AddOptions{})
+	s.Require().NoError(err)
+
+	for _, value := range []interface{}{"2020-01-02 03:04:05", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)} {
+		data, err := event.GetAll(ctx, []string{"id"}, model.GetAllOptions{
+			Filter: expr.Eq(expr.ModelField(event, "at"), expr.Value(value)),
+		})
+		s.NoError(err)
+		s.Equal([]map[string]interface{}{{"id": 1}}, data.Maps())
+	}
+
+	data, err := event.GetAll(ctx, []string{"id"}, model.GetAllOptions{
+		Filter: expr.Eq(expr.ModelField(event, "id"), expr.Value(2.0)),
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"id": 2}}, data.Maps())
+}
+
+func (s *StorageTestSuite) TestStorage_UpsertAny() {
+	ctx := context.Background()
+
+	user := test.NewUser(s.storage)
+	relation.AddManyToOne(s.address, user, relation.WithAlias("owner"))
+
+	memory.RegisterFunc("test_if", func(args ...interface{}) (interface{}, error) {
+		if args[0] == true {
+			return args[1], nil
+		}
+		return args[2], nil
+	})
+
+	_, err := user.AddMulti(ctx, model.NewData([]string{"id", "name", "lastname"}, [][]interface{}{
+		{1, "Ivan", "Sidorov"},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	s.NoError(s.address.Edit(ctx, expr.Eq(expr.ModelField(s.address, "id"), expr.Value(100)), map[string]interface{}{"fk_owner_id": 1}))
+
+	_, err = s.address.AddMulti(ctx, model.NewData([]string{"id", "country", "city"}, [][]interface{}{
+		{100, "USA", "Moscow"},
+		{200, "USA", "Tver"},
+	}), model.AddOptions{OnConflict: &model.OnConflict{Update: map[string]model.IExpression{
+		"city": expr.Func("test_if",
+			expr.Any(s.address, "owner", expr.Eq(expr.ModelField(user, "name"), expr.Value("Ivan"))),
+			expr.Excluded("city"),
+			expr.ModelField(s.address, "city"),
+		),
+	}}})
+	s.NoError(err)
+
+	data, err := s.address.GetAll(ctx, []string{"id", "country", "city"}, model.GetAllOptions{
+		Filter:  expr.Le(expr.ModelField(s.address, "id"), expr.Value(200)),
+		OrderBy: []model.Order{{FieldName: "id"}},
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{
+		{"id": 100, "country": "USA", "city": "Moscow"},
+		{"id": 200, "country": "USA", "city": "Fort Worth"},
+	}, data.Maps())
+}
+
+func (s *StorageTestSuite) TestStorage_Transaction() {
+	ctx := context.Background()
+	user := test.NewUser(s.storage)
+	errRollback := errors.New("rollback")
+
+	written := make(chan struct{})
+	userAdded := make(chan error)
+	addressAdded := make(chan error, 1)
+
+	s.Equal(errRollback, s.storage.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := s.address.Delete(ctx, expr.Eq(expr.ModelField(s.address, "id"), expr.Value(100))); err != nil {
+			return err
+		}
+
+		// The changes of the other tables are not blocked by the transaction
+		go func() {
+			_, err := user.AddMulti(context.Background(), model.NewData([]string{"id", "name", "lastname"}, [][]interface{}{
+				{1, "Ivan", "Sidorov"},
+			}), model.AddOptions{})
+			userAdded <- err
+		}()
+		if err := <-userAdded; err != nil {
+			return err
+		}
+
+		// The changes of the table changed in the transaction wait for its end
+		go func() {
+			close(written)
+			_, err := s.address.AddMulti(context.Background(), model.NewData([]string{"id", "country"}, [][]interface{}{
+				{600, "USA"},
+			}), model.AddOptions{})
+			addressAdded <- err
+		}()
+		<-written
+
+		select {
+		case err := <-addressAdded:
+			s.Failf("The change is not blocked", "Error: %v", err)
+			addressAdded <- err
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		return errRollback
+	}))
+
+	s.NoError(<-addressAdded)
+	s.Equal([]interface{}{100, 200, 300, 400, 500, 600}, s.getIds(model.GetAllOptions{}))
+
+	n, err := user.Count(ctx, nil)
+	s.NoError(err)
+	s.Equal(uint64(1), n)
+}
+
+func (s *StorageTestSuite) TestStorage_Options() {
+	var total uint64
+
+	s.Equal([]interface{}{300, 100}, s.getIds(model.GetAllOptions{
+		OrderBy:     []model.Order{{FieldName: "city", Desc: true}, {FieldName: "id"}},
+		Offset:      2,
+		Limit:       2,
+		RowsWoLimit: &total,
+	}))
+	s.Equal(uint64(5), total)
+
+	data, err := s.address.GetAll(context.Background(), []string{"city", "address"}, model.GetAllOptions{
+		Distinct: true,
+		OrderBy:  []model.Order{{FieldName: "city"}},
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{
+		{"city": "Arlington", "address": "1022 Bridges Dr"},
+		{"city": "Crowley", "address": "524 Pecan Street"},
+		{"city": "Fort Worth", "address": "7105 Plover Circle"},
+		{"city": "Louisville", "address": "1246 Everett Avenue"},
+	}, data.Maps())
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func() model.IStorage { return memory.NewStorage() })
+}
@@ -0,0 +1,702 @@
+package memory
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-qbit/model"
+)
+
+type DataRow map[string]interface{}
+
+func (r DataRow) GetValue(name string) (interface{}, error) {
+	return r[name], nil
+}
+
+func (r DataRow) SetValue(name string, value interface{}) error {
+	r[name] = value
+	return nil
+}
+
+type duplicateKeyError struct {
+	key string
+}
+
+func (e *duplicateKeyError) Error() string {
+	return "Duplicate primary key '" + e.key + "'"
+}
+
+type table struct {
+	mtx           sync.RWMutex
+	model         model.IModel
+	rows          []DataRow
+	pk            map[string]int
+	uniques       []map[string]int // Positions of the rows by the unique keys values
+	indexes       []*index
+	autoIncrement int64
+	tx            *transaction // The transaction which changed the table
+}
+
+func newTable(m model.IModel) *table {
+	return &table{
+		model:   m,
+		pk:      make(map[string]int),
+		uniques: newUniques(m, 0),
+	}
+}
+
+func (t *table) pkKey(row DataRow) string {
+	return rowKey(row, t.model.GetPKFieldsNames())
+}
+
+// rebuild recreates the primary key and the secondary indexes after changing or deleting rows
+func (t *table) rebuild() error {
+	pk := make(map[string]int, len(t.rows))
+	if len(t.model.GetPKFieldsNames()) > 0 {
+		for i, row := range t.rows {
+			key := t.pkKey(row)
+			if _, exists := pk[key]; exists {
+				return &duplicateKeyError{key}
+			}
+			pk[key] = i
+		}
+	}
+	t.pk = pk
+
+	uniques := newUniques(t.model, len(t.rows))
+	for i, fieldsNames := range t.model.GetUniqueKeys() {
+		for pos, row := range t.rows {
+			key, ok := conflictKey(row, fieldsNames)
+			if !ok {
+				continue
+			}
+			if _, exists := uniques[i][key]; exists {
+				return uniqueViolation(t.model, fieldsNames)
+			}
+			uniques[i][key] = pos
+		}
+	}
+	t.uniques = uniques
+
+	for _, idx := range t.indexes {
+		if err := idx.build(t.rows); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isIndexed checks if any of the fields is a part of the primary key or of a secondary index
+func (t *table) isIndexed(fieldsNames map[string]interface{}) bool {
+	for _, pkFieldName := range t.model.GetPKFieldsNames() {
+		if _, exists := fieldsNames[pkFieldName]; exists {
+			return true
+		}
+	}
+
+	for _, idx := range t.indexes {
+		for _, fieldName := range idx.fields {
+			if _, exists := fieldsNames[fieldName]; exists {
+				return true
+			}
+		}
+	}
+
+	for _, key := range t.model.GetUniqueKeys() {
+		for _, fieldName := range key {
+			if _, exists := fieldsNames[fieldName]; exists {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// checkUnique checks that the new rows have no the same unique keys values as the table rows and each other
+func (t *table) checkUnique(rows []DataRow) error {
+	for i, fieldsNames := range t.model.GetUniqueKeys() {
+		keys := make(map[string]struct{}, len(rows))
+		for _, row := range rows {
+			key, ok := conflictKey(row, fieldsNames)
+			if !ok {
+				continue
+			}
+
+			_, exists := t.uniques[i][key]
+			_, duplicate := keys[key]
+			if exists || duplicate {
+				return uniqueViolation(t.model, fieldsNames)
+			}
+			keys[key] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
+// append adds the rows to the end of the table and to the primary key and the indexes
+func (t *table) append(rows ...DataRow) error {
+	positions := make([]int, len(rows))
+	for i, row := range rows {
+		t.rows = append(t.rows, row)
+		pos := len(t.rows) - 1
+		positions[i] = pos
+
+		if len(t.model.GetPKFieldsNames()) > 0 {
+			t.pk[t.pkKey(row)] = pos
+		}
+
+		for i, fieldsNames := range t.model.GetUniqueKeys() {
+			if key, ok := conflictKey(row, fieldsNames); ok {
+				t.uniques[i][key] = pos
+			}
+		}
+	}
+
+	for _, idx := range t.indexes {
+		if err := idx.add(t.rows, positions); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// remove removes the rows at the positions, the positions in the primary key and the indexes are shifted instead of rebuilding them
+func (t *table) remove(positions []int) {
+	deleted := make(map[int]struct{}, len(positions))
+	for _, pos := range positions {
+		deleted[pos] = struct{}{}
+	}
+
+	// The new positions of the rows, it is -1 for the deleted rows
+	newPositions := make([]int, len(t.rows))
+	rows := make([]DataRow, 0, len(t.rows)-len(deleted))
+	for pos, row := range t.rows {
+		if _, exists := deleted[pos]; exists {
+			newPositions[pos] = -1
+			continue
+		}
+		newPositions[pos] = len(rows)
+		rows = append(rows, row)
+	}
+	t.rows = rows
+
+	remap := func(positions map[string]int) {
+		for key, pos := range positions {
+			if newPositions[pos] < 0 {
+				delete(positions, key)
+			} else {
+				positions[key] = newPositions[pos]
+			}
+		}
+	}
+
+	remap(t.pk)
+	for _, unique := range t.uniques {
+		remap(unique)
+	}
+
+	for _, idx := range t.indexes {
+		idx.remap(newPositions)
+	}
+}
+
+// find returns positions of the rows matched the filter in the insertion order
+func (t *table) find(p *ExprProcessor, filter model.IExpression) ([]int, error) {
+	if filter == nil {
+		res := make([]int, len(t.rows))
+		for i := range t.rows {
+			res[i] = i
+		}
+		return res, nil
+	}
+
+	c := filter.GetProcessor(&planner{t}).(*candidates)
+
+	var res []int
+	check := func(pos int) error {
+		matched, err := evalBool(p, filter, t.rows[pos])
+		if err != nil {
+			return err
+		}
+		if matched {
+			res = append(res, pos)
+		}
+		return nil
+	}
+
+	if c.all {
+		for pos := range t.rows {
+			if err := check(pos); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for _, pos := range c.positions {
+			if err := check(pos); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return res, nil
+}
+
+func (t *table) getIndex(fieldName string, ordered bool) *index {
+	for _, idx := range t.indexes {
+		if idx.ordered == ordered && len(idx.fields) == 1 && idx.fields[0] == fieldName {
+			return idx
+		}
+	}
+
+	if !ordered {
+		if pkFieldsNames := t.model.GetPKFieldsNames(); len(pkFieldsNames) == 1 && pkFieldsNames[0] == fieldName {
+			return &index{fields: pkFieldsNames, pk: t.pk}
+		}
+	}
+
+	return nil
+}
+
+// index is a secondary index, a hash one is used for equality lookups, an ordered one for ranges
+type index struct {
+	fields  []string
+	ordered bool
+	hash    map[string][]int
+	sorted  []int
+	pk      map[string]int
+}
+
+func (idx *index) build(rows []DataRow) error {
+	idx.hash = make(map[string][]int)
+	idx.sorted = nil
+
+	positions := make([]int, len(rows))
+	for pos := range rows {
+		positions[pos] = pos
+	}
+
+	return idx.add(rows, positions)
+}
+
+// add adds the rows at the positions, the new positions are sorted once and merged into the ordered index
+func (idx *index) add(rows []DataRow, positions []int) error {
+	if !idx.ordered {
+		for _, pos := range positions {
+			key := rowKey(rows[pos], idx.fields)
+			idx.hash[key] = append(idx.hash[key], pos)
+		}
+		return nil
+	}
+
+	added := append([]int(nil), positions...)
+	var err error
+	sort.SliceStable(added, func(i, j int) bool {
+		res, cmpErr := compareForSort(rows[added[i]][idx.fields[0]], rows[added[j]][idx.fields[0]])
+		if cmpErr != nil {
+			err = cmpErr
+		}
+		return res < 0
+	})
+	if err != nil {
+		return err
+	}
+
+	// The equal values are kept in the insertion order
+	sorted := make([]int, 0, len(idx.sorted)+len(added))
+	start := 0
+	for _, pos := range added {
+		end, err := idx.bound(rows, rows[pos][idx.fields[0]], false)
+		if err != nil {
+			return err
+		}
+		sorted = append(append(sorted, idx.sorted[start:end]...), pos)
+		start = end
+	}
+	idx.sorted = append(sorted, idx.sorted[start:]...)
+
+	return nil
+}
+
+// remap changes the positions of the rows to the new ones, the rows with the negative new positions are removed
+func (idx *index) remap(newPositions []int) {
+	filter := func(positions []int) []int {
+		res := positions[:0]
+		for _, pos := range positions {
+			if newPositions[pos] >= 0 {
+				res = append(res, newPositions[pos])
+			}
+		}
+		return res
+	}
+
+	if !idx.ordered {
+		for key, positions := range idx.hash {
+			if positions = filter(positions); len(positions) == 0 {
+				delete(idx.hash, key)
+			} else {
+				idx.hash[key] = positions
+			}
+		}
+		return
+	}
+
+	idx.sorted = filter(idx.sorted)
+}
+
+func (idx *index) lookup(value interface{}) []int {
+	key := valuesKey([]interface{}{value})
+
+	if idx.pk != nil {
+		if pos, exists := idx.pk[key]; exists {
+			return []int{pos}
+		}
+		return nil
+	}
+
+	return idx.hash[key]
+}
+
+// lookupValue converts the value to the type of the field for the hash lookup, false if it cannot be done
+// and the rows must be scanned
+func (t *table) lookupValue(fieldName string, value interface{}) (interface{}, bool) {
+	field := t.model.GetFieldDefinition(fieldName)
+	if isNull(value) || field == nil || field.GetType() == nil {
+		return value, true
+	}
+
+	rt, rv := field.GetType(), deref(value)
+	if rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+
+	switch {
+	case rt == reflect.TypeOf(time.Time{}) && rv.Kind() == reflect.String:
+		tm, err := parseTime(rv.String())
+		if err != nil {
+			return nil, false
+		}
+		return tm, true
+	case rv.Type() == rt, rv.Kind() == rt.Kind() && rt.Kind() != reflect.Struct,
+		isNumber(rv) && isNumber(reflect.New(rt).Elem()):
+		return value, true
+	default:
+		return nil, false
+	}
+}
+
+// bound returns the first position in the sorted index with the value greater (or equal if orEqual) than the given
+func (idx *index) bound(rows []DataRow, value interface{}, orEqual bool) (int, error) {
+	var err error
+	res := sort.Search(len(idx.sorted), func(i int) bool {
+		res, cmpErr := compareForSort(rows[idx.sorted[i]][idx.fields[0]], value)
+		if cmpErr != nil {
+			err = cmpErr
+		}
+		if orEqual {
+			return res >= 0
+		}
+		return res > 0
+	})
+
+	return res, err
+}
+
+type candidates struct {
+	all       bool
+	positions []int
+}
+
+var allCandidates = &candidates{all: true}
+
+func newCandidates(positions []int) *candidates {
+	res := make([]int, len(positions))
+	copy(res, positions)
+	sort.Ints(res)
+
+	return &candidates{positions: res}
+}
+
+type planField struct {
+	name string
+}
+
+type planValue struct {
+	value interface{}
+}
+
+// planner selects rows positions by the indexes, the filter must be checked for every selected row
+type planner struct {
+	t *table
+}
+
+func (p *planner) operands(op1, op2 model.IExpression) (*planField, *planValue, bool) {
+	r1, r2 := op1.GetProcessor(p), op2.GetProcessor(p)
+
+	if f, ok := r1.(*planField); ok {
+		if v, ok := r2.(*planValue); ok {
+			return f, v, false
+		}
+	}
+
+	if f, ok := r2.(*planField); ok {
+		if v, ok := r1.(*planValue); ok {
+			return f, v, true
+		}
+	}
+
+	return nil, nil, false
+}
+
+func (p *planner) Eq(op1, op2 model.IExpression) interface{} {
+	f, v, _ := p.operands(op1, op2)
+	if f == nil {
+		return allCandidates
+	}
+
+	if idx := p.t.getIndex(f.name, false); idx != nil {
+		value, ok := p.t.lookupValue(f.name, v.value)
+		if !ok {
+			return allCandidates
+		}
+		return newCandidates(idx.lookup(value))
+	}
+
+	return p.rangeCandidates(f, v, "=")
+}
+
+func (p *planner) Ne(op1, op2 model.IExpression) interface{} { return allCandidates }
+
+func (p *planner) compare(op1, op2 model.IExpression, op, swappedOp string) interface{} {
+	f, v, swapped := p.operands(op1, op2)
+	if f == nil {
+		return allCandidates
+	}
+
+	if swapped {
+		op = swappedOp
+	}
+
+	return p.rangeCandidates(f, v, op)
+}
+
+func (p *planner) Lt(op1, op2 model.IExpression) interface{} { return p.compare(op1, op2, "<", ">") }
+func (p *planner) Le(op1, op2 model.IExpression) interface{} { return p.compare(op1, op2, "<=", ">=") }
+func (p *planner) Gt(op1, op2 model.IExpression) interface{} { return p.compare(op1, op2, ">", "<") }
+func (p *planner) Ge(op1, op2 model.IExpression) interface{} { return p.compare(op1, op2, ">=", "<=") }
+
+func (p *planner) rangeCandidates(f *planField, v *planValue, op string) interface{} {
+	idx := p.t.getIndex(f.name, true)
+	if idx == nil {
+		return allCandidates
+	}
+
+	if isNull(v.value) {
+		if op == "=" {
+			end, err := idx.bound(p.t.rows, nil, false)
+			if err != nil {
+				return allCandidates
+			}
+			return newCandidates(idx.sorted[:end])
+		}
+		return &candidates{}
+	}
+
+	notNull, err1 := idx.bound(p.t.rows, nil, false)
+	lower, err2 := idx.bound(p.t.rows, v.value, true)
+	upper, err3 := idx.bound(p.t.rows, v.value, false)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return allCandidates
+	}
+
+	switch op {
+	case "=":
+		return newCandidates(idx.sorted[lower:upper])
+	case "<":
+		return newCandidates(idx.sorted[notNull:lower])
+	case "<=":
+		return newCandidates(idx.sorted[notNull:upper])
+	case ">":
+		return newCandidates(idx.sorted[upper:])
+	default:
+		return newCandidates(idx.sorted[lower:])
+	}
+}
+
+func (p *planner) In(op model.IExpression, arr []model.IExpression) interface{} {
+	var positions []int
+	for _, value := range arr {
+		c := p.Eq(op, value).(*candidates)
+		if c.all {
+			return allCandidates
+		}
+		positions = append(positions, c.positions...)
+	}
+
+	return newCandidates(uniqInts(positions))
+}
+
+func (p *planner) And(operands []model.IExpression) interface{} {
+	var res *candidates
+
+	for _, op := range operands {
+		c := op.GetProcessor(p).(*candidates)
+		if c.all {
+			continue
+		}
+
+		if res == nil {
+			res = c
+			continue
+		}
+
+		inC := make(map[int]struct{}, len(c.positions))
+		for _, pos := range c.positions {
+			inC[pos] = struct{}{}
+		}
+
+		intersection := make([]int, 0, len(res.positions))
+		for _, pos := range res.positions {
+			if _, exists := inC[pos]; exists {
+				intersection = append(intersection, pos)
+			}
+		}
+		res = &candidates{positions: intersection}
+	}
+
+	if res == nil {
+		return allCandidates
+	}
+
+	return res
+}
+
+func (p *planner) Or(operands []model.IExpression) interface{} {
+	var positions []int
+
+	for _, op := range operands {
+		c := op.GetProcessor(p).(*candidates)
+		if c.all {
+			return allCandidates
+		}
+		positions = append(positions, c.positions...)
+	}
+
+	return newCandidates(uniqInts(positions))
+}
+
+func (p *planner) Any(localModel model.IModel, relationName string, filter model.IExpression) interface{} {
+	return allCandidates
+}
+
+func (p *planner) ModelField(m model.IModel, fieldName string) interface{} {
+	if m.GetId() != p.t.model.GetId() {
+		return allCandidates
+	}
+
+	return &planField{fieldName}
+}
+
+func (p *planner) Value(value interface{}) interface{} {
+	return &planValue{value}
+}
+
+func (p *planner) Func(name string, params ...model.IExpression) interface{} {
+	return allCandidates
+}
+
+func (p *planner) Excluded(fieldName string) interface{} {
+	return allCandidates
+}
+
+func uniqInts(arr []int) []int {
+	uniq := make(map[int]struct{}, len(arr))
+	res := make([]int, 0, len(arr))
+	for _, v := range arr {
+		if _, exists := uniq[v]; !exists {
+			uniq[v] = struct{}{}
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+func rowKey(row DataRow, fieldsNames []string) string {
+	values := make([]interface{}, len(fieldsNames))
+	for i, fieldName := range fieldsNames {
+		values[i] = row[fieldName]
+	}
+
+	return valuesKey(values)
+}
+
+// valuesKey returns a string key of the values, equal values of different numeric types have the same key
+func valuesKey(values []interface{}) string {
+	buf := &strings.Builder{}
+
+	for _, value := range values {
+		if isNull(value) {
+			buf.WriteString("N|")
+			continue
+		}
+
+		rv := deref(value)
+		switch {
+		case isInt(rv):
+			buf.WriteString("i" + strconv.FormatInt(rv.Int(), 10))
+		case isUint(rv):
+			if rv.Uint() <= math.MaxInt64 {
+				buf.WriteString("i" + strconv.FormatUint(rv.Uint(), 10))
+			} else {
+				buf.WriteString("u" + strconv.FormatUint(rv.Uint(), 10))
+			}
+		case rv.Kind() == reflect.Float32 || rv.Kind() == reflect.Float64:
+			if f := rv.Float(); f == math.Trunc(f) && math.Abs(f) < math.MaxInt64 {
+				buf.WriteString("i" + strconv.FormatInt(int64(f), 10))
+			} else {
+				buf.WriteString("f" + strconv.FormatFloat(f, 'g', -1, 64))
+			}
+		case rv.Kind() == reflect.String:
+			buf.WriteString("s" + strconv.Itoa(rv.Len()) + ":" + rv.String())
+		case rv.Kind() == reflect.Bool:
+			buf.WriteString("b" + strconv.FormatBool(rv.Bool()))
+		default:
+			switch v := rv.Interface().(type) {
+			case time.Time:
+				buf.WriteString("t" + strconv.FormatInt(v.UnixNano(), 10))
+			case []byte:
+				buf.WriteString("x" + strconv.Itoa(len(v)) + ":" + string(v))
+			default:
+				s := fmt.Sprintf("%T:%#v", v, v)
+				buf.WriteString("o" + strconv.Itoa(len(s)) + ":" + s)
+			}
+		}
+		buf.WriteByte('|')
+	}
+
+	return buf.String()
+}
+
+func newUniques(m model.IModel, size int) []map[string]int {
+	uniques := make([]map[string]int, len(m.GetUniqueKeys()))
+	for i := range uniques {
+		uniques[i] = make(map[string]int, size)
+	}
+
+	return uniques
+}
+
+func uniqueViolation(m model.IModel, fieldsNames []string) error {
+	return model.UniqueViolationErrorf(fieldsNames, "Duplicate value of unique key '%s' in model '%s'",
+		strings.Join(fieldsNames, ", "), m.GetId())
+}
@@ -7,6 +7,7 @@ import (
 type IModel interface {
 	GetId() string
 	GetPKFieldsNames() []string
+	GetUniqueKeys() [][]string
 	GetFieldsNames() []string
 	GetFieldDefinition(string) IFieldDefinition
 	GetDefaultFilter(context.Context) (IExpression, error)
@@ -14,12 +15,18 @@ type IModel interface {
 	FieldExpr(string) *exprModelFieldS
 	//AddField(IFieldDefinition)
 	AddRelation(Relation, string, []IFieldDefinition)
-	GetRelations() []string
+	GetRelations() []Relation
 	GetRelation(string) *Relation
 	AddMulti(context.Context, *Data, AddOptions) (*Data, error)
 	GetAll(context.Context, []string, GetAllOptions) (*Data, error)
+	GetByKey(context.Context, map[string]interface{}, []string) (*Data, error)
+	CountGroups(context.Context, []string, IExpression) (*Data, error)
+	Count(context.Context, IExpression) (uint64, error)
+	Exists(context.Context, IExpression) (bool, error)
 	Edit(context.Context, IExpression, map[string]interface{}) error
 	Delete(context.Context, IExpression) error
+	EditReturning(context.Context, IExpression, map[string]interface{}, []string) (uint64, *Data, error)
+	DeleteReturning(context.Context, IExpression, []string) (uint64, *Data, error)
 	FieldsToString([]string, map[string]interface{}) string
 }
 
@@ -41,14 +48,25 @@ type IExpressionProcessor interface {
 	In(op IExpression, arr []IExpression) interface{}
 	And(operators []IExpression) interface{}
 	Or(operators []IExpression) interface{}
-	Any(localModel, extModel IModel, filter IExpression) interface{}
+	Any(localModel IModel, relationName string, filter IExpression) interface{}
 	ModelField(model IModel, fieldName string) interface{}
 	Value(value interface{}) interface{}
 	Func(name string, params ...IExpression) interface{}
+	Excluded(fieldName string) interface{}
 }
 
 type AddOptions struct {
-	Replace bool
+	Replace    bool
+	OnConflict *OnConflict // Merge the added rows with the existing ones instead of the error, cannot be used with Replace
+}
+
+// OnConflict describes the merging of the added rows with the existing rows having the same values of the target fields.
+// The fields missed in Update keep the existing values, expr.Excluded refers to the values of the added row, e.g.
+// Update: {"count": expr.Func("add", expr.ModelField(m, "count"), expr.Excluded("count"))}.
+// If Update is empty, the conflicting rows are skipped.
+type OnConflict struct {
+	Target []string               // Fields of the primary or a unique key, the primary key by default
+	Update map[string]IExpression // New values of the existing rows fields
 }
 
 type GetAllOptions struct {
@@ -59,6 +77,11 @@ type GetAllOptions struct {
 	Offset      uint64
 	RowsWoLimit *uint64
 	ForUpdate   bool
+	PartitionBy []string // Limit and Offset are applied to every group of rows with the same values of the fields, see IPartitionStorage
+
+	// Options of the external rows by the relation name. Limit and Offset are applied to the rows of every local row,
+	// ForUpdate and RowsWoLimit are ignored.
+	RelationsOptions map[string]GetAllOptions
 }
 
 type Order struct {
@@ -67,6 +90,7 @@ type Order struct {
 }
 
 type Relation struct {
+	Alias                    string // Name of the relation in the local model, the external model id by default
 	ExtModel                 IModel
 	RelationType             RelationType
 	LocalFieldsNames         []string
@@ -77,6 +101,7 @@ type Relation struct {
 	JunctionFkFieldsNames    []string
 	IsRequired               bool
 	IsBack                   bool
+	OnDelete                 OnDeleteAction // What to do with the external rows on deleting the local one
 }
 
 type RelationType int
@@ -102,3 +127,27 @@ func (r RelationType) String() string {
 		return "Unknown"
 	}
 }
+
+type OnDeleteAction int
+
+const (
+	ON_DELETE_NO_ACTION OnDeleteAction = iota
+	ON_DELETE_CASCADE
+	ON_DELETE_RESTRICT
+	ON_DELETE_SET_NULL
+)
+
+func (a OnDeleteAction) String() string {
+	switch a {
+	case ON_DELETE_NO_ACTION:
+		return "NoAction"
+	case ON_DELETE_CASCADE:
+		return "Cascade"
+	case ON_DELETE_RESTRICT:
+		return "Restrict"
+	case ON_DELETE_SET_NULL:
+		return "SetNull"
+	default:
+		return "Unknown"
+	}
+}
@@ -2,8 +2,11 @@ package model_test
 
 import (
 	"context"
-	"sort"
+	"errors"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-qbit/timelog"
 
@@ -90,7 +93,7 @@ func (s *ModelTestSuite) SetupTest() {
 	)
 	s.NoError(err)
 
-	s.NoError(s.user.Link(context.Background(), s.address, []model.ModelLink{
+	s.NoError(s.user.Link(context.Background(), "address", []model.ModelLink{
 		{[]interface{}{1}, [][]interface{}{{100}, {200}}},
 		{[]interface{}{2}, [][]interface{}{{200}, {300}}},
 		{[]interface{}{3}, [][]interface{}{{300}}},
@@ -120,13 +123,81 @@ func (s *ModelTestSuite) TestModel_GetFieldsNames() {
 }
 
 func (s *ModelTestSuite) TestModel_GetRelations() {
+	s.Equal([]string{"address", "message", "phone"}, relationsAliases(s.user))
+
 	relations := s.user.GetRelations()
-	sort.Strings(relations)
+	s.Equal(model.RELATION_MANY_TO_MANY, relations[0].RelationType)
+	s.Equal(model.RELATION_ONE_TO_MANY, relations[1].RelationType)
+	s.Equal([]string{"fk_user_id"}, relations[1].FkFieldsNames)
+	s.Equal(model.RELATION_ONE_TO_ONE, relations[2].RelationType)
+}
 
-	s.Equal(
-		[]string{"address", "message", "phone"},
-		relations,
-	)
+func (s *ModelTestSuite) TestRelation_SamePair() {
+	ctx := context.Background()
+
+	storage := test.NewStorage()
+	user, message := test.NewUser(storage), test.NewMessage(storage)
+	relation.AddManyToOne(message, user, relation.WithAlias("author"), relation.WithBackAlias("sent"))
+	relation.AddManyToOne(message, user, relation.WithAlias("recipient"), relation.WithBackAlias("received"))
+
+	s.Equal([]string{"author", "recipient"}, relationsAliases(message))
+	s.Equal([]string{"received", "sent"}, relationsAliases(user))
+	s.Equal([]string{"fk_recipient_id"}, message.GetRelation("recipient").LocalFieldsNames)
+	s.Panics(func() {
+		relation.AddManyToOne(message, user, relation.WithAlias("author"))
+	})
+
+	_, err := user.AddMulti(ctx, model.NewData([]string{"id", "name", "lastname"}, [][]interface{}{
+		{1, "Ivan", "Sidorov"},
+		{2, "Petr", "Ivanov"},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	_, err = message.AddMulti(ctx, model.NewData([]string{"id", "text", "fk_author_id", "fk_recipient_id"}, [][]interface{}{
+		{10, "Hi", 1, 2},
+		{20, "Hello", 2, 2},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	s.Equal([]interface{}{1}, s.linkedIds(user, "sent", "text", "Hi"))
+	s.Equal([]interface{}{2}, s.linkedIds(user, "received", "text", "Hi"))
+
+	data, err := message.GetAll(ctx, []string{"id", "author.name", "recipient.name"}, model.GetAllOptions{
+		OrderBy: []model.Order{{FieldName: "id"}},
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{
+		{"id": 10, "author": map[string]interface{}{"name": "Ivan"}, "recipient": map[string]interface{}{"name": "Petr"}},
+		{"id": 20, "author": map[string]interface{}{"name": "Petr"}, "recipient": map[string]interface{}{"name": "Petr"}},
+	}, data.Maps())
+
+	s.Error(model.Validate(message, expr.Any(message, "user", nil)))
+
+	relation.AddManyToMany(user, user, storage, relation.WithAlias("friends"), relation.WithBackAlias("friend_of"))
+	s.Equal([]string{"fk_friends_id"}, user.GetRelation("friends").JunctionFkFieldsNames)
+	s.NoError(user.Link(ctx, "friends", []model.ModelLink{{Pk: []interface{}{1}, Fks: [][]interface{}{{2}}}}))
+	s.Equal([]interface{}{1}, s.linkedIds(user, "friends", "id", 2))
+	s.Equal([]interface{}{2}, s.linkedIds(user, "friend_of", "id", 1))
+
+	// The aliases do not change the junction names until the relations collide
+	address := test.NewAddress(storage)
+	relation.AddManyToMany(user, address, storage, relation.WithAlias("home"), relation.WithBackAlias("residents"))
+	s.Equal("_junction__user__address", user.GetRelation("home").JunctionModel.GetId())
+	s.Equal([]string{"fk_address_id"}, user.GetRelation("home").JunctionFkFieldsNames)
+
+	relation.AddManyToMany(user, address, storage, relation.WithAlias("work"), relation.WithBackAlias("workers"))
+	s.Equal("_junction__user__work", user.GetRelation("work").JunctionModel.GetId())
+	s.Equal([]string{"fk_workers_id"}, user.GetRelation("work").JunctionLocalFieldsNames)
+	s.Equal([]string{"fk_work_id"}, user.GetRelation("work").JunctionFkFieldsNames)
+}
+
+func relationsAliases(m model.IModel) []string {
+	var res []string
+	for _, relation := range m.GetRelations() {
+		res = append(res, relation.Alias)
+	}
+
+	return res
 }
 
 func (s *ModelTestSuite) TestModel_GetAll() {
@@ -282,6 +353,348 @@ func (s *ModelTestSuite) TestModel_GetAllToStruct() {
 	)
 }
 
+func (s *ModelTestSuite) TestModel_GetAllRelationsOptions() {
+	ctx := context.Background()
+
+	data, err := s.user.GetAll(ctx, []string{"id", "message.id", "address.id"}, model.GetAllOptions{
+		Filter:  expr.Lt(s.user.FieldExpr("id"), expr.Value(3)),
+		OrderBy: []model.Order{{FieldName: "id"}},
+		RelationsOptions: map[string]model.GetAllOptions{
+			"message": {
+				Filter:  expr.Ne(s.message.FieldExpr("id"), expr.Value(30)),
+				OrderBy: []model.Order{{FieldName: "id", Desc: true}},
+				Limit:   1,
+			},
+			"address": {
+				OrderBy: []model.Order{{FieldName: "id", Desc: true}},
+				Offset:  1,
+			},
+		},
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{
+		{
+			"id":      1,
+			"message": []map[string]interface{}{{"id": 20}},
+			"address": []map[string]interface{}{{"id": 100}},
+		},
+		{
+			"id":      2,
+			"message": []map[string]interface{}{{"id": 40}},
+			"address": []map[string]interface{}{{"id": 200}},
+		},
+	}, data.Maps())
+
+	data, err = s.message.GetAll(ctx, []string{"id", "user.address.id"}, model.GetAllOptions{
+		Filter: expr.Eq(s.message.FieldExpr("id"), expr.Value(40)),
+		RelationsOptions: map[string]model.GetAllOptions{
+			"user": {RelationsOptions: map[string]model.GetAllOptions{
+				"address": {Filter: expr.Eq(s.address.FieldExpr("city"), expr.Value("Crowley"))},
+			}},
+		},
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{
+		{"id": 40, "user": map[string]interface{}{"address": []map[string]interface{}{{"id": 300}}}},
+	}, data.Maps())
+
+	_, err = s.user.GetAll(ctx, []string{"id"}, model.GetAllOptions{
+		RelationsOptions: map[string]model.GetAllOptions{"unknown": {}},
+	})
+	s.Error(err)
+
+	// The rows of every local row are limited in memory if the storage does not support PartitionBy
+	storage := test.NewStorage()
+	user, message := test.NewUser(storage), test.NewMessage(storageWoPartitions{storage})
+	relation.AddManyToOne(message, user)
+
+	_, err = user.AddMulti(ctx, model.NewData([]string{"id", "name", "lastname"}, [][]interface{}{
+		{1, "Ivan", "Sidorov"},
+		{2, "Petr", "Ivanov"},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	_, err = message.AddMulti(ctx, model.NewData([]string{"id", "text", "fk_user_id"}, [][]interface{}{
+		{10, "Message 1", 1},
+		{20, "Message 2", 1},
+		{30, "Message 3", 1},
+		{40, "Message 4", 2},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	data, err = user.GetAll(ctx, []string{"id", "message.id"}, model.GetAllOptions{
+		OrderBy: []model.Order{{FieldName: "id"}},
+		RelationsOptions: map[string]model.GetAllOptions{
+			"message": {OrderBy: []model.Order{{FieldName: "id", Desc: true}}, Limit: 2},
+		},
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{
+		{"id": 1, "message": []map[string]interface{}{{"id": 30}, {"id": 20}}},
+		{"id": 2, "message": []map[string]interface{}{{"id": 40}}},
+	}, data.Maps())
+}
+
+// storageWoPartitions hides the optional interfaces of the storage and ignores PartitionBy
+type storageWoPartitions struct {
+	model.IStorage
+}
+
+func (s storageWoPartitions) Query(ctx context.Context, m model.IModel, fieldsNames []string, opts model.GetAllOptions) (*model.Data, error) {
+	opts.PartitionBy = nil
+	return s.IStorage.Query(ctx, m, fieldsNames, opts)
+}
+
+func (s *ModelTestSuite) TestModel_GetAllAggregates() {
+	ctx := context.Background()
+
+	data, err := s.user.GetAll(ctx, []string{"id", "message.@count", "phone.@exists", "address.@count"}, model.GetAllOptions{
+		OrderBy: []model.Order{{FieldName: "id"}},
+		Filter:  expr.Lt(s.user.FieldExpr("id"), expr.Value(4)),
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{
+		{"id": 1, "message.@count": uint64(3), "phone.@exists": true, "address.@count": uint64(2)},
+		{"id": 2, "message.@count": uint64(1), "phone.@exists": false, "address.@count": uint64(2)},
+		{"id": 3, "message.@count": uint64(0), "phone.@exists": true, "address.@count": uint64(1)},
+	}, data.Maps())
+
+	data, err = s.user.GetAll(ctx, []string{"id", "message.@exists", "address.@count"}, model.GetAllOptions{
+		Filter: expr.Eq(s.user.FieldExpr("id"), expr.Value(1)),
+		RelationsOptions: map[string]model.GetAllOptions{
+			"message": {Filter: expr.Eq(s.message.FieldExpr("id"), expr.Value(40))},
+			"address": {Filter: expr.Eq(s.address.FieldExpr("city"), expr.Value("Arlington"))},
+		},
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{
+		{"id": 1, "message.@exists": false, "address.@count": uint64(1)},
+	}, data.Maps())
+
+	var res []struct {
+		Id            int
+		MessagesCount int  `field:"message.@count"`
+		HasPhone      bool `field:"phone.@exists"`
+	}
+	s.NoError(s.user.GetAllToStruct(ctx, &res, model.GetAllOptions{
+		Filter: expr.Eq(s.user.FieldExpr("id"), expr.Value(1)),
+	}))
+	s.Equal(3, res[0].MessagesCount)
+	s.True(res[0].HasPhone)
+
+	// The numbers are not converted to strings
+	var invalidRes []struct {
+		MessagesCount string `field:"message.@count"`
+	}
+	s.Error(s.user.GetAllToStruct(ctx, &invalidRes, model.GetAllOptions{
+		Filter: expr.Eq(s.user.FieldExpr("id"), expr.Value(1)),
+	}))
+
+	counts, err := s.message.CountGroups(ctx, []string{"fk_user_id"}, nil)
+	s.NoError(err)
+	s.ElementsMatch([][]interface{}{{1, uint64(3)}, {2, uint64(1)}}, counts.GetFieldsData([]string{"fk_user_id", model.AGGREGATE_COUNT}).Data())
+
+	_, err = s.user.GetAll(ctx, []string{"unknown.@count"}, model.GetAllOptions{})
+	s.Error(err)
+
+	// The storage without the aggregate capability
+	group := test.NewGroup(struct{ model.IStorage }{test.NewStorage()})
+	_, err = group.AddMulti(ctx, model.NewData([]string{"id", "name"}, [][]interface{}{
+		{1, "Admins"}, {2, "Users"}, {3, "Users"},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	counts, err = group.CountGroups(ctx, []string{"name"}, expr.Gt(group.FieldExpr("id"), expr.Value(1)))
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"name": "Users", model.AGGREGATE_COUNT: uint64(2)}}, counts.Maps())
+}
+
+// barrierStorage blocks the queries of the models until all of them are started
+type barrierStorage struct {
+	*test.Storage
+	models map[string]struct{}
+	wg     sync.WaitGroup
+}
+
+func (s *barrierStorage) Query(ctx context.Context, m model.IModel, fieldsNames []string, opts model.GetAllOptions) (*model.Data, error) {
+	if _, exists := s.models[m.GetId()]; exists {
+		s.wg.Done()
+
+		done := make(chan struct{})
+		go func() {
+			s.wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			return nil, errors.New("the queries are not concurrent")
+		}
+	}
+
+	return s.Storage.Query(ctx, m, fieldsNames, opts)
+}
+
+func (s *ModelTestSuite) TestModel_GetAllConcurrent() {
+	ctx := context.Background()
+
+	storage := &barrierStorage{Storage: test.NewStorage(), models: map[string]struct{}{"phone": {}, "message": {}}}
+	storage.wg.Add(2)
+
+	user, phone, message := test.NewUser(storage), test.NewPhone(storage), test.NewMessage(storage)
+	relation.AddOneToOne(phone, user)
+	relation.AddManyToOne(message, user)
+
+	_, err := user.AddMulti(ctx, model.NewData([]string{"id", "name", "lastname"}, [][]interface{}{
+		{1, "Ivan", "Sidorov"},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	data, err := user.GetAll(ctx, []string{"id", "phone.id", "message.id"}, model.GetAllOptions{})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"id": 1}}, data.Maps())
+
+	// The error of the first relation by name is returned
+	for i := 0; i < 10; i++ {
+		_, err = s.user.GetAll(ctx, []string{"id", "address.id", "message.id", "phone.id"}, model.GetAllOptions{
+			RelationsOptions: map[string]model.GetAllOptions{
+				"message": {Filter: expr.Eq(s.message.FieldExpr("text"), expr.Value(1))},
+				"phone":   {Filter: expr.Eq(s.phone.FieldExpr("code"), expr.Value("1"))},
+			},
+		})
+		s.Error(err)
+		s.Contains(err.Error(), "message.text")
+	}
+
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = s.user.GetAll(canceledCtx, []string{"id", "message.id"}, model.GetAllOptions{})
+	s.True(errors.Is(err, context.Canceled))
+}
+
+// countingStorage counts the queries by the models and keeps the context of the last query
+type countingStorage struct {
+	*test.Storage
+	mtx     sync.Mutex
+	queries map[string]int
+	lastCtx context.Context
+}
+
+func (s *countingStorage) Query(ctx context.Context, m model.IModel, fieldsNames []string, opts model.GetAllOptions) (*model.Data, error) {
+	s.mtx.Lock()
+	s.queries[m.GetId()]++
+	s.lastCtx = ctx
+	s.mtx.Unlock()
+
+	return s.Storage.Query(ctx, m, fieldsNames, opts)
+}
+
+func (s *ModelTestSuite) TestModel_WithBatching() {
+	storage := &countingStorage{Storage: test.NewStorage(), queries: make(map[string]int)}
+	user, message := test.NewUser(storage), test.NewMessage(storage)
+	relation.AddManyToOne(message, user)
+
+	_, err := user.AddMulti(context.Background(), model.NewData([]string{"id", "name", "lastname"}, [][]interface{}{
+		{1, "Ivan", "Sidorov"},
+		{2, "Petr", "Ivanov"},
+		{3, "James", "Bond"},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	_, err = message.AddMulti(context.Background(), model.NewData([]string{"id", "text", "fk_user_id"}, [][]interface{}{
+		{10, "Message 1", 1},
+		{20, "Message 2", 1},
+		{30, "Message 3", 3},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	ctx := model.WithBatching(context.Background(), 20*time.Millisecond)
+
+	res := make([][]map[string]interface{}, 3)
+	wg := &sync.WaitGroup{}
+	for i := range res {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			data, err := user.GetAll(ctx, []string{"name", "message.id"}, model.GetAllOptions{
+				Filter: expr.Eq(user.FieldExpr("id"), expr.Value(i+1)),
+			})
+			s.NoError(err)
+			res[i] = data.Maps()
+		}(i)
+	}
+	wg.Wait()
+
+	s.Equal([][]map[string]interface{}{
+		{{"name": "Ivan", "message": []map[string]interface{}{{"id": 10}, {"id": 20}}}},
+		{{"name": "Petr"}},
+		{{"name": "James", "message": []map[string]interface{}{{"id": 30}}}},
+	}, res)
+	s.Equal(map[string]int{"user": 1, "message": 1}, storage.queries)
+
+	// Not batched queries
+	_, err = user.GetAll(ctx, []string{"name"}, model.GetAllOptions{Filter: expr.Gt(user.FieldExpr("id"), expr.Value(1))})
+	s.NoError(err)
+	_, err = user.GetAll(ctx, []string{"name"}, model.GetAllOptions{Filter: expr.Eq(user.FieldExpr("id"), expr.Value(1)), Limit: 1})
+	s.NoError(err)
+	s.Equal(3, storage.queries["user"])
+
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = user.GetAll(canceledCtx, []string{"name"}, model.GetAllOptions{Filter: expr.Eq(user.FieldExpr("id"), expr.Value(1))})
+	s.True(errors.Is(err, context.Canceled))
+
+	// The batched query gets the values and the deadline of the callers
+	type requestKey struct{}
+	reqCtx, cancel := context.WithTimeout(
+		context.WithValue(model.WithBatching(context.Background(), 20*time.Millisecond), requestKey{}, "req-1"),
+		time.Minute,
+	)
+	defer cancel()
+	_, err = user.GetAll(reqCtx, []string{"name"}, model.GetAllOptions{Filter: expr.Eq(user.FieldExpr("id"), expr.Value(1))})
+	s.NoError(err)
+	s.Equal(4, storage.queries["user"])
+	s.Equal("req-1", storage.lastCtx.Value(requestKey{}))
+	deadline, ok := storage.lastCtx.Deadline()
+	s.True(ok)
+	reqDeadline, _ := reqCtx.Deadline()
+	s.Equal(reqDeadline, deadline)
+
+	// The values are matched by the field type, the values of other types are not batched
+	event := model.NewBaseModel("event", []model.IFieldDefinition{
+		&model.IntField{Id: "id", Caption: "ID"},
+		&model.TimeField{Id: "at", Caption: "At"},
+	}, storage, model.BaseModelOpts{PkFieldsNames: []string{"id"}})
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	_, err = event.AddMulti(context.Background(), model.NewData([]string{"id", "at"}, [][]interface{}{{1, at}}), model.AddOptions{})
+	s.NoError(err)
+
+	for _, value := range []interface{}{"2020-01-02 03:04:05", at, at.In(time.FixedZone("MSK", 3*60*60))} {
+		data, err := event.GetAll(ctx, []string{"id"}, model.GetAllOptions{
+			Filter: expr.Eq(event.FieldExpr("at"), expr.Value(value)),
+		})
+		s.NoError(err)
+		s.Equal([]map[string]interface{}{{"id": 1}}, data.Maps(), "%v", value)
+	}
+
+	// The queries in transactions are not batched, they would wait for the window
+	ctx = model.WithBatching(context.Background(), time.Hour)
+	s.NoError(storage.RunInTransaction(ctx, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+
+		data, err := user.GetAll(ctx, []string{"name"}, model.GetAllOptions{Filter: expr.Eq(user.FieldExpr("id"), expr.Value(2))})
+		if err != nil {
+			return err
+		}
+		s.Equal([]map[string]interface{}{{"name": "Petr"}}, data.Maps())
+
+		return nil
+	}))
+}
+
 func (s *ModelTestSuite) TestBaseModel_Edit() {
 	err := s.user.Edit(context.Background(), expr.Eq(s.user.FieldExpr("id"), expr.Value(3)), map[string]interface{}{
 		"lastname": "NewName",
@@ -326,3 +739,1285 @@ func (s *ModelTestSuite) TestBaseModel_Delete() {
 		{"id": 5},
 	}, data.Maps())
 }
+
+func (s *ModelTestSuite) TestBaseModel_LinkManyToMany() {
+	ctx := context.Background()
+
+	s.NoError(s.user.Unlink(ctx, "address", []model.ModelLink{
+		{[]interface{}{1}, [][]interface{}{{200}, {500}}},
+	}))
+	s.Equal([]interface{}{2}, s.linkedIds(s.user, "address", "id", 200))
+
+	s.NoError(s.user.SetLinks(ctx, "address", []model.ModelLink{
+		{[]interface{}{2}, [][]interface{}{{300}, {400}}},
+		{[]interface{}{3}, nil},
+	}))
+
+	data, err := s.user.GetAll(ctx, []string{"id", "address.id"}, model.GetAllOptions{
+		Filter: expr.Lt(expr.ModelField(s.user, "id"), expr.Value(4)),
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{
+		{"id": 1, "address": []map[string]interface{}{{"id": 100}}},
+		{"id": 2, "address": []map[string]interface{}{{"id": 300}, {"id": 400}}},
+		{"id": 3},
+	}, data.Maps())
+}
+
+func (s *ModelTestSuite) TestBaseModel_LinkManyToOne() {
+	ctx := context.Background()
+
+	s.NoError(s.message.Link(ctx, "user", []model.ModelLink{
+		{[]interface{}{10}, [][]interface{}{{3}}},
+	}))
+	s.Equal([]interface{}{10}, s.linkedIds(s.message, "user", "id", 3))
+
+	s.NoError(s.message.Unlink(ctx, "user", []model.ModelLink{
+		{[]interface{}{20}, [][]interface{}{{2}}}, // Not linked, ignored
+		{[]interface{}{30}, [][]interface{}{{1}}},
+	}))
+	s.Equal([]interface{}{20}, s.linkedIds(s.message, "user", "id", 1))
+
+	s.NoError(s.message.SetLinks(ctx, "user", []model.ModelLink{
+		{[]interface{}{20}, [][]interface{}{{5}}},
+		{[]interface{}{40}, nil},
+	}))
+	s.Equal([]interface{}{20}, s.linkedIds(s.message, "user", "id", 5))
+	s.Equal([]interface{}{}, s.linkedIds(s.message, "user", "id", 2))
+
+	s.Error(s.message.Link(ctx, "user", []model.ModelLink{
+		{[]interface{}{10}, [][]interface{}{{1}, {2}}},
+	}))
+}
+
+func (s *ModelTestSuite) TestBaseModel_LinkOneToMany() {
+	ctx := context.Background()
+
+	s.NoError(s.user.Link(ctx, "message", []model.ModelLink{
+		{[]interface{}{4}, [][]interface{}{{10}, {40}}},
+	}))
+	s.Equal([]interface{}{4}, s.linkedIds(s.user, "message", "id", 10, 40))
+
+	s.NoError(s.user.Unlink(ctx, "message", []model.ModelLink{
+		{[]interface{}{1}, [][]interface{}{{20}}},
+	}))
+	s.Equal([]interface{}{30}, s.linkedIds(s.message, "user", "id", 1))
+
+	s.NoError(s.user.SetLinks(ctx, "message", []model.ModelLink{
+		{[]interface{}{1}, [][]interface{}{{20}}},
+		{[]interface{}{4}, [][]interface{}{{40}}},
+	}))
+	s.Equal([]interface{}{20}, s.linkedIds(s.message, "user", "id", 1))
+	s.Equal([]interface{}{40}, s.linkedIds(s.message, "user", "id", 4))
+
+	data, err := s.message.GetAll(ctx, []string{"id"}, model.GetAllOptions{
+		Filter: expr.Eq(expr.ModelField(s.message, "fk_user_id"), expr.Value(nil)),
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"id": 10}, {"id": 30}}, data.Maps())
+}
+
+func (s *ModelTestSuite) TestBaseModel_LinkOneToOne() {
+	ctx := context.Background()
+
+	s.NoError(s.phone.Link(ctx, "user", []model.ModelLink{
+		{[]interface{}{1}, [][]interface{}{{1}}},
+	}))
+	s.Error(s.phone.Link(ctx, "user", []model.ModelLink{
+		{[]interface{}{1}, [][]interface{}{{2}}},
+	}))
+	s.Error(s.user.Unlink(ctx, "phone", []model.ModelLink{
+		{[]interface{}{1}, [][]interface{}{{1}}},
+	}))
+}
+
+func (s *ModelTestSuite) TestBaseModel_AddFromStructsNested() {
+	type PhoneType struct {
+		CountryCode int
+		Code        int
+		Number      int
+	}
+
+	type MessageType struct {
+		Id   *int
+		Text string
+	}
+
+	type AddressType struct {
+		Id      *int
+		Country string
+		City    string
+		Address string
+	}
+
+	type UserType struct {
+		Id        *int
+		Name      string
+		Lastname  string
+		Phone     *PhoneType    `field:"phone"`
+		Messages  []MessageType `field:"message"`
+		Addresses []AddressType `field:"address"`
+	}
+
+	ctx := context.Background()
+
+	users := []UserType{
+		{
+			Name:     "Kyle",
+			Lastname: "Reese",
+			Phone:    &PhoneType{7, 777, 7777777},
+			Messages: []MessageType{{Text: "Message 5"}, {Text: "Message 6"}},
+			Addresses: []AddressType{
+				{Country: "USA", City: "Los Angeles", Address: "1984 Tech Noir"},
+			},
+		},
+		{Name: "Miles", Lastname: "Dyson"},
+	}
+
+	pks, err := s.user.AddFromStructs(ctx, users, model.AddOptions{})
+	s.NoError(err)
+	s.Equal([][]interface{}{{6}, {7}}, pks.Data())
+	s.Equal(6, *users[0].Id)
+	s.Equal(41, *users[0].Messages[0].Id)
+	s.Equal(501, *users[0].Addresses[0].Id)
+
+	data, err := s.user.GetAll(ctx, []string{"id", "phone.formated_number", "message.text", "address.city"}, model.GetAllOptions{
+		Filter: expr.Ge(expr.ModelField(s.user, "id"), expr.Value(6)),
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{
+		{
+			"id":      6,
+			"phone":   map[string]interface{}{"formated_number": "+7 (777) 7777777"},
+			"message": []map[string]interface{}{{"text": "Message 5"}, {"text": "Message 6"}},
+			"address": []map[string]interface{}{{"city": "Los Angeles"}},
+		},
+		{"id": 7},
+	}, data.Maps())
+
+	// The referenced row is added before the referencing one
+	messages := []struct {
+		Text string
+		User UserType `field:"user"`
+	}{
+		{"Message 7", UserType{Name: "Marcus", Lastname: "Wright"}},
+	}
+	_, err = s.message.AddFromStructs(ctx, messages, model.AddOptions{})
+	s.NoError(err)
+	s.Equal(8, *messages[0].User.Id)
+	s.Equal([]interface{}{8}, s.linkedIds(s.user, "message", "text", "Message 7"))
+
+	// All the changes are rolled back on error
+	duplicateId := 10
+	_, err = s.user.AddFromStructs(ctx, []UserType{
+		{Name: "T", Lastname: "800", Messages: []MessageType{{&duplicateId, "Message 8"}}, Phone: &PhoneType{8, 888, 8888888}},
+	}, model.AddOptions{})
+	s.Error(err)
+	s.Equal([]interface{}{}, s.linkedIds(s.user, "phone", "code", 888))
+
+	data, err = s.user.GetAll(ctx, []string{"id"}, model.GetAllOptions{
+		Filter: expr.Eq(expr.ModelField(s.user, "name"), expr.Value("T")),
+	})
+	s.NoError(err)
+	s.Equal(0, data.Len())
+
+	// The options are not applied to the nested rows
+	id := 1
+	_, err = s.user.AddFromStructs(ctx, []UserType{
+		{Id: &id, Name: "Ivan", Lastname: "Petrov", Messages: []MessageType{{Text: "Message 9"}}},
+	}, model.AddOptions{OnConflict: &model.OnConflict{
+		Target: []string{"id"},
+		Update: map[string]model.IExpression{"lastname": expr.Excluded("lastname")},
+	}})
+	s.NoError(err)
+	s.Equal([]interface{}{1}, s.linkedIds(s.user, "message", "text", "Message 9"))
+
+	data, err = s.user.GetAll(ctx, []string{"lastname"}, model.GetAllOptions{
+		Filter: expr.Eq(expr.ModelField(s.user, "id"), expr.Value(1)),
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"lastname": "Petrov"}}, data.Maps())
+}
+
+func (s *ModelTestSuite) TestRelation_ManyToManyUsingTable() {
+	ctx := context.Background()
+
+	storage := test.NewStorage()
+	user, group, membership := test.NewUser(storage), test.NewGroup(storage), test.NewMembership(storage)
+	relation.AddManyToManyUsingTable(user, group, membership)
+
+	s.Equal([]string{"group", "user"}, relationsAliases(membership))
+	s.Equal([]string{"fk_user_id", "fk_group_id"}, membership.GetPKFieldsNames())
+
+	_, err := user.AddMulti(ctx, model.NewData([]string{"id", "name", "lastname"}, [][]interface{}{
+		{1, "Ivan", "Sidorov"},
+		{2, "Petr", "Ivanov"},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	_, err = group.AddMulti(ctx, model.NewData([]string{"id", "name"}, [][]interface{}{
+		{10, "Admins"},
+		{20, "Users"},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	s.NoError(user.LinkWithValues(ctx, "group", []model.JunctionLink{
+		{Pk: []interface{}{1}, Fk: []interface{}{10}, Values: map[string]interface{}{"role": "owner"}},
+		{Pk: []interface{}{1}, Fk: []interface{}{20}, Values: map[string]interface{}{"role": "member"}},
+		{Pk: []interface{}{2}, Fk: []interface{}{20}, Values: map[string]interface{}{"role": "admin"}},
+	}))
+	s.NoError(group.Link(ctx, "user", []model.ModelLink{
+		{Pk: []interface{}{10}, Fks: [][]interface{}{{2}}},
+	}))
+
+	data, err := user.GetAll(ctx, []string{"id", "group.name", "group.@role"}, model.GetAllOptions{})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{
+		{"id": 1, "group": []map[string]interface{}{
+			{"name": "Admins", "@role": "owner"},
+			{"name": "Users", "@role": "member"},
+		}},
+		{"id": 2, "group": []map[string]interface{}{
+			{"name": "Admins"},
+			{"name": "Users", "@role": "admin"},
+		}},
+	}, data.Maps())
+
+	type GroupType struct {
+		Name string
+		Role string `field:"@role"`
+	}
+	var res []struct {
+		Id     int
+		Groups []GroupType `field:"group"`
+	}
+	s.NoError(user.GetAllToStruct(ctx, &res, model.GetAllOptions{
+		Filter: expr.Eq(expr.ModelField(user, "id"), expr.Value(1)),
+	}))
+	s.Equal([]GroupType{{"Admins", "owner"}, {"Users", "member"}}, res[0].Groups)
+
+	data, err = group.GetAll(ctx, []string{"id", "user.name"}, model.GetAllOptions{
+		Filter: expr.Any(group, "user", expr.Eq(expr.ModelField(user, "id"), expr.Value(1))),
+	})
+	s.NoError(err)
+	s.Equal(2, data.Len())
+
+	_, err = user.GetAll(ctx, []string{"id", "group.@unknown"}, model.GetAllOptions{})
+	s.Error(err)
+	_, err = membership.GetAll(ctx, []string{"role", "user.@role"}, model.GetAllOptions{})
+	s.Error(err)
+}
+
+func (s *ModelTestSuite) TestRelation_Recursive() {
+	ctx := context.Background()
+
+	category := test.NewCategory(test.NewStorage())
+	relation.AddManyToOne(category, category, relation.WithAlias("parent"), relation.WithBackAlias("children"))
+
+	s.Equal([]string{"children", "parent"}, relationsAliases(category))
+	s.Panics(func() {
+		relation.AddManyToOne(category, category)
+	})
+
+	_, err := category.AddMulti(ctx, model.NewData([]string{"id", "name", "fk_parent_id"}, [][]interface{}{
+		{1, "Root", nil},
+		{2, "Books", 1},
+		{3, "Music", 1},
+		{4, "Fiction", 2},
+		{5, "Fantasy", 4},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	byId := func(id int) model.GetAllOptions {
+		return model.GetAllOptions{Filter: expr.Eq(category.FieldExpr("id"), expr.Value(id))}
+	}
+
+	data, err := category.GetAll(ctx, []string{"name", "children*2.name"}, byId(1))
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{
+		{"name": "Root", "children": []map[string]interface{}{
+			{"name": "Books", "children": []map[string]interface{}{
+				{"name": "Fiction"},
+			}},
+			{"name": "Music"},
+		}},
+	}, data.Maps())
+
+	data, err = category.GetAll(ctx, []string{"name", "parent*.name"}, byId(5))
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{
+		{"name": "Fantasy", "parent": map[string]interface{}{
+			"name": "Fiction", "parent": map[string]interface{}{
+				"name": "Books", "parent": map[string]interface{}{
+					"name": "Root",
+				},
+			},
+		}},
+	}, data.Maps())
+
+	type Node struct {
+		Name     string
+		Children []Node `field:"children*"`
+	}
+	var tree []Node
+	s.NoError(category.GetAllToStruct(ctx, &tree, byId(2)))
+	s.Equal([]Node{{"Books", []Node{{"Fiction", []Node{{"Fantasy", nil}}}}}}, tree)
+
+	// Cycle
+	s.NoError(category.Edit(ctx, expr.Eq(category.FieldExpr("id"), expr.Value(1)), map[string]interface{}{"fk_parent_id": 5}))
+	data, err = category.GetAll(ctx, []string{"id", "children*.id"}, byId(4))
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{
+		{"id": 4, "children": []map[string]interface{}{
+			{"id": 5, "children": []map[string]interface{}{
+				{"id": 1, "children": []map[string]interface{}{
+					{"id": 2, "children": []map[string]interface{}{
+						{"id": 4},
+					}},
+					{"id": 3},
+				}},
+			}},
+		}},
+	}, data.Maps())
+
+	type InvalidNode struct {
+		Name     string
+		Children []InvalidNode `field:"children"`
+	}
+	var invalid []InvalidNode
+	s.Error(category.GetAllToStruct(ctx, &invalid, byId(1)))
+	_, err = category.GetAll(ctx, []string{"name", "children*0.name"}, byId(1))
+	s.Error(err)
+	_, err = s.user.GetAll(ctx, []string{"name", "message*.text"}, model.GetAllOptions{})
+	s.Error(err)
+}
+
+func (s *ModelTestSuite) TestBaseModel_DeleteJunctionLinks() {
+	junction := s.user.GetRelation("address").JunctionModel
+
+	s.NoError(s.user.Delete(context.Background(), expr.Eq(s.user.FieldExpr("id"), expr.Value(1))))
+
+	data, err := junction.GetAll(context.Background(), []string{"fk_user_id"}, model.GetAllOptions{
+		Filter: expr.Eq(expr.ModelField(junction, "fk_user_id"), expr.Value(1)),
+	})
+	s.NoError(err)
+	s.Equal(0, data.Len())
+}
+
+func (s *ModelTestSuite) TestBaseModel_OnDelete() {
+	ctx := context.Background()
+
+	storage := test.NewStorage()
+	user, phone, message := test.NewUser(storage), test.NewPhone(storage), test.NewMessage(storage)
+	relation.AddOneToOne(phone, user, relation.WithOnDelete(relation.Cascade))
+	relation.AddManyToOne(message, user, relation.WithOnDelete(relation.SetNull))
+
+	_, err := user.AddMulti(ctx, model.NewData([]string{"id", "name", "lastname"}, [][]interface{}{
+		{1, "Ivan", "Sidorov"},
+		{2, "Petr", "Ivanov"},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	_, err = phone.AddMulti(ctx, model.NewData([]string{"id", "country_code", "code", "number"}, [][]interface{}{
+		{1, 1, 111, 1111111},
+		{2, 2, 222, 2222222},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	_, err = message.AddMulti(ctx, model.NewData([]string{"id", "text", "fk_user_id"}, [][]interface{}{
+		{10, "Message 1", 1},
+		{20, "Message 2", 2},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	s.NoError(user.Delete(ctx, expr.Eq(user.FieldExpr("id"), expr.Value(1))))
+
+	data, err := phone.GetAll(ctx, []string{"id"}, model.GetAllOptions{})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"id": 2}}, data.Maps())
+
+	data, err = message.GetAll(ctx, []string{"id", "fk_user_id"}, model.GetAllOptions{})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"id": 10}, {"id": 20, "fk_user_id": 2}}, data.Maps())
+}
+
+func (s *ModelTestSuite) TestBaseModel_OnDeleteRestrict() {
+	ctx := context.Background()
+
+	storage := test.NewStorage()
+	user, message := test.NewUser(storage), test.NewMessage(storage)
+	relation.AddManyToOne(message, user, relation.WithOnDelete(relation.Restrict))
+
+	_, err := user.AddMulti(ctx, model.NewData([]string{"id", "name", "lastname"}, [][]interface{}{
+		{1, "Ivan", "Sidorov"},
+		{2, "Petr", "Ivanov"},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	_, err = message.AddMulti(ctx, model.NewData([]string{"id", "text", "fk_user_id"}, [][]interface{}{
+		{10, "Message 1", 1},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	err = user.Delete(ctx, expr.Lt(user.FieldExpr("id"), expr.Value(3)))
+	s.IsType(&model.DeleteError{}, err)
+
+	s.NoError(user.Delete(ctx, expr.Eq(user.FieldExpr("id"), expr.Value(2))))
+
+	data, err := user.GetAll(ctx, []string{"id"}, model.GetAllOptions{})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"id": 1}}, data.Maps())
+}
+
+func (s *ModelTestSuite) TestBaseModel_OnDeleteHidden() {
+	ctx := context.Background()
+
+	storage := test.NewStorage()
+	user := test.NewUser(storage)
+
+	newNote := func(id string, onDelete model.OnDeleteAction) *model.BaseModel {
+		note := model.NewBaseModel(id, []model.IFieldDefinition{
+			&model.IntField{Id: "id", Caption: "ID"},
+			&model.StringField{Id: "text", Caption: "Text"},
+		}, storage, model.BaseModelOpts{
+			PkFieldsNames: []string{"id"},
+			SoftDelete:    true,
+			DefaultFilter: func(ctx context.Context, m model.IModel) (model.IExpression, error) {
+				return expr.Ne(m.FieldExpr("text"), expr.Value("Hidden")), nil
+			},
+		})
+		relation.AddManyToOne(note, user, relation.WithOnDelete(onDelete))
+
+		return note
+	}
+	note, draft := newNote("note", relation.Cascade), newNote("draft", relation.Restrict)
+
+	_, err := user.AddMulti(ctx, model.NewData([]string{"id", "name", "lastname"}, [][]interface{}{
+		{1, "Ivan", "Sidorov"},
+		{2, "Petr", "Ivanov"},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	_, err = note.AddMulti(ctx, model.NewData([]string{"id", "text", "fk_user_id"}, [][]interface{}{
+		{1, "Hidden", 1},
+		{2, "Deleted", 1},
+		{3, "Visible", 2},
+	}), model.AddOptions{})
+	s.NoError(err)
+	s.NoError(note.Delete(ctx, expr.Eq(note.FieldExpr("id"), expr.Value(2))))
+
+	_, err = draft.AddMulti(ctx, model.NewData([]string{"id", "text", "fk_user_id"}, [][]interface{}{
+		{1, "Hidden", 2},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	s.NoError(user.Delete(ctx, expr.Eq(user.FieldExpr("id"), expr.Value(1))))
+
+	data, err := storage.Query(ctx, note, []string{"id"}, model.GetAllOptions{})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"id": 3}}, data.Maps())
+
+	s.IsType(&model.DeleteError{}, user.Delete(ctx, expr.Eq(user.FieldExpr("id"), expr.Value(2))))
+}
+
+func (s *ModelTestSuite) TestBaseModel_RequiredReference() {
+	ctx := context.Background()
+
+	storage := test.NewStorage()
+	user, message := test.NewUser(storage), test.NewMessage(storage)
+	relation.AddManyToOne(message, user, relation.WithRequired(true))
+
+	_, err := user.AddMulti(ctx, model.NewData([]string{"id", "name", "lastname"}, [][]interface{}{
+		{1, "Ivan", "Sidorov"},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	_, err = message.AddMulti(ctx, model.NewData([]string{"id", "text", "fk_user_id"}, [][]interface{}{
+		{10, "Message 1", 1},
+		{20, "Message 2", 2},
+	}), model.AddOptions{})
+	s.IsType(&model.FieldError{}, err)
+
+	_, err = message.AddMulti(ctx, model.NewData([]string{"id", "text", "fk_user_id"}, [][]interface{}{
+		{10, "Message 1", 1},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	filter := expr.Eq(message.FieldExpr("id"), expr.Value(10))
+	s.IsType(&model.FieldError{}, message.Edit(ctx, filter, map[string]interface{}{"fk_user_id": 2}))
+	s.IsType(&model.FieldError{}, message.Edit(ctx, filter, map[string]interface{}{"fk_user_id": nil}))
+	s.NoError(message.Edit(ctx, filter, map[string]interface{}{"fk_user_id": 1, "text": "New text"}))
+}
+
+// linkedIds returns the ids of the model rows linked with any of the external rows
+func (s *ModelTestSuite) linkedIds(m model.IModel, relationName, extField string, values ...interface{}) []interface{} {
+	extModel := m.GetRelation(relationName).ExtModel
+	in := expr.In(expr.ModelField(extModel, extField))
+	for _, value := range values {
+		in.Add(expr.Value(value))
+	}
+
+	data, err := m.GetAll(context.Background(), []string{"id"}, model.GetAllOptions{
+		Filter: expr.Any(m, relationName, in),
+	})
+	s.NoError(err)
+
+	res := []interface{}{}
+	for _, row := range data.Data() {
+		res = append(res, row[0])
+	}
+
+	return res
+}
+
+func (s *ModelTestSuite) TestBaseModel_SoftDelete() {
+	ctx := context.Background()
+
+	storage := test.NewStorage()
+	user := test.NewUser(storage)
+	note := model.NewBaseModel("note", []model.IFieldDefinition{
+		&model.IntField{Id: "id", Caption: "ID"},
+		&model.StringField{Id: "text", Caption: "Text"},
+	}, storage, model.BaseModelOpts{PkFieldsNames: []string{"id"}, SoftDelete: true})
+	relation.AddManyToOne(note, user)
+
+	s.Equal([]string{"id", "text", model.SOFT_DELETE_FIELD, "fk_user_id"}, note.GetFieldsNames())
+
+	_, err := user.AddMulti(ctx, model.NewData([]string{"id", "name", "lastname"}, [][]interface{}{
+		{1, "Ivan", "Sidorov"},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	_, err = note.AddMulti(ctx, model.NewData([]string{"id", "text", "fk_user_id"}, [][]interface{}{
+		{1, "Note 1", 1},
+		{2, "Note 2", 1},
+		{3, "Note 3", 1},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	ids := func(ctx context.Context) []interface{} {
+		data, err := note.GetAll(ctx, []string{"id"}, model.GetAllOptions{OrderBy: []model.Order{{FieldName: "id"}}})
+		s.NoError(err)
+
+		res := []interface{}{}
+		for _, row := range data.Data() {
+			res = append(res, row[0])
+		}
+
+		return res
+	}
+
+	idIn := func(values ...int) model.IExpression {
+		in := expr.In(note.FieldExpr("id"))
+		for _, value := range values {
+			in.Add(expr.Value(value))
+		}
+
+		return in
+	}
+
+	s.NoError(note.Delete(ctx, idIn(1, 2)))
+	s.Equal([]interface{}{3}, ids(ctx))
+	s.Equal([]interface{}{1, 2, 3}, ids(model.WithDeleted(ctx)))
+
+	data, err := user.GetAll(ctx, []string{"id", "note.id", "note.@count"}, model.GetAllOptions{})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{
+		{"id": 1, "note": []map[string]interface{}{{"id": 3}}, "note.@count": uint64(1)},
+	}, data.Maps())
+
+	var deleted []struct {
+		Id        int
+		DeletedAt time.Time
+	}
+	s.NoError(note.GetAllToStruct(model.WithDeleted(ctx), &deleted, model.GetAllOptions{
+		Filter: expr.Eq(note.FieldExpr("id"), expr.Value(1)),
+	}))
+	s.False(deleted[0].DeletedAt.IsZero())
+
+	s.NoError(note.Restore(ctx, expr.Eq(note.FieldExpr("id"), expr.Value(2))))
+	s.Equal([]interface{}{2, 3}, ids(ctx))
+
+	s.NoError(note.HardDelete(ctx, idIn(1, 3)))
+	s.Equal([]interface{}{2}, ids(model.WithDeleted(ctx)))
+
+	err = user.Restore(ctx, nil)
+	s.Error(err)
+	s.NotEqual(reflect.TypeOf(&model.DeleteError{}), reflect.TypeOf(err))
+
+	// The soft-deleted rows are not counted through the junction model
+	tag := model.NewBaseModel("tag", []model.IFieldDefinition{
+		&model.IntField{Id: "id", Caption: "ID"},
+	}, storage, model.BaseModelOpts{PkFieldsNames: []string{"id"}, SoftDelete: true})
+	relation.AddManyToMany(user, tag, storage)
+
+	_, err = tag.AddMulti(ctx, model.NewData([]string{"id"}, [][]interface{}{{1}, {2}}), model.AddOptions{})
+	s.NoError(err)
+	s.NoError(user.Link(ctx, "tag", []model.ModelLink{{Pk: []interface{}{1}, Fks: [][]interface{}{{1}, {2}}}}))
+	s.NoError(tag.Delete(ctx, expr.Eq(tag.FieldExpr("id"), expr.Value(2))))
+
+	data, err = user.GetAll(ctx, []string{"id", "tag.id", "tag.@count"}, model.GetAllOptions{})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{
+		{"id": 1, "tag": []map[string]interface{}{{"id": 1}}, "tag.@count": uint64(1)},
+	}, data.Maps())
+}
+
+func (s *ModelTestSuite) TestBaseModel_EditWithVersion() {
+	ctx := context.Background()
+
+	doc := model.NewBaseModel("doc", []model.IFieldDefinition{
+		&model.IntField{Id: "id", Caption: "ID"},
+		&model.StringField{Id: "text", Caption: "Text"},
+	}, test.NewStorage(), model.BaseModelOpts{PkFieldsNames: []string{"id"}, Versioned: true})
+
+	_, err := doc.AddMulti(ctx, model.NewData([]string{"id", "text"}, [][]interface{}{{1, "Draft"}}), model.AddOptions{})
+	s.NoError(err)
+
+	byId := expr.Eq(doc.FieldExpr("id"), expr.Value(1))
+	s.NoError(doc.EditWithVersion(ctx, byId, 1, map[string]interface{}{"text": "First"}))
+
+	err = doc.EditWithVersion(ctx, byId, 1, map[string]interface{}{"text": "Second"})
+	s.IsType(&model.ConflictError{}, err)
+
+	data, err := doc.GetAll(ctx, []string{"text", model.VERSION_FIELD}, model.GetAllOptions{Filter: byId})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"text": "First", model.VERSION_FIELD: 2}}, data.Maps())
+
+	s.IsType(&model.ConflictError{}, doc.EditWithVersion(ctx, expr.Eq(doc.FieldExpr("id"), expr.Value(2)), 1, nil))
+	s.Error(doc.EditWithVersion(ctx, byId, 2, map[string]interface{}{model.VERSION_FIELD: 5}))
+	s.Error(s.user.EditWithVersion(ctx, nil, 1, nil))
+
+	// The other edits increment the version too
+	s.NoError(doc.Edit(ctx, byId, map[string]interface{}{"text": "Third"}))
+
+	_, data, err = doc.EditReturning(ctx, byId, map[string]interface{}{"text": "Fourth"}, []string{model.VERSION_FIELD})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{model.VERSION_FIELD: 4}}, data.Maps())
+
+	s.NoError(doc.EditMulti(ctx, model.NewData([]string{"id", "text"}, [][]interface{}{{1, "Fifth"}, {3, "Missed"}})))
+
+	_, err = doc.AddMulti(ctx, model.NewData([]string{"id", "text"}, [][]interface{}{{2, "Draft"}}), model.AddOptions{})
+	s.NoError(err)
+	s.NoError(doc.Edit(ctx, nil, map[string]interface{}{"text": "All"}))
+
+	data, err = doc.GetAll(ctx, []string{"id", model.VERSION_FIELD}, model.GetAllOptions{OrderBy: []model.Order{{FieldName: "id"}}})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"id": 1, model.VERSION_FIELD: 6}, {"id": 2, model.VERSION_FIELD: 2}}, data.Maps())
+
+	// The version cannot be written directly
+	s.IsType(&model.FieldError{}, doc.Edit(ctx, byId, map[string]interface{}{model.VERSION_FIELD: 1}))
+	s.IsType(&model.FieldError{}, doc.EditMulti(ctx, model.NewData([]string{"id", model.VERSION_FIELD}, [][]interface{}{{1, 1}})))
+	_, err = doc.AddMulti(ctx, model.NewData([]string{"id", model.VERSION_FIELD}, [][]interface{}{{3, 1}}), model.AddOptions{})
+	s.IsType(&model.FieldError{}, err)
+	_, err = doc.AddMulti(ctx, model.NewData([]string{"id", "text"}, [][]interface{}{{1, "New"}}), model.AddOptions{
+		OnConflict: &model.OnConflict{Update: map[string]model.IExpression{"text": expr.Excluded("text")}},
+	})
+	s.Error(err)
+}
+
+func (s *ModelTestSuite) TestBaseModel_StructsWithVersion() {
+	ctx := context.Background()
+
+	doc := model.NewBaseModel("doc", []model.IFieldDefinition{
+		&model.IntField{Id: "id", Caption: "ID"},
+		&model.StringField{Id: "text", Caption: "Text"},
+	}, test.NewStorage(), model.BaseModelOpts{PkFieldsNames: []string{"id"}, Versioned: true, SoftDelete: true})
+
+	type Doc struct {
+		Id        int
+		Text      string
+		Version   int
+		DeletedAt time.Time
+	}
+
+	// The version and the deletion time are set by the model, the values of the structures are not written
+	_, err := doc.AddFromStructs(ctx, []Doc{{Id: 1, Text: "Draft", Version: 5}}, model.AddOptions{})
+	s.NoError(err)
+
+	docs := model.NewTypedModel[Doc](doc)
+	_, err = docs.Add(ctx, []Doc{{Id: 2, Text: "Typed"}})
+	s.NoError(err)
+
+	var d Doc
+	s.NoError(doc.GetByPKToStruct(ctx, &d, 1))
+	s.Equal(Doc{Id: 1, Text: "Draft", Version: 1}, d)
+
+	d.Text = "First"
+	s.NoError(doc.EditFromStruct(ctx, nil, &d, nil))
+
+	d, err = docs.GetByPK(ctx, 1)
+	s.NoError(err)
+	s.Equal(Doc{Id: 1, Text: "First", Version: 2}, d)
+
+	d, err = docs.GetByPK(ctx, 2)
+	s.NoError(err)
+	s.Equal(Doc{Id: 2, Text: "Typed", Version: 1}, d)
+}
+
+func (s *ModelTestSuite) TestBaseModel_Returning() {
+	ctx := context.Background()
+
+	for name, storage := range map[string]model.IStorage{
+		"returning": test.NewStorage(),
+		"fallback":  struct{ model.IStorage }{test.NewStorage()},
+	} {
+		s.Run(name, func() {
+			group := test.NewGroup(storage)
+			_, err := group.AddMulti(ctx, model.NewData([]string{"id", "name"}, [][]interface{}{
+				{1, "Admins"}, {2, "Users"}, {3, "Users"},
+			}), model.AddOptions{})
+			s.Require().NoError(err)
+
+			users := expr.Eq(group.FieldExpr("name"), expr.Value("Users"))
+
+			n, data, err := group.EditReturning(ctx, users, map[string]interface{}{"name": "Guests"}, []string{"id", "name"})
+			s.NoError(err)
+			s.Equal(uint64(2), n)
+			s.ElementsMatch([]map[string]interface{}{{"id": 2, "name": "Guests"}, {"id": 3, "name": "Guests"}}, data.Maps())
+
+			n, data, err = group.EditReturning(ctx, users, map[string]interface{}{"name": "Guests"}, nil)
+			s.NoError(err)
+			s.Equal(uint64(0), n)
+			s.Nil(data)
+
+			n, data, err = group.EditReturning(ctx, expr.Eq(group.FieldExpr("id"), expr.Value(1)), map[string]interface{}{"id": 10}, []string{"id"})
+			s.NoError(err)
+			s.Equal(uint64(1), n)
+			s.Equal([]map[string]interface{}{{"id": 10}}, data.Maps())
+
+			_, _, err = group.EditReturning(ctx, nil, map[string]interface{}{"name": "Guests"}, []string{"unknown"})
+			s.Error(err)
+
+			n, data, err = group.DeleteReturning(ctx, expr.Eq(group.FieldExpr("name"), expr.Value("Guests")), []string{"id"})
+			s.NoError(err)
+			s.Equal(uint64(2), n)
+			s.ElementsMatch([]map[string]interface{}{{"id": 2}, {"id": 3}}, data.Maps())
+
+			n, _, err = group.DeleteReturning(ctx, nil, nil)
+			s.NoError(err)
+			s.Equal(uint64(1), n)
+		})
+	}
+}
+
+func (s *ModelTestSuite) TestBaseModel_AddOnConflict() {
+	ctx := context.Background()
+
+	counter := model.NewBaseModel("counter", []model.IFieldDefinition{
+		&model.StringField{Id: "id", Caption: "ID"},
+		&model.IntField{Id: "count", Caption: "Count"},
+		&model.StringField{Id: "comment", Caption: "Comment"},
+	}, test.NewStorage(), model.BaseModelOpts{PkFieldsNames: []string{"id"}})
+
+	merge := &model.OnConflict{Update: map[string]model.IExpression{
+		"count": expr.Func("add", counter.FieldExpr("count"), expr.Excluded("count")),
+	}}
+
+	_, err := counter.AddMulti(ctx, model.NewData([]string{"id", "count", "comment"}, [][]interface{}{
+		{"a", 1, "First"}, {"b", 2, "First"}, {"a", 3, "Second"},
+	}), model.AddOptions{OnConflict: merge})
+	s.NoError(err)
+
+	pk, err := counter.AddMulti(ctx, model.NewData([]string{"id", "count", "comment"}, [][]interface{}{
+		{"b", 10, "Third"}, {"c", 5, "Third"},
+	}), model.AddOptions{OnConflict: merge})
+	s.NoError(err)
+	s.Equal([][]interface{}{{"b"}, {"c"}}, pk.Data())
+
+	data, err := counter.GetAll(ctx, []string{"id", "count", "comment"}, model.GetAllOptions{OrderBy: []model.Order{{FieldName: "id"}}})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{
+		{"id": "a", "count": 4, "comment": "First"},
+		{"id": "b", "count": 12, "comment": "First"},
+		{"id": "c", "count": 5, "comment": "Third"},
+	}, data.Maps())
+
+	for _, opts := range []model.AddOptions{
+		{Replace: true, OnConflict: &model.OnConflict{}},
+		{OnConflict: &model.OnConflict{Target: []string{"comment"}}},
+		{OnConflict: &model.OnConflict{Update: map[string]model.IExpression{"unknown": expr.Excluded("count")}}},
+		{OnConflict: &model.OnConflict{Update: map[string]model.IExpression{"count": expr.Excluded("unknown")}}},
+	} {
+		_, err = counter.AddMulti(ctx, model.NewData([]string{"id", "count"}, [][]interface{}{{"a", 1}}), opts)
+		s.Error(err)
+	}
+
+	_, err = counter.GetAll(ctx, []string{"id"}, model.GetAllOptions{Filter: expr.Eq(counter.FieldExpr("count"), expr.Excluded("count"))})
+	s.Error(err)
+}
+
+func (s *ModelTestSuite) TestBaseModel_UniqueKeys() {
+	ctx := context.Background()
+
+	newCity := func(uniqueKeys [][]string) *model.BaseModel {
+		return model.NewBaseModel("city", []model.IFieldDefinition{
+			&model.IntField{Id: "id", Caption: "ID"},
+			&model.StringField{Id: "country", Caption: "Country"},
+			&model.StringField{Id: "name", Caption: "Name"},
+		}, test.NewStorage(), model.BaseModelOpts{PkFieldsNames: []string{"id"}, UniqueKeys: uniqueKeys})
+	}
+
+	s.Panics(func() { newCity([][]string{{"country", "unknown"}}) })
+
+	city := newCity([][]string{{"country", "name"}})
+	s.Equal([][]string{{"country", "name"}}, city.GetUniqueKeys())
+
+	_, err := city.AddMulti(ctx, model.NewData([]string{"id", "country", "name"}, [][]interface{}{
+		{1, "USA", "Arlington"}, {2, "USA", "Crowley"}, {3, "UK", "Arlington"},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	_, err = city.AddMulti(ctx, model.NewData([]string{"id", "country", "name"}, [][]interface{}{{4, "UK", "Arlington"}}), model.AddOptions{})
+	s.IsType(&model.UniqueViolationError{}, err)
+
+	s.IsType(&model.UniqueViolationError{}, city.Edit(ctx, expr.Eq(city.FieldExpr("id"), expr.Value(2)), map[string]interface{}{"name": "Arlington"}))
+
+	data, err := city.GetByKey(ctx, map[string]interface{}{"name": "Arlington", "country": "UK"}, []string{"id"})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"id": 3}}, data.Maps())
+
+	data, err = city.GetByKey(ctx, map[string]interface{}{"id": 2}, []string{"name"})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"name": "Crowley"}}, data.Maps())
+
+	data, err = city.GetByKey(ctx, map[string]interface{}{"name": "Dallas", "country": "USA"}, []string{"id"})
+	s.NoError(err)
+	s.Equal(0, data.Len())
+
+	_, err = city.GetByKey(ctx, map[string]interface{}{"name": "Arlington"}, []string{"id"})
+	s.Error(err)
+
+	_, err = city.GetByKey(ctx, map[string]interface{}{"name": "Arlington", "country": nil}, []string{"id"})
+	s.Error(err)
+
+	_, err = city.AddMulti(ctx, model.NewData([]string{"id", "country", "name"}, [][]interface{}{{5, "USA", "Crowley"}}),
+		model.AddOptions{OnConflict: &model.OnConflict{Target: []string{"name", "country"}}})
+	s.NoError(err)
+
+	s.Equal("CREATE TABLE \"city\" (\n"+
+		"\t\"id\" int NOT NULL,\n"+
+		"\t\"country\" string,\n"+
+		"\t\"name\" string,\n"+
+		"\tPRIMARY KEY (\"id\"),\n"+
+		"\tUNIQUE (\"country\", \"name\")\n"+
+		")", model.GetSchema(city).DDL(nil))
+
+	// The keys are checked by the model if the storage does not check them
+	tag := model.NewBaseModel("tag", []model.IFieldDefinition{
+		&model.IntField{Id: "id", Caption: "ID"},
+		&model.StringField{Id: "slug", Caption: "Slug"},
+	}, storageWoUniqueKeys{test.NewStorage()}, model.BaseModelOpts{PkFieldsNames: []string{"id"}, UniqueKeys: [][]string{{"slug"}}})
+
+	addTags := func(opts model.AddOptions, rows ...[]interface{}) error {
+		_, err := tag.AddMulti(ctx, model.NewData([]string{"id", "slug"}, rows), opts)
+		return err
+	}
+
+	s.NoError(addTags(model.AddOptions{}, []interface{}{1, "go"}, []interface{}{2, "rust"}, []interface{}{3, nil}, []interface{}{4, nil}))
+	s.IsType(&model.UniqueViolationError{}, addTags(model.AddOptions{}, []interface{}{5, "go"}))
+	s.IsType(&model.UniqueViolationError{}, addTags(model.AddOptions{}, []interface{}{5, "c"}, []interface{}{6, "c"}))
+	s.NoError(addTags(model.AddOptions{Replace: true}, []interface{}{1, "go"}))
+	s.IsType(&model.UniqueViolationError{}, addTags(model.AddOptions{Replace: true}, []interface{}{3, "rust"}))
+
+	s.IsType(&model.UniqueViolationError{}, tag.Edit(ctx, expr.Eq(tag.FieldExpr("id"), expr.Value(2)), map[string]interface{}{"slug": "go"}))
+	s.IsType(&model.UniqueViolationError{}, tag.Edit(ctx, nil, map[string]interface{}{"slug": "c"}))
+	s.NoError(tag.Edit(ctx, expr.Eq(tag.FieldExpr("id"), expr.Value(2)), map[string]interface{}{"slug": "golang"}))
+	s.NoError(tag.Edit(ctx, expr.Eq(tag.FieldExpr("id"), expr.Value(1)), map[string]interface{}{"slug": "rust"}))
+}
+
+// storageWoUniqueKeys does not check the unique keys of the models
+type storageWoUniqueKeys struct {
+	model.IStorage
+}
+
+func (s storageWoUniqueKeys) RegisterModel(m model.IModel) error {
+	return s.IStorage.RegisterModel(modelWoUniqueKeys{m})
+}
+
+type modelWoUniqueKeys struct {
+	model.IModel
+}
+
+func (modelWoUniqueKeys) GetUniqueKeys() [][]string { return nil }
+
+func (s *ModelTestSuite) TestBaseModel_EditMulti() {
+	ctx := context.Background()
+
+	for name, storage := range map[string]model.IStorage{
+		"batch":    test.NewStorage(),
+		"fallback": struct{ model.IStorage }{test.NewStorage()},
+	} {
+		s.Run(name, func() {
+			group := test.NewGroup(storage)
+			_, err := group.AddMulti(ctx, model.NewData([]string{"id", "name"}, [][]interface{}{
+				{1, "Admins"}, {2, "Users"}, {3, "Guests"},
+			}), model.AddOptions{})
+			s.Require().NoError(err)
+
+			s.NoError(group.EditMulti(ctx, model.NewData([]string{"id", "name"}, [][]interface{}{
+				{3, "Anonymous"}, {1, "Root"}, {10, "Unknown"},
+			})))
+
+			data, err := group.GetAll(ctx, []string{"id", "name"}, model.GetAllOptions{OrderBy: []model.Order{{FieldName: "id"}}})
+			s.NoError(err)
+			s.Equal([]map[string]interface{}{
+				{"id": 1, "name": "Root"},
+				{"id": 2, "name": "Users"},
+				{"id": 3, "name": "Anonymous"},
+			}, data.Maps())
+
+			s.Error(group.EditMulti(ctx, model.NewData([]string{"name"}, [][]interface{}{{"Root"}})))
+			s.Error(group.EditMulti(ctx, model.NewData([]string{"id", "unknown"}, [][]interface{}{{1, "Root"}})))
+			s.Error(group.EditMulti(ctx, model.NewData([]string{"id", "name"}, [][]interface{}{{nil, "Root"}})))
+		})
+	}
+}
+
+func (s *ModelTestSuite) TestBaseModel_EditFromStruct() {
+	ctx := context.Background()
+
+	type UserType struct {
+		Id       int
+		Name     *string
+		Lastname string `field:"lastname"`
+		Fullname string
+		Phone    *struct{ Number int }
+	}
+
+	names := func() []map[string]interface{} {
+		data, err := s.user.GetAll(ctx, []string{"id", "name", "lastname"}, model.GetAllOptions{OrderBy: []model.Order{{FieldName: "id"}}})
+		s.Require().NoError(err)
+		return data.Maps()
+	}
+
+	name := "Ivan2"
+	s.NoError(s.user.EditFromStruct(ctx, nil, &UserType{Id: 1, Name: &name, Lastname: "Petrov"}, nil))
+	s.NoError(s.user.EditFromStruct(ctx, 2, UserType{Lastname: "Sidorov"}, nil))
+	s.NoError(s.user.EditFromStruct(ctx, []interface{}{3}, UserType{Name: &name, Lastname: "Smith"}, []string{"lastname"}))
+	s.NoError(s.user.EditFromStruct(ctx, expr.Eq(s.user.FieldExpr("lastname"), expr.Value("Connor")), &UserType{Lastname: "Reese"}, nil))
+
+	s.Equal([]map[string]interface{}{
+		{"id": 1, "name": "Ivan2", "lastname": "Petrov"},
+		{"id": 2, "name": "Petr", "lastname": "Sidorov"},
+		{"id": 3, "name": "James", "lastname": "Smith"},
+		{"id": 4, "name": "John", "lastname": "Reese"},
+		{"id": 5, "name": "Sara", "lastname": "Reese"},
+	}, names())
+
+	s.Error(s.user.EditFromStruct(ctx, nil, &UserType{Lastname: "Petrov"}, []string{"unknown"}))
+	s.Error(s.user.EditFromStruct(ctx, []interface{}{1, 2}, &UserType{Lastname: "Petrov"}, nil))
+	s.Error(s.user.EditFromStruct(ctx, nil, []UserType{}, nil))
+
+	s.NoError(s.user.DeleteStructs(ctx, []*UserType{{Id: 3}, {Id: 5}, {Id: 3}}))
+	s.NoError(s.user.DeleteStructs(ctx, []UserType{}))
+	s.Error(s.user.DeleteStructs(ctx, []*UserType{nil}))
+	s.Error(s.user.DeleteStructs(ctx, []struct{ Name string }{{"Ivan"}}))
+
+	s.Equal([]interface{}{1, 2, 4}, func() []interface{} {
+		var ids []interface{}
+		for _, row := range names() {
+			ids = append(ids, row["id"])
+		}
+		return ids
+	}())
+}
+
+func (s *ModelTestSuite) TestBaseModel_GetOne() {
+	ctx := context.Background()
+
+	row, err := s.user.GetByPK(ctx, []string{"name", "lastname"}, 3)
+	s.NoError(err)
+	s.Equal(map[string]interface{}{"name": "James", "lastname": "Bond"}, row)
+
+	_, err = s.user.GetByPK(ctx, []string{"name"}, 10)
+	s.True(errors.Is(err, model.ErrNotFound), "%v", err)
+	s.IsType(&model.NotFoundError{}, err)
+
+	_, err = s.user.GetByPK(ctx, []string{"name"}, 1, 2)
+	s.Error(err)
+	s.False(errors.Is(err, model.ErrNotFound))
+
+	row, err = s.user.GetOne(ctx, []string{"id"}, expr.Eq(s.user.FieldExpr("name"), expr.Value("Sara")))
+	s.NoError(err)
+	s.Equal(map[string]interface{}{"id": 5}, row)
+
+	_, err = s.user.GetOne(ctx, []string{"id"}, expr.Eq(s.user.FieldExpr("lastname"), expr.Value("Connor")))
+	s.True(errors.Is(err, model.ErrMultipleRows), "%v", err)
+	s.False(errors.Is(err, model.ErrNotFound))
+
+	type UserType struct {
+		Id       int
+		Lastname string
+	}
+
+	var user UserType
+	s.NoError(s.user.GetByPKToStruct(ctx, &user, 2))
+	s.Equal(UserType{2, "Ivanov"}, user)
+
+	s.NoError(s.user.GetOneToStruct(ctx, &user, expr.Eq(s.user.FieldExpr("name"), expr.Value("Ivan"))))
+	s.Equal(UserType{1, "Sidorov"}, user)
+
+	s.True(errors.Is(s.user.GetOneToStruct(ctx, &user, expr.Eq(s.user.FieldExpr("name"), expr.Value("Kyle"))), model.ErrNotFound))
+	s.Error(s.user.GetByPKToStruct(ctx, user, 2))
+
+	stock := model.NewBaseModel("stock", []model.IFieldDefinition{
+		&model.StringField{Id: "warehouse", Caption: "Warehouse"},
+		&model.StringField{Id: "item", Caption: "Item"},
+		&model.IntField{Id: "count", Caption: "Count"},
+	}, test.NewStorage(), model.BaseModelOpts{PkFieldsNames: []string{"warehouse", "item"}})
+
+	_, err = stock.AddMulti(ctx, model.NewData([]string{"warehouse", "item", "count"}, [][]interface{}{
+		{"north", "apple", 10}, {"north", "pear", 20}, {"south", "apple", 30},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	row, err = stock.GetByPK(ctx, []string{"count"}, "south", "apple")
+	s.NoError(err)
+	s.Equal(map[string]interface{}{"count": 30}, row)
+
+	_, err = stock.GetByPK(ctx, []string{"count"}, "south", "pear")
+	s.True(errors.Is(err, model.ErrNotFound))
+
+	_, err = stock.GetByPK(ctx, []string{"count"}, "south")
+	s.Error(err)
+}
+
+func (s *ModelTestSuite) TestBaseModel_CountExists() {
+	ctx := context.Background()
+
+	for name, storage := range map[string]model.IStorage{
+		"count":     test.NewStorage(),
+		"aggregate": struct{ model.IAggregateStorage }{test.NewStorage()},
+		"fallback":  struct{ model.IStorage }{test.NewStorage()},
+	} {
+		s.Run(name, func() {
+			item := model.NewBaseModel("item", []model.IFieldDefinition{
+				&model.IntField{Id: "id", Caption: "ID"},
+				&model.StringField{Id: "name", Caption: "Name"},
+			}, storage, model.BaseModelOpts{
+				PkFieldsNames: []string{"id"},
+				DefaultFilter: func(ctx context.Context, m model.IModel) (model.IExpression, error) {
+					return expr.Ne(m.FieldExpr("name"), expr.Value("Hidden")), nil
+				},
+			})
+
+			_, err := item.AddMulti(ctx, model.NewData([]string{"id", "name"}, [][]interface{}{
+				{1, "Apple"}, {2, "Pear"}, {3, "Hidden"}, {4, "Apple"},
+			}), model.AddOptions{})
+			s.Require().NoError(err)
+
+			n, err := item.Count(ctx, nil)
+			s.NoError(err)
+			s.Equal(uint64(3), n)
+
+			n, err = item.Count(ctx, expr.Eq(item.FieldExpr("name"), expr.Value("Apple")))
+			s.NoError(err)
+			s.Equal(uint64(2), n)
+
+			n, err = item.Count(ctx, expr.Eq(item.FieldExpr("name"), expr.Value("Plum")))
+			s.NoError(err)
+			s.Equal(uint64(0), n)
+
+			exists, err := item.Exists(ctx, expr.Eq(item.FieldExpr("name"), expr.Value("Pear")))
+			s.NoError(err)
+			s.True(exists)
+
+			exists, err = item.Exists(ctx, expr.Eq(item.FieldExpr("name"), expr.Value("Hidden")))
+			s.NoError(err)
+			s.False(exists)
+
+			_, err = item.Exists(ctx, expr.Eq(expr.ModelField(item, "unknown"), expr.Value(1)))
+			s.Error(err)
+		})
+	}
+}
+
+func (s *ModelTestSuite) TestTypedModel() {
+	ctx := context.Background()
+
+	type UserRow struct {
+		Id       int
+		Name     string
+		Lastname string
+	}
+
+	users := model.NewTypedModel[UserRow](s.user.BaseModel)
+	id := model.NewField[UserRow, int](users, "id")
+	lastname := model.NewField[UserRow, string](users, "lastname")
+
+	s.Panics(func() { model.NewField[UserRow, string](users, "id") })
+	s.Panics(func() { model.NewField[UserRow, string](users, "unknown") })
+	s.Panics(func() { model.NewTypedModel[int](s.user.BaseModel) })
+
+	rows, err := users.GetAll(ctx, model.GetAllOptions{
+		Filter:  expr.Or(lastname.Eq("Connor"), id.Lt(2)),
+		OrderBy: []model.Order{{FieldName: "id"}},
+	})
+	s.NoError(err)
+	s.Equal([]UserRow{{1, "Ivan", "Sidorov"}, {4, "John", "Connor"}, {5, "Sara", "Connor"}}, rows)
+
+	pks, err := users.Add(ctx, []UserRow{{6, "Kyle", "Reese"}})
+	s.NoError(err)
+	s.Equal([][]interface{}{{6}}, pks.Data())
+
+	s.NoError(users.Edit(ctx, id.In(2, 3), model.NewPatch(lastname.Set("Smith"))))
+
+	row, err := users.GetByPK(ctx, 3)
+	s.NoError(err)
+	s.Equal(UserRow{3, "James", "Smith"}, row)
+
+	row, err = users.GetOne(ctx, expr.And(lastname.Eq("Smith"), id.Ge(3)))
+	s.NoError(err)
+	s.Equal(UserRow{3, "James", "Smith"}, row)
+
+	_, err = users.GetByPK(ctx, 10)
+	s.True(errors.Is(err, model.ErrNotFound))
+
+	s.NoError(users.Delete(ctx, id.Gt(5)))
+	n, err := s.user.Count(ctx, nil)
+	s.NoError(err)
+	s.Equal(uint64(5), n)
+}
+
+func (s *ModelTestSuite) TestValidate() {
+	s.NoError(model.Validate(s.user, expr.And(
+		expr.Lt(expr.ModelField(s.user, "id"), expr.Value(4)),
+		expr.Eq(expr.ModelField(s.user, "name"), expr.Value("Ivan")),
+		expr.Ne(expr.ModelField(s.user, "lastname"), expr.Value(nil)),
+	)))
+
+	s.NoError(model.Validate(s.user, expr.Any(s.user, "message",
+		expr.Eq(expr.ModelField(s.message, "text"), expr.Value("Message 1")),
+	)))
+
+	s.Error(model.Validate(s.user, expr.Lt(expr.ModelField(s.user, "name"), expr.Value(4))))
+	s.Error(model.Validate(s.user, expr.Eq(expr.ModelField(s.user, "unknown"), expr.Value(4))))
+	s.Error(model.Validate(s.user, expr.Eq(expr.ModelField(s.user, "fullname"), expr.Value("Ivan Sidorov"))))
+	s.Error(model.Validate(s.user, expr.Lt(expr.Value(true), expr.Value(false))))
+	s.Error(model.Validate(s.user, expr.Eq(expr.ModelField(s.message, "text"), expr.Value("Message 1"))))
+	s.Error(model.Validate(s.user, expr.Any(s.user, "user", nil)))
+
+	_, err := s.user.GetAll(context.Background(), []string{"id"}, model.GetAllOptions{
+		Filter: expr.Lt(expr.ModelField(s.user, "name"), expr.Value(4)),
+	})
+	s.IsType(&model.FilterError{}, err)
+
+	s.NoError(s.user.Edit(context.Background(), expr.In(expr.ModelField(s.user, "id")), map[string]interface{}{"lastname": "NewName"}))
+	s.Error(s.user.Delete(context.Background(), expr.Eq(expr.ModelField(s.user, "id"), expr.Value("3"))))
+
+	event := model.NewBaseModel("event", []model.IFieldDefinition{
+		&model.IntField{Id: "id", Caption: "ID"},
+		&model.TimeField{Id: "at", Caption: "At"},
+	}, test.NewStorage(), model.BaseModelOpts{PkFieldsNames: []string{"id"}})
+
+	_, err = event.AddMulti(context.Background(), model.NewData([]string{"id", "at"}, [][]interface{}{
+		{1, time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{2, time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)},
+	}), model.AddOptions{})
+	s.NoError(err)
+
+	data, err := event.GetAll(context.Background(), []string{"id"}, model.GetAllOptions{
+		Filter: expr.Gt(event.FieldExpr("at"), expr.Value("2020-01-01 12:00:00")),
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"id": 2}}, data.Maps())
+
+	s.Error(model.Validate(event, expr.Eq(event.FieldExpr("at"), expr.Value(4))))
+}
+
+func (s *ModelTestSuite) TestExprPrinter() {
+	in := expr.In(expr.ModelField(s.user, "name"))
+	in.Add(expr.Value("Ivan"))
+	in.Add(expr.Value("O'Neil"))
+
+	filter := expr.And(
+		expr.Or(
+			expr.Lt(expr.ModelField(s.user, "id"), expr.Value(4)),
+			in,
+		),
+		expr.Eq(expr.ModelField(s.user, "lastname"), expr.Value(nil)),
+		expr.Any(s.user, "message", expr.Ne(expr.Func("lower", expr.ModelField(s.message, "text")), expr.Value("hi"))),
+	)
+
+	s.Equal(
+		"(user.id < 4 OR user.name IN ('Ivan', 'O''Neil')) AND user.lastname IS NULL AND ANY(user -> message WHERE lower(message.text) != 'hi')",
+		model.ExprToString(filter),
+	)
+
+	s.Equal(
+		"(user.id < ? OR user.name IN (?, ?)) AND user.lastname IS NULL AND ANY(user -> message WHERE lower(message.text) != ?)",
+		(&model.ExprPrinter{RedactValues: true}).Print(filter),
+	)
+
+	ctx := timelog.Start(context.Background(), "Get all with filter")
+	_, err := s.user.GetAll(ctx, []string{"id"}, model.GetAllOptions{
+		Filter: expr.Lt(expr.ModelField(s.user, "id"), expr.Value(4)),
+	})
+	s.NoError(err)
+	timelog.Finish(ctx)
+
+	s.Contains(timelog.Get(ctx).Analyze().String(), "user: GetAll WHERE user.id < ?")
+
+	ctx = timelog.Start(model.WithFilterValuesLogging(context.Background()), "Get all with filter values")
+	_, err = s.user.GetAll(ctx, []string{"id"}, model.GetAllOptions{
+		Filter: expr.Lt(expr.ModelField(s.user, "id"), expr.Value(4)),
+	})
+	s.NoError(err)
+	timelog.Finish(ctx)
+
+	s.Contains(timelog.Get(ctx).Analyze().String(), "user: GetAll WHERE user.id < 4")
+
+	at := time.Date(2020, 1, 2, 3, 4, 5, 600, time.FixedZone("MSK", 3*60*60))
+	s.Equal("user.id = '2020-01-02T03:04:05.0000006+03:00'", model.ExprToString(expr.Eq(expr.ModelField(s.user, "id"), expr.Value(at))))
+}
+
+func (s *ModelTestSuite) TestExprProcessor_Any() {
+	data, err := s.user.GetAll(context.Background(), []string{"id"}, model.GetAllOptions{
+		Filter: expr.Any(s.user, "message", expr.Eq(expr.ModelField(s.message, "text"), expr.Value("Message 4"))),
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"id": 2}}, data.Maps())
+
+	data, err = s.user.GetAll(context.Background(), []string{"id"}, model.GetAllOptions{
+		Filter: expr.Any(s.user, "address", expr.Eq(expr.ModelField(s.address, "city"), expr.Value("Crowley"))),
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"id": 2}, {"id": 3}}, data.Maps())
+
+	data, err = s.user.GetAll(context.Background(), []string{"id"}, model.GetAllOptions{
+		Filter: expr.Any(s.user, "phone", nil),
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"id": 1}, {"id": 3}}, data.Maps())
+}
+
+func (s *ModelTestSuite) TestExprProcessor_Func() {
+	data, err := s.user.GetAll(context.Background(), []string{"id"}, model.GetAllOptions{
+		Filter: expr.Or(
+			expr.Eq(expr.Func("lower", expr.ModelField(s.user, "name")), expr.Value("ivan")),
+			expr.Eq(expr.Func("concat", expr.ModelField(s.user, "name"), expr.Value(" "), expr.ModelField(s.user, "lastname")), expr.Value("Sara Connor")),
+			expr.Ge(expr.Func("abs", expr.Value(-2)), expr.ModelField(s.user, "id")),
+		),
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"id": 1}, {"id": 2}, {"id": 5}}, data.Maps())
+
+	// The sum of the mixed numbers
+	data, err = s.user.GetAll(context.Background(), []string{"id"}, model.GetAllOptions{
+		Filter: expr.And(
+			expr.Eq(expr.Func("add", expr.Value(1), expr.Value(0.5)), expr.Value(1.5)),
+			expr.Eq(expr.Func("add", expr.Value(0.5), expr.Value(1)), expr.Value(1.5)),
+			expr.Eq(expr.Func("add", expr.Value(uint(1)), expr.Value(-2)), expr.Value(-1)),
+			expr.Eq(expr.Func("add", expr.Value(uint(3)), expr.Value(-2)), expr.Value(1)),
+			expr.Eq(expr.ModelField(s.user, "id"), expr.Value(1)),
+		),
+	})
+	s.NoError(err)
+	s.Equal([]map[string]interface{}{{"id": 1}}, data.Maps())
+
+	_, err = s.user.GetAll(context.Background(), []string{"id"}, model.GetAllOptions{
+		Filter: expr.Eq(expr.Func("unknown", expr.ModelField(s.user, "name")), expr.Value("ivan")),
+	})
+	s.Error(err)
+}
@@ -0,0 +1,321 @@
+package model
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/go-qbit/qerror"
+)
+
+// structsWriter is implemented by BaseModel, it is used for adding the nested structures of the external models
+type structsWriter interface {
+	addStructs(ctx context.Context, rows []reflect.Value, extra *Data, opts AddOptions) (*Data, error)
+}
+
+type nestedStructField struct {
+	num      int
+	name     string
+	relation *Relation
+}
+
+// addStructs adds the structures and their nested relations, the generated primary keys are set to the structures.
+// The extra data contains the values of the fields which are not in the structures, e.g. FK to the parent row.
+func (m *BaseModel) addStructs(ctx context.Context, rows []reflect.Value, extra *Data, opts AddOptions) (*Data, error) {
+	if len(rows) == 0 {
+		return NewEmptyData(m.GetPKFieldsNames()), nil
+	}
+
+	flatFields, nestedFields := m.structFields(rows[0].Type(), extra)
+
+	// The fields changed by the model itself are not written
+	n := 0
+	for _, field := range flatFields {
+		if !m.isAutoField(field.name) {
+			flatFields[n] = field
+			n++
+		}
+	}
+	flatFields = flatFields[:n]
+
+	var fieldsNames []string
+	fieldsNums := make(map[string]int)
+	addFieldName := func(name string) {
+		if _, exists := fieldsNums[name]; !exists {
+			fieldsNums[name] = len(fieldsNames)
+			fieldsNames = append(fieldsNames, name)
+		}
+	}
+
+	for _, field := range flatFields {
+		addFieldName(field.name)
+	}
+	if extra != nil {
+		for _, name := range extra.Fields() {
+			addFieldName(name)
+		}
+	}
+
+	// The rows referenced by FK fields of the model must be added before
+	fkValues := make([]map[string]interface{}, len(rows))
+	for _, field := range nestedFields {
+		if !isParentRelation(m, field.relation) {
+			continue
+		}
+
+		var (
+			children  []reflect.Value
+			childRows []int
+		)
+		for i, row := range rows {
+			child, ok := nestedStruct(row.Field(field.num))
+			if !ok {
+				continue
+			}
+			if child.Kind() == reflect.Slice {
+				return nil, qerror.Errorf("Field '%s' in model '%s' must be a structure, not a slice", field.name, m.GetId())
+			}
+
+			children = append(children, child)
+			childRows = append(childRows, i)
+		}
+
+		childPks, err := m.addNestedStructs(ctx, field.relation, children, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, fkFieldName := range field.relation.FkFieldsNames {
+			n := childPks.FieldNum(fkFieldName)
+			if n == -1 {
+				return nil, qerror.Errorf("Field '%s' of model '%s' is not a primary key", fkFieldName, field.relation.ExtModel.GetId())
+			}
+
+			localFieldName := field.relation.LocalFieldsNames[i]
+			addFieldName(localFieldName)
+			for j, rowNum := range childRows {
+				if fkValues[rowNum] == nil {
+					fkValues[rowNum] = make(map[string]interface{})
+				}
+				fkValues[rowNum][localFieldName] = childPks.Data()[j][n]
+			}
+		}
+	}
+
+	data := NewEmptyData(fieldsNames)
+	for i, row := range rows {
+		flatRow := make([]interface{}, len(fieldsNames))
+		for _, field := range flatFields {
+			flatRow[fieldsNums[field.name]] = row.Field(field.num).Interface()
+		}
+		if extra != nil {
+			for j, name := range extra.Fields() {
+				flatRow[fieldsNums[name]] = extra.Data()[i][j]
+			}
+		}
+		for name, value := range fkValues[i] {
+			flatRow[fieldsNums[name]] = value
+		}
+
+		if err := data.Add(flatRow); err != nil {
+			return nil, err
+		}
+	}
+
+	pks, err := m.AddMulti(ctx, data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range flatFields {
+		if n := pks.FieldNum(field.name); n != -1 {
+			for i, row := range rows {
+				setStructValue(row.Field(field.num), pks.Data()[i][n])
+			}
+		}
+	}
+
+	// The rows which reference the added ones
+	for _, field := range nestedFields {
+		if isParentRelation(m, field.relation) {
+			continue
+		}
+
+		var (
+			children  []reflect.Value
+			childRows []int
+		)
+		for i, row := range rows {
+			child, ok := nestedStruct(row.Field(field.num))
+			if !ok {
+				continue
+			}
+
+			if child.Kind() != reflect.Slice {
+				children = append(children, child)
+				childRows = append(childRows, i)
+				continue
+			}
+
+			for j := 0; j < child.Len(); j++ {
+				if elem, ok := nestedStruct(child.Index(j)); ok {
+					children = append(children, elem)
+					childRows = append(childRows, i)
+				}
+			}
+		}
+
+		localValues := make([][]interface{}, len(childRows))
+		for i, rowNum := range childRows {
+			localValues[i] = make([]interface{}, len(field.relation.LocalFieldsNames))
+			for j, fieldName := range field.relation.LocalFieldsNames {
+				if n := pks.FieldNum(fieldName); n != -1 {
+					localValues[i][j] = pks.Data()[rowNum][n]
+				} else {
+					localValues[i][j] = data.Data()[rowNum][data.FieldNum(fieldName)]
+				}
+			}
+		}
+
+		if field.relation.JunctionModel == nil {
+			if _, err := m.addNestedStructs(ctx, field.relation, children, NewData(field.relation.FkFieldsNames, localValues)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		childPks, err := m.addNestedStructs(ctx, field.relation, children, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		fks := childPks.GetFieldsData(field.relation.FkFieldsNames).Data()
+		links := make([]ModelLink, len(children))
+		for i := range children {
+			links[i] = ModelLink{Pk: localValues[i], Fks: [][]interface{}{fks[i]}}
+		}
+
+		if err := m.link(ctx, field.relation, links); err != nil {
+			return nil, err
+		}
+	}
+
+	return pks, nil
+}
+
+// addNestedStructs adds the structures of the external model, the options of the parent rows are not applied to them
+func (m *BaseModel) addNestedStructs(ctx context.Context, relation *Relation, rows []reflect.Value, extra *Data) (*Data, error) {
+	writer, ok := relation.ExtModel.(structsWriter)
+	if !ok {
+		return nil, qerror.Errorf("Model '%s' does not support adding nested structures", relation.ExtModel.GetId())
+	}
+
+	return writer.addStructs(ctx, rows, extra, AddOptions{})
+}
+
+// structFields splits the structure fields to the model fields and the relations, the fields from the extra data are skipped
+func (m *BaseModel) structFields(t reflect.Type, extra *Data) ([]nestedStructField, []nestedStructField) {
+	var flatFields, nestedFields []nestedStructField
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name := strings.SplitN(m.structFieldToFieldName(field), "*", 2)[0]
+		if name == "-" || extra != nil && extra.FieldNum(name) != -1 {
+			continue
+		}
+
+		if m.GetFieldDefinition(name) == nil && isNestedType(field.Type) {
+			if relation := m.GetRelation(name); relation != nil {
+				nestedFields = append(nestedFields, nestedStructField{i, name, relation})
+				continue
+			}
+		}
+
+		flatFields = append(flatFields, nestedStructField{num: i, name: name})
+	}
+
+	return flatFields, nestedFields
+}
+
+// isAutoField checks the field is changed by the model itself, so the structures do not write it
+func (m *BaseModel) isAutoField(name string) bool {
+	return m.versioned && name == VERSION_FIELD || m.softDelete && name == SOFT_DELETE_FIELD
+}
+
+// isParentRelation checks if the model rows reference the external rows, so the external rows must be added first
+func isParentRelation(m IModel, relation *Relation) bool {
+	switch linkStorage(m, relation) {
+	case linkLocalFk:
+		return true
+	case linkSharedPk:
+		return !relation.IsBack
+	default:
+		return false
+	}
+}
+
+func isNestedType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		t = t.Elem()
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+
+	return t.Kind() == reflect.Struct && t.PkgPath() != "time"
+}
+
+// nestedStruct returns the structure or the slice of the field value, nil pointers and zero structures are skipped
+func nestedStruct(v reflect.Value) (reflect.Value, bool) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.Struct && v.IsZero() {
+		return reflect.Value{}, false
+	}
+
+	return v, true
+}
+
+// setStructValue sets the value to the structure field if the types are compatible
+func setStructValue(field reflect.Value, value interface{}) {
+	if !field.CanSet() || isNilValue(value) {
+		return
+	}
+
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+
+	t := field.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if !convertible(rv.Type(), t) {
+		return
+	}
+
+	if field.Kind() == reflect.Ptr {
+		newValue := reflect.New(t)
+		newValue.Elem().Set(rv.Convert(t))
+		field.Set(newValue)
+	} else {
+		field.Set(rv.Convert(t))
+	}
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t
+}
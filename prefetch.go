@@ -0,0 +1,78 @@
+package model
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-qbit/timelog"
+)
+
+const defaultPrefetchConcurrency = 4
+
+type prefetchJob struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// prefetch runs the jobs using at most prefetchConcurrency goroutines. The timelog entries are created in the jobs order,
+// the error of the first failed job is returned regardless of the completion order.
+func (m *BaseModel) prefetch(ctx context.Context, jobs []prefetchJob) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	// timelog is not safe for concurrent use, so the entries are started here
+	jobsCtx := make([]context.Context, len(jobs))
+	for i, job := range jobs {
+		jobsCtx[i] = timelog.Start(ctx, job.name)
+	}
+
+	errs := make([]error, len(jobs))
+	runJob := func(i int) {
+		defer timelog.Finish(jobsCtx[i])
+
+		if err := ctx.Err(); err != nil {
+			errs[i] = err
+			return
+		}
+
+		errs[i] = jobs[i].run(jobsCtx[i])
+	}
+
+	if m.prefetchConcurrency == 1 || len(jobs) == 1 {
+		for i := range jobs {
+			runJob(i)
+		}
+	} else {
+		workers := m.prefetchConcurrency
+		if workers > len(jobs) {
+			workers = len(jobs)
+		}
+
+		next := make(chan int)
+		wg := &sync.WaitGroup{}
+		wg.Add(workers)
+		for w := 0; w < workers; w++ {
+			go func() {
+				defer wg.Done()
+				for i := range next {
+					runJob(i)
+				}
+			}()
+		}
+
+		for i := range jobs {
+			next <- i
+		}
+		close(next)
+		wg.Wait()
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
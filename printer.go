@@ -0,0 +1,221 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	exprPrecedenceOr = iota + 1
+	exprPrecedenceAnd
+	exprPrecedenceCompare
+	exprPrecedenceAtom
+)
+
+// ExprPrinter renders an expression as a human-readable SQL-ish infix text
+// with model-qualified fields, e.g. "user.id < 4 AND user.tenant_id = 7".
+type ExprPrinter struct {
+	RedactValues bool // Print '?' instead of the values
+}
+
+type printedExpr struct {
+	text       string
+	precedence int
+	null       bool
+}
+
+// ExprToString returns a text representation of the expression with all values
+func ExprToString(e IExpression) string {
+	return (&ExprPrinter{}).Print(e)
+}
+
+func (p *ExprPrinter) Print(e IExpression) string {
+	if e == nil {
+		return ""
+	}
+
+	return p.print(e).text
+}
+
+func (p *ExprPrinter) print(e IExpression) *printedExpr {
+	return e.GetProcessor(p).(*printedExpr)
+}
+
+func (p *ExprPrinter) operand(e IExpression, minPrecedence int) string {
+	res := p.print(e)
+	if res.precedence < minPrecedence {
+		return "(" + res.text + ")"
+	}
+
+	return res.text
+}
+
+func (p *ExprPrinter) compare(op string, op1, op2 IExpression) interface{} {
+	return &printedExpr{
+		text:       p.operand(op1, exprPrecedenceAtom) + " " + op + " " + p.operand(op2, exprPrecedenceAtom),
+		precedence: exprPrecedenceCompare,
+	}
+}
+
+func (p *ExprPrinter) isNull(e IExpression) bool {
+	return p.print(e).null
+}
+
+func (p *ExprPrinter) Eq(op1, op2 IExpression) interface{} {
+	if p.isNull(op2) {
+		return &printedExpr{text: p.operand(op1, exprPrecedenceAtom) + " IS NULL", precedence: exprPrecedenceCompare}
+	}
+
+	return p.compare("=", op1, op2)
+}
+
+func (p *ExprPrinter) Ne(op1, op2 IExpression) interface{} {
+	if p.isNull(op2) {
+		return &printedExpr{text: p.operand(op1, exprPrecedenceAtom) + " IS NOT NULL", precedence: exprPrecedenceCompare}
+	}
+
+	return p.compare("!=", op1, op2)
+}
+
+func (p *ExprPrinter) Lt(op1, op2 IExpression) interface{} { return p.compare("<", op1, op2) }
+func (p *ExprPrinter) Le(op1, op2 IExpression) interface{} { return p.compare("<=", op1, op2) }
+func (p *ExprPrinter) Gt(op1, op2 IExpression) interface{} { return p.compare(">", op1, op2) }
+func (p *ExprPrinter) Ge(op1, op2 IExpression) interface{} { return p.compare(">=", op1, op2) }
+
+func (p *ExprPrinter) In(op IExpression, arr []IExpression) interface{} {
+	buf := &bytes.Buffer{}
+
+	buf.WriteString(p.operand(op, exprPrecedenceAtom))
+	buf.WriteString(" IN (")
+	for i, value := range arr {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(p.operand(value, exprPrecedenceAtom))
+	}
+	buf.WriteByte(')')
+
+	return &printedExpr{text: buf.String(), precedence: exprPrecedenceCompare}
+}
+
+func (p *ExprPrinter) logical(op string, precedence int, operands []IExpression) interface{} {
+	texts := make([]string, len(operands))
+	for i, operand := range operands {
+		texts[i] = p.operand(operand, precedence)
+	}
+
+	return &printedExpr{text: strings.Join(texts, " "+op+" "), precedence: precedence}
+}
+
+func (p *ExprPrinter) And(operands []IExpression) interface{} {
+	return p.logical("AND", exprPrecedenceAnd, operands)
+}
+
+func (p *ExprPrinter) Or(operands []IExpression) interface{} {
+	return p.logical("OR", exprPrecedenceOr, operands)
+}
+
+func (p *ExprPrinter) Any(localModel IModel, relationName string, filter IExpression) interface{} {
+	text := "ANY(" + localModel.GetId() + " -> " + relationName
+	if filter != nil {
+		text += " WHERE " + p.print(filter).text
+	}
+	text += ")"
+
+	return &printedExpr{text: text, precedence: exprPrecedenceAtom}
+}
+
+func (p *ExprPrinter) ModelField(m IModel, fieldName string) interface{} {
+	return &printedExpr{text: m.GetId() + "." + fieldName, precedence: exprPrecedenceAtom}
+}
+
+func (p *ExprPrinter) Value(value interface{}) interface{} {
+	return &printedExpr{
+		text:       formatExprValue(value, p.RedactValues),
+		precedence: exprPrecedenceAtom,
+		null:       isNilValue(value),
+	}
+}
+
+func (p *ExprPrinter) Func(name string, params ...IExpression) interface{} {
+	texts := make([]string, len(params))
+	for i, param := range params {
+		texts[i] = p.print(param).text
+	}
+
+	return &printedExpr{text: name + "(" + strings.Join(texts, ", ") + ")", precedence: exprPrecedenceAtom}
+}
+
+func (p *ExprPrinter) Excluded(fieldName string) interface{} {
+	return &printedExpr{text: "excluded." + fieldName, precedence: exprPrecedenceAtom}
+}
+
+func isNilValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(value)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
+
+func formatExprValue(value interface{}, redact bool) string {
+	if isNilValue(value) {
+		return "NULL"
+	}
+
+	if redact {
+		return "?"
+	}
+
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+
+	switch v := rv.Interface().(type) {
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case time.Time:
+		return "'" + v.Format(time.RFC3339Nano) + "'"
+	case []byte:
+		return "0x" + fmt.Sprintf("%X", v)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// filterLogMessage is a lazy timelog message, the filter is rendered only on analyzing the timelog
+type filterLogMessage struct {
+	action string
+	filter IExpression
+	redact bool
+}
+
+func newFilterLogMessage(ctx context.Context, action string) *filterLogMessage {
+	return &filterLogMessage{action: action, redact: !isLogFilterValues(ctx)}
+}
+
+func (m *filterLogMessage) String() string {
+	if m.filter == nil {
+		return m.action
+	}
+
+	return m.action + " WHERE " + (&ExprPrinter{RedactValues: m.redact}).Print(m.filter)
+}
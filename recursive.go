@@ -0,0 +1,108 @@
+package model
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/go-qbit/qerror"
+)
+
+// Recursive relation fields are requested as "<relation>*<depth>.<field>", e.g. "children*3.name",
+// or "<relation>*.<field>" for the unlimited depth. The result is nested under the relation name.
+
+type recursionCtxKey struct {
+	modelId, relationName string
+}
+
+// recursionState keeps the ancestors of the rows of the next recursion level, it is used for cycle detection.
+// The ancestors are grouped by the values of fkFieldsNames, a single group is used for the junction relations.
+type recursionState struct {
+	fkFieldsNames []string
+	ancestors     map[string]map[string]struct{}
+}
+
+// parseRelationName returns the relation name and the recursion depth: 0 for not recursive fields, -1 for the unlimited depth
+func parseRelationName(name string) (string, int, error) {
+	parts := strings.SplitN(name, "*", 2)
+	if len(parts) == 1 {
+		return name, 0, nil
+	}
+
+	if parts[1] == "" {
+		return parts[0], -1, nil
+	}
+
+	depth, err := strconv.Atoi(parts[1])
+	if err != nil || depth < 1 {
+		return "", 0, qerror.Errorf("Invalid recursion depth in the field '%s'", name)
+	}
+
+	return parts[0], depth, nil
+}
+
+// recursiveFieldsNames returns the fields of the next recursion level
+func recursiveFieldsNames(relationName string, depth int, fieldsNames []string) []string {
+	if depth == 1 {
+		return nil
+	}
+
+	prefix := relationName + "*"
+	if depth > 1 {
+		prefix += strconv.Itoa(depth - 1)
+	}
+
+	res := make([]string, len(fieldsNames))
+	for i, fieldName := range fieldsNames {
+		res[i] = prefix + "." + fieldName
+	}
+
+	return res
+}
+
+// recursionSources returns the rows which relations must be fetched, the rows already fetched on the path from the root are skipped
+func (m *BaseModel) recursionSources(ctx context.Context, relationName string, relation Relation, values []map[string]interface{}) ([]map[string]interface{}, context.Context) {
+	ctxKey := recursionCtxKey{m.GetId(), relationName}
+	state, _ := ctx.Value(ctxKey).(*recursionState)
+
+	next := &recursionState{ancestors: make(map[string]map[string]struct{})}
+	if relation.JunctionModel == nil {
+		next.fkFieldsNames = relation.FkFieldsNames
+	}
+
+	res := make([]map[string]interface{}, 0, len(values))
+	for _, row := range values {
+		key := m.FieldsToString(m.GetPKFieldsNames(), row)
+
+		var ancestors map[string]struct{}
+		if state != nil {
+			groupKey := ""
+			if state.fkFieldsNames != nil {
+				groupKey = m.FieldsToString(state.fkFieldsNames, row)
+			}
+			ancestors = state.ancestors[groupKey]
+		}
+
+		if _, isCycle := ancestors[key]; isCycle {
+			continue
+		}
+		res = append(res, row)
+
+		groupKey := ""
+		if next.fkFieldsNames != nil {
+			groupKey = m.FieldsToString(relation.LocalFieldsNames, row)
+		}
+
+		group, exists := next.ancestors[groupKey]
+		if !exists {
+			group = make(map[string]struct{}, len(ancestors)+1)
+			next.ancestors[groupKey] = group
+		}
+		for ancestor := range ancestors {
+			group[ancestor] = struct{}{}
+		}
+		group[key] = struct{}{}
+	}
+
+	return res, context.WithValue(ctx, ctxKey, next)
+}
@@ -2,9 +2,17 @@ package relation
 
 import "github.com/go-qbit/model"
 
+const (
+	NoAction = model.ON_DELETE_NO_ACTION
+	Cascade  = model.ON_DELETE_CASCADE
+	Restrict = model.ON_DELETE_RESTRICT
+	SetNull  = model.ON_DELETE_SET_NULL
+)
+
 type relationOpts struct {
 	required         bool
 	alias, backAlias string
+	onDelete         model.OnDeleteAction
 }
 
 type relationOptsFunc func(opts *relationOpts)
@@ -27,19 +35,62 @@ func WithBackAlias(alias string) relationOptsFunc {
 	}
 }
 
+// WithOnDelete sets the action on the rows of model1 when the linked row of model2 is deleted.
+// For many-to-many relations it is applied to the links only, NoAction and Cascade delete the links.
+// The action is applied to the rows hidden by DefaultFilter and soft delete too, Cascade deletes them permanently.
+func WithOnDelete(action model.OnDeleteAction) relationOptsFunc {
+	return func(opts *relationOpts) {
+		opts.onDelete = action
+	}
+}
+
+// names returns the names of the models in the junction model used for its id and FK fields.
+// The models ids are used like before the aliases were introduced, so the existing schemas are kept.
+// The aliases are used only if the ids collide: for the self-relation and for the second relation between the models.
+func (o *relationOpts) names(model1, model2 model.IModel) (string, string) {
+	name1, name2 := model1.GetId(), model2.GetId()
+	if name1 != name2 && !linked(model1, model2) {
+		return name1, name2
+	}
+
+	if o.backAlias != "" {
+		name1 = o.backAlias
+	}
+	if o.alias != "" {
+		name2 = o.alias
+	}
+
+	return name1, name2
+}
+
+// linked reports if model1 already has a many-to-many relation with model2
+func linked(model1, model2 model.IModel) bool {
+	for _, relation := range model1.GetRelations() {
+		if relation.RelationType == model.RELATION_MANY_TO_MANY && relation.ExtModel.GetId() == model2.GetId() {
+			return true
+		}
+	}
+
+	return false
+}
+
 func AddOneToOne(model1, model2 model.IModel, opts ...relationOptsFunc) {
 	o := &relationOpts{}
 	for _, optFunc := range opts {
 		optFunc(o)
 	}
 
+	if o.onDelete == SetNull {
+		panic("SetNull cannot be used for the one-to-one relation, the rows are linked by the primary key")
+	}
+
 	model1.AddRelation(model.Relation{
 		ExtModel:         model2,
 		RelationType:     model.RELATION_ONE_TO_ONE,
 		LocalFieldsNames: model1.GetPKFieldsNames(),
 		FkFieldsNames:    model2.GetPKFieldsNames(),
 		IsRequired:       o.required,
-	}, "", nil)
+	}, o.alias, nil)
 
 	model2.AddRelation(model.Relation{
 		ExtModel:         model1,
@@ -48,7 +99,8 @@ func AddOneToOne(model1, model2 model.IModel, opts ...relationOptsFunc) {
 		FkFieldsNames:    model1.GetPKFieldsNames(),
 		IsRequired:       true,
 		IsBack:           true,
-	}, "", nil)
+		OnDelete:         o.onDelete,
+	}, o.backAlias, nil)
 }
 
 func AddManyToOne(model1, model2 model.IModel, opts ...relationOptsFunc) {
@@ -57,6 +109,10 @@ func AddManyToOne(model1, model2 model.IModel, opts ...relationOptsFunc) {
 		optFunc(o)
 	}
 
+	if o.onDelete == SetNull && o.required {
+		panic("SetNull cannot be used for the required relation")
+	}
+
 	fkFieldsNames := make([]string, len(model2.GetPKFieldsNames()))
 	fkFields := make([]model.IFieldDefinition, len(fkFieldsNames))
 	for i, pkFieldName := range model2.GetPKFieldsNames() {
@@ -84,9 +140,10 @@ func AddManyToOne(model1, model2 model.IModel, opts ...relationOptsFunc) {
 	model2.AddRelation(model.Relation{
 		ExtModel:         model1,
 		RelationType:     model.RELATION_ONE_TO_MANY,
-		LocalFieldsNames: model1.GetPKFieldsNames(),
+		LocalFieldsNames: model2.GetPKFieldsNames(),
 		FkFieldsNames:    fkFieldsNames,
 		IsBack:           true,
+		OnDelete:         o.onDelete,
 	}, o.backAlias, nil)
 }
 
@@ -96,24 +153,30 @@ func AddManyToMany(model1, model2 model.IModel, storage model.IStorage, opts ...
 		optFunc(o)
 	}
 
+	if o.onDelete == SetNull {
+		panic("SetNull cannot be used for the many-to-many relation")
+	}
+
 	junctionPkFields := make([]string, 0, len(model1.GetPKFieldsNames())+len(model2.GetPKFieldsNames()))
 	junctionFields := make([]model.IFieldDefinition, 0, len(junctionPkFields))
 
+	name1, name2 := o.names(model1, model2)
+
 	fk1Fields := make([]string, len(model1.GetPKFieldsNames()))
 	for i, pkFieldName := range model1.GetPKFieldsNames() {
-		fk1Fields[i] = "fk_" + model1.GetId() + "_" + pkFieldName
+		fk1Fields[i] = "fk_" + name1 + "_" + pkFieldName
 		junctionPkFields = append(junctionPkFields, fk1Fields[i])
 		junctionFields = append(junctionFields, model1.GetFieldDefinition(pkFieldName).CloneForFK(fk1Fields[i], "FK field", true))
 	}
 
 	fk2Fields := make([]string, len(model2.GetPKFieldsNames()))
 	for i, pkFieldName := range model2.GetPKFieldsNames() {
-		fk2Fields[i] = "fk_" + model2.GetId() + "_" + pkFieldName
+		fk2Fields[i] = "fk_" + name2 + "_" + pkFieldName
 		junctionPkFields = append(junctionPkFields, fk2Fields[i])
 		junctionFields = append(junctionFields, model2.GetFieldDefinition(pkFieldName).CloneForFK(fk2Fields[i], "FK field", true))
 	}
 
-	junctionModel := storage.NewModel("_junction__"+model1.GetId()+"__"+model2.GetId(), junctionFields, model.BaseModelOpts{
+	junctionModel := storage.NewModel("_junction__"+model1.GetId()+"__"+name2, junctionFields, model.BaseModelOpts{
 		PkFieldsNames: junctionPkFields,
 	})
 
@@ -126,7 +189,8 @@ func AddManyToMany(model1, model2 model.IModel, storage model.IStorage, opts ...
 		JunctionModel:            junctionModel,
 		JunctionLocalFieldsNames: fk1Fields,
 		JunctionFkFieldsNames:    fk2Fields,
-	}, "", nil)
+		OnDelete:                 o.onDelete,
+	}, o.alias, nil)
 
 	model2.AddRelation(model.Relation{
 		ExtModel:                 model1,
@@ -138,7 +202,8 @@ func AddManyToMany(model1, model2 model.IModel, storage model.IStorage, opts ...
 		JunctionLocalFieldsNames: fk2Fields,
 		JunctionFkFieldsNames:    fk1Fields,
 		IsBack:                   true,
-	}, "", nil)
+		OnDelete:                 o.onDelete,
+	}, o.backAlias, nil)
 
 	junctionModel.AddRelation(model.Relation{
 		ExtModel:         model1,
@@ -146,7 +211,7 @@ func AddManyToMany(model1, model2 model.IModel, storage model.IStorage, opts ...
 		IsRequired:       true,
 		LocalFieldsNames: fk1Fields,
 		FkFieldsNames:    model1.GetPKFieldsNames(),
-	}, "", nil)
+	}, name1, nil)
 
 	junctionModel.AddRelation(model.Relation{
 		ExtModel:         model2,
@@ -154,54 +219,64 @@ func AddManyToMany(model1, model2 model.IModel, storage model.IStorage, opts ...
 		IsRequired:       true,
 		LocalFieldsNames: fk2Fields,
 		FkFieldsNames:    model2.GetPKFieldsNames(),
-	}, "", nil)
+	}, name2, nil)
 }
 
+// AddManyToManyUsingTable adds many-to-many relation using the junction model, the FK fields are added to it.
+// The other fields of the junction model are available as "<relation>.@<field>" in GetAll.
 func AddManyToManyUsingTable(model1, model2, junction model.IModel, opts ...relationOptsFunc) {
 	o := &relationOpts{}
 	for _, optFunc := range opts {
 		optFunc(o)
 	}
 
+	if o.onDelete == SetNull {
+		panic("SetNull cannot be used for the many-to-many relation")
+	}
+
 	junctionPkFields := make([]string, 0, len(model1.GetPKFieldsNames())+len(model2.GetPKFieldsNames()))
 	junctionFields := make([]model.IFieldDefinition, 0, len(junctionPkFields))
 
+	name1, name2 := o.names(model1, model2)
+
 	fk1Fields := make([]string, len(model1.GetPKFieldsNames()))
 	for i, pkFieldName := range model1.GetPKFieldsNames() {
-		fk1Fields[i] = "fk_" + model1.GetId() + "_" + pkFieldName
+		fk1Fields[i] = "fk_" + name1 + "_" + pkFieldName
 		junctionPkFields = append(junctionPkFields, fk1Fields[i])
 		junctionFields = append(junctionFields, model1.GetFieldDefinition(pkFieldName).CloneForFK(fk1Fields[i], "FK field", true))
 	}
 
 	fk2Fields := make([]string, len(model2.GetPKFieldsNames()))
 	for i, pkFieldName := range model2.GetPKFieldsNames() {
-		fk2Fields[i] = "fk_" + model2.GetId() + "_" + pkFieldName
+		fk2Fields[i] = "fk_" + name2 + "_" + pkFieldName
 		junctionPkFields = append(junctionPkFields, fk2Fields[i])
 		junctionFields = append(junctionFields, model2.GetFieldDefinition(pkFieldName).CloneForFK(fk2Fields[i], "FK field", true))
 	}
 
-	//model1.AddRelation(model.Relation{
-	//	ExtModel:                 model2,
-	//	RelationType:             model.RELATION_MANY_TO_MANY,
-	//	IsRequired:               true,
-	//	LocalFieldsNames:         model1.GetPKFieldsNames(),
-	//	FkFieldsNames:            model2.GetPKFieldsNames(),
-	//	JunctionModel:            junction,
-	//	JunctionLocalFieldsNames: fk1Fields,
-	//	JunctionFkFieldsNames:    fk2Fields,
-	//}, "", nil)
-	//
-	//model2.AddRelation(model.Relation{
-	//	ExtModel:                 model1,
-	//	RelationType:             model.RELATION_MANY_TO_MANY,
-	//	IsRequired:               true,
-	//	LocalFieldsNames:         model2.GetPKFieldsNames(),
-	//	FkFieldsNames:            model1.GetPKFieldsNames(),
-	//	JunctionModel:            junction,
-	//	JunctionLocalFieldsNames: fk2Fields,
-	//	JunctionFkFieldsNames:    fk1Fields,
-	//	IsBack:                   true,
-	//}, "", nil)
+	model1.AddRelation(model.Relation{
+		ExtModel:                 model2,
+		RelationType:             model.RELATION_MANY_TO_MANY,
+		IsRequired:               true,
+		LocalFieldsNames:         model1.GetPKFieldsNames(),
+		FkFieldsNames:            model2.GetPKFieldsNames(),
+		JunctionModel:            junction,
+		JunctionLocalFieldsNames: fk1Fields,
+		JunctionFkFieldsNames:    fk2Fields,
+		OnDelete:                 o.onDelete,
+	}, o.alias, nil)
+
+	model2.AddRelation(model.Relation{
+		ExtModel:                 model1,
+		RelationType:             model.RELATION_MANY_TO_MANY,
+		IsRequired:               true,
+		LocalFieldsNames:         model2.GetPKFieldsNames(),
+		FkFieldsNames:            model1.GetPKFieldsNames(),
+		JunctionModel:            junction,
+		JunctionLocalFieldsNames: fk2Fields,
+		JunctionFkFieldsNames:    fk1Fields,
+		IsBack:                   true,
+		OnDelete:                 o.onDelete,
+	}, o.backAlias, nil)
 
 	junction.AddRelation(model.Relation{
 		ExtModel:         model1,
@@ -210,7 +285,7 @@ func AddManyToManyUsingTable(model1, model2, junction model.IModel, opts ...rela
 		PkFieldsNames:    junctionPkFields,
 		LocalFieldsNames: fk1Fields,
 		FkFieldsNames:    model1.GetPKFieldsNames(),
-	}, "", junctionFields)
+	}, name1, junctionFields)
 
 	junction.AddRelation(model.Relation{
 		ExtModel:         model2,
@@ -218,5 +293,5 @@ func AddManyToManyUsingTable(model1, model2, junction model.IModel, opts ...rela
 		IsRequired:       true,
 		LocalFieldsNames: fk2Fields,
 		FkFieldsNames:    model2.GetPKFieldsNames(),
-	}, "", nil)
+	}, name2, nil)
 }
@@ -0,0 +1,137 @@
+package model
+
+import (
+	"context"
+
+	"github.com/go-qbit/qerror"
+	"github.com/go-qbit/timelog"
+)
+
+// EditReturning changes the rows like Edit and returns the number of the matched rows.
+// If the returning fields are not empty, the new values of the fields of the changed rows are returned too.
+func (m *BaseModel) EditReturning(ctx context.Context, filter IExpression, newValues map[string]interface{}, returning []string) (uint64, *Data, error) {
+	logMessage := newFilterLogMessage(ctx, m.GetId()+": EditReturning")
+	ctx = timelog.Start(ctx, logMessage)
+	defer timelog.Finish(ctx)
+
+	return m.edit(ctx, logMessage, filter, newValues, returning)
+}
+
+// DeleteReturning deletes the rows like Delete and returns the number of the deleted rows.
+// If the returning fields are not empty, the values of the fields of the deleted rows are returned too.
+func (m *BaseModel) DeleteReturning(ctx context.Context, filter IExpression, returning []string) (uint64, *Data, error) {
+	logMessage := newFilterLogMessage(ctx, m.GetId()+": DeleteReturning")
+	ctx = timelog.Start(ctx, logMessage)
+	defer timelog.Finish(ctx)
+
+	return m.delete(ctx, logMessage, filter, returning)
+}
+
+func (m *BaseModel) checkReturning(returning []string) error {
+	for _, fieldName := range returning {
+		if field := m.GetFieldDefinition(fieldName); field == nil || field.IsDerivable() {
+			return qerror.Errorf("Invalid returning field '%s' in model '%s'", fieldName, m.GetId())
+		}
+	}
+
+	return nil
+}
+
+// storageEdit changes the rows in the storage, the storages without IReturningStorage support
+// are queried for the changed rows after the change
+func (m *BaseModel) storageEdit(ctx context.Context, filter IExpression, newValues map[string]interface{}, returning []string) (uint64, *Data, error) {
+	if len(returning) == 0 {
+		count, err := m.storage.Edit(ctx, m, filter, newValues)
+		return count, nil, err
+	}
+
+	if storage, ok := m.storage.(IReturningStorage); ok {
+		data, err := storage.EditReturning(ctx, m, filter, newValues, returning)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		return uint64(data.Len()), data, nil
+	}
+
+	var (
+		count uint64
+		data  *Data
+	)
+	err := m.inTransaction(ctx, func(ctx context.Context) error {
+		pkData, err := m.storage.Query(ctx, m, m.pkFieldsNames, GetAllOptions{Filter: filter, ForUpdate: true})
+		if err != nil {
+			return err
+		}
+
+		if count, err = m.storage.Edit(ctx, m, filter, newValues); err != nil {
+			return err
+		}
+
+		// The primary key can be changed too
+		keys := pkData.Data()
+		for _, key := range keys {
+			for i, fieldName := range m.pkFieldsNames {
+				if value, exists := newValues[fieldName]; exists {
+					key[i] = value
+				}
+			}
+		}
+
+		data, err = m.queryKeys(ctx, returning, keys)
+
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return count, data, nil
+}
+
+// storageDelete deletes the rows from the storage, the storages without IReturningStorage support
+// are queried for the deleted rows before the deletion
+func (m *BaseModel) storageDelete(ctx context.Context, filter IExpression, returning []string) (uint64, *Data, error) {
+	if len(returning) == 0 {
+		count, err := m.storage.Delete(ctx, m, filter)
+		return count, nil, err
+	}
+
+	if storage, ok := m.storage.(IReturningStorage); ok {
+		data, err := storage.DeleteReturning(ctx, m, filter, returning)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		return uint64(data.Len()), data, nil
+	}
+
+	var (
+		count uint64
+		data  *Data
+	)
+	err := m.inTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if data, err = m.storage.Query(ctx, m, returning, GetAllOptions{Filter: filter, ForUpdate: true}); err != nil {
+			return err
+		}
+
+		count, err = m.storage.Delete(ctx, m, filter)
+
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return count, data, nil
+}
+
+// queryKeys returns the fields values of the rows with the primary keys
+func (m *BaseModel) queryKeys(ctx context.Context, fieldsNames []string, keys [][]interface{}) (*Data, error) {
+	if len(keys) == 0 {
+		return NewEmptyData(fieldsNames), nil
+	}
+
+	return m.storage.Query(ctx, m, fieldsNames, GetAllOptions{Filter: keysFilter(m, m.pkFieldsNames, keys)})
+}
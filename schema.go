@@ -0,0 +1,91 @@
+package model
+
+import (
+	"strings"
+)
+
+// Schema describes the stored structure of the model for the schema export and the DDL generation
+type Schema struct {
+	Id            string
+	Fields        []SchemaField
+	PkFieldsNames []string
+	UniqueKeys    [][]string
+}
+
+// SchemaField is the stored field of the model, the derivable fields are not stored
+type SchemaField struct {
+	Id          string
+	Caption     string
+	StorageType string
+	Required    bool
+}
+
+// GetSchema returns the schema of the model with its stored fields, primary and unique keys
+func GetSchema(m IModel) *Schema {
+	s := &Schema{
+		Id:            m.GetId(),
+		PkFieldsNames: m.GetPKFieldsNames(),
+		UniqueKeys:    m.GetUniqueKeys(),
+	}
+
+	for _, fieldName := range m.GetFieldsNames() {
+		field := m.GetFieldDefinition(fieldName)
+		if field.IsDerivable() {
+			continue
+		}
+
+		s.Fields = append(s.Fields, SchemaField{
+			Id:          field.GetId(),
+			Caption:     field.GetCaption(),
+			StorageType: field.GetStorageType(),
+			Required:    field.IsRequired(),
+		})
+	}
+
+	return s
+}
+
+// DDL returns the CREATE TABLE statement of the schema with the primary and the unique keys constraints.
+// The columnType returns the type of the field column in the storage, the field storage type is used if it is nil.
+func (s *Schema) DDL(columnType func(SchemaField) string) string {
+	if columnType == nil {
+		columnType = func(field SchemaField) string { return field.StorageType }
+	}
+
+	pkFields := make(map[string]struct{}, len(s.PkFieldsNames))
+	for _, fieldName := range s.PkFieldsNames {
+		pkFields[fieldName] = struct{}{}
+	}
+
+	lines := make([]string, 0, len(s.Fields)+len(s.UniqueKeys)+1)
+	for _, field := range s.Fields {
+		line := quoteIdent(field.Id) + " " + columnType(field)
+		if _, isPk := pkFields[field.Id]; isPk || field.Required {
+			line += " NOT NULL"
+		}
+		lines = append(lines, line)
+	}
+
+	if len(s.PkFieldsNames) > 0 {
+		lines = append(lines, "PRIMARY KEY ("+quoteIdents(s.PkFieldsNames)+")")
+	}
+
+	for _, key := range s.UniqueKeys {
+		lines = append(lines, "UNIQUE ("+quoteIdents(key)+")")
+	}
+
+	return "CREATE TABLE " + quoteIdent(s.Id) + " (\n\t" + strings.Join(lines, ",\n\t") + "\n)"
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteIdents(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdent(name)
+	}
+
+	return strings.Join(quoted, ", ")
+}
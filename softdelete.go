@@ -0,0 +1,49 @@
+package model
+
+import (
+	"context"
+
+	"github.com/go-qbit/qerror"
+	"github.com/go-qbit/rbac"
+	"github.com/go-qbit/timelog"
+)
+
+// SOFT_DELETE_FIELD is the field added to the models with the SoftDelete option, it is NULL for the not deleted rows
+const SOFT_DELETE_FIELD = "deleted_at"
+
+// HardDelete deletes the rows from the storage including the soft-deleted ones, the relations OnDelete actions are applied.
+// For the models without SoftDelete option it is the same as Delete.
+func (m *BaseModel) HardDelete(ctx context.Context, filter IExpression) error {
+	ctx = context.WithValue(WithDeleted(ctx), hardDeleteCtx, true)
+
+	return m.Delete(ctx, filter)
+}
+
+// Restore clears the deletion time of the soft-deleted rows matched the filter
+func (m *BaseModel) Restore(ctx context.Context, filter IExpression) error {
+	logMessage := newFilterLogMessage(ctx, m.GetId()+": Restore")
+	ctx = timelog.Start(ctx, logMessage)
+	defer timelog.Finish(ctx)
+
+	if !m.softDelete {
+		return qerror.Errorf("Model '%s' does not support soft delete", m.GetId())
+	}
+
+	if m.deletePermission != nil && !rbac.HasPermission(ctx, m.deletePermission) {
+		return DeleteErrorf("You don't have permission")
+	}
+
+	resFilter, err := m.withDefaultFilter(WithDeleted(ctx), andFilter(exprNe(m.FieldExpr(SOFT_DELETE_FIELD), exprValue(nil)), filter))
+	if err != nil {
+		return err
+	}
+
+	if err := validate(ctx, m, resFilter); err != nil {
+		return err
+	}
+	logMessage.filter = resFilter
+
+	_, _, err = m.storageEditVersioned(ctx, resFilter, map[string]interface{}{SOFT_DELETE_FIELD: nil}, nil)
+
+	return err
+}
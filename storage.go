@@ -9,6 +9,57 @@ type IStorage interface {
 	RegisterModel(IModel) error
 	Add(context.Context, IModel, *Data, AddOptions) (*Data, error)
 	Query(context.Context, IModel, []string, GetAllOptions) (*Data, error)
-	Edit(context.Context, IModel, IExpression, map[string]interface{}) error
-	Delete(context.Context, IModel, IExpression) error
+	Edit(context.Context, IModel, IExpression, map[string]interface{}) (uint64, error) // Returns the number of the matched rows
+	Delete(context.Context, IModel, IExpression) (uint64, error)                       // Returns the number of the deleted rows
+}
+
+// ITransactionalStorage is implemented by the storages which can run several operations atomically.
+// Nested calls must join the outer transaction.
+type ITransactionalStorage interface {
+	IStorage
+	RunInTransaction(context.Context, func(context.Context) error) error
+}
+
+// IAggregateStorage is implemented by the storages which can count the rows by groups.
+// The result contains the groupBy fields and the number of rows in the AGGREGATE_COUNT field.
+type IAggregateStorage interface {
+	IStorage
+	CountGroups(ctx context.Context, m IModel, groupBy []string, filter IExpression) (*Data, error)
+}
+
+// ICountStorage is implemented by the storages which can count the rows matched the filter without reading them
+type ICountStorage interface {
+	IStorage
+	Count(ctx context.Context, m IModel, filter IExpression) (uint64, error)
+	Exists(ctx context.Context, m IModel, filter IExpression) (bool, error)
+}
+
+// IReturningStorage is implemented by the storages which can return the changed rows in the same operation.
+// EditReturning returns the rows values after the change, DeleteReturning returns the values of the deleted rows.
+type IReturningStorage interface {
+	IStorage
+	EditReturning(ctx context.Context, m IModel, filter IExpression, newValues map[string]interface{}, fieldsNames []string) (*Data, error)
+	DeleteReturning(ctx context.Context, m IModel, filter IExpression, fieldsNames []string) (*Data, error)
+}
+
+// IBatchEditStorage is implemented by the storages which can change many rows to different values in one operation.
+// The data contains the primary key fields and the new values of the other fields,
+// only the rows matched the filter are changed. Returns the number of the matched rows.
+type IBatchEditStorage interface {
+	IStorage
+	EditMulti(ctx context.Context, m IModel, data *Data, filter IExpression) (uint64, error)
+}
+
+// IPartitionStorage is implemented by the storages which apply Limit and Offset to every partition of the rows,
+// see GetAllOptions.PartitionBy. For the other storages the rows are queried without the limits and limited in memory.
+type IPartitionStorage interface {
+	IStorage
+	SupportsPartitionBy() bool
+}
+
+// IUniqueStorage is implemented by the storages which check the unique keys of the models themselves and return
+// UniqueViolationError. For the other storages the added and the changed rows are checked by the model.
+type IUniqueStorage interface {
+	IStorage
+	SupportsUniqueKeys() bool
 }
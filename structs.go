@@ -0,0 +1,163 @@
+package model
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/go-qbit/qerror"
+)
+
+// EditFromStruct changes the rows to the values of the structure fields, the fields are mapped like in AddFromStructs.
+// The rows are selected by the filter if pkOrFilter is IExpression, by the primary key value otherwise
+// (the slice of values for the composite key) or by the primary key fields of the structure if it is nil.
+// Only the fields from the mask are changed, all the fields except the primary key ones and the fields changed
+// by the model (VERSION_FIELD and SOFT_DELETE_FIELD) if the mask is empty.
+// The nil pointer fields are not changed, use Edit to set NULL values.
+func (m *BaseModel) EditFromStruct(ctx context.Context, pkOrFilter interface{}, data interface{}, fieldMask []string) error {
+	row, ok := nestedStruct(reflect.ValueOf(data))
+	if !ok || row.Kind() != reflect.Struct {
+		return qerror.Errorf("Invalid type '%T', must be a structure or a pointer to structure", data)
+	}
+
+	flatFields, _ := m.structFields(row.Type(), nil)
+	fieldsNums := make(map[string]int, len(flatFields))
+	for _, field := range flatFields {
+		fieldsNums[field.name] = field.num
+	}
+
+	filter, err := m.structFilter(pkOrFilter, row, fieldsNums)
+	if err != nil {
+		return err
+	}
+
+	if len(fieldMask) == 0 {
+		pkFields := make(map[string]struct{}, len(m.pkFieldsNames))
+		for _, name := range m.pkFieldsNames {
+			pkFields[name] = struct{}{}
+		}
+
+		for _, field := range flatFields {
+			if _, exists := pkFields[field.name]; exists || m.isAutoField(field.name) {
+				continue
+			}
+			if modelField := m.GetFieldDefinition(field.name); modelField != nil && !modelField.IsDerivable() {
+				fieldMask = append(fieldMask, field.name)
+			}
+		}
+	}
+
+	newValues := make(map[string]interface{}, len(fieldMask))
+	for _, name := range fieldMask {
+		num, exists := fieldsNums[name]
+		if !exists {
+			return qerror.Errorf("There is no field '%s' of model '%s' in structure '%s'", name, m.GetId(), row.Type())
+		}
+
+		if value, ok := structValue(row.Field(num)); ok {
+			newValues[name] = value
+		}
+	}
+
+	if len(newValues) == 0 {
+		return nil
+	}
+
+	return m.Edit(ctx, filter, newValues)
+}
+
+// DeleteStructs deletes the rows with the primary keys from the slice of structures
+func (m *BaseModel) DeleteStructs(ctx context.Context, data interface{}) error {
+	rt := reflect.TypeOf(data)
+
+	if rt == nil || rt.Kind() != reflect.Slice || indirectType(rt.Elem()).Kind() != reflect.Struct {
+		return qerror.Errorf("Invalid type '%v', must to slice of struct", rt)
+	}
+
+	if len(m.pkFieldsNames) == 0 {
+		return DeleteErrorf("Model '%s' has no primary key", m.GetId())
+	}
+
+	flatFields, _ := m.structFields(indirectType(rt.Elem()), nil)
+	fieldsNums := make(map[string]int, len(flatFields))
+	for _, field := range flatFields {
+		fieldsNums[field.name] = field.num
+	}
+
+	rData := reflect.ValueOf(data)
+	keys := make([][]interface{}, 0, rData.Len())
+	for i := 0; i < rData.Len(); i++ {
+		row, ok := nestedStruct(rData.Index(i))
+		if !ok && rData.Index(i).Kind() == reflect.Ptr {
+			return qerror.Errorf("Nil element %d in the slice", i)
+		}
+		if !ok {
+			row = rData.Index(i)
+		}
+
+		key, err := m.structPk(row, fieldsNums)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	keys = distinctKeys(keys)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return m.Delete(ctx, keysFilter(m, m.pkFieldsNames, keys))
+}
+
+// structFilter returns the filter of the rows changed by EditFromStruct
+func (m *BaseModel) structFilter(pkOrFilter interface{}, row reflect.Value, fieldsNums map[string]int) (IExpression, error) {
+	if filter, ok := pkOrFilter.(IExpression); ok {
+		return filter, nil
+	}
+
+	var key []interface{}
+	switch pk := pkOrFilter.(type) {
+	case nil:
+		var err error
+		if key, err = m.structPk(row, fieldsNums); err != nil {
+			return nil, err
+		}
+	case []interface{}:
+		key = pk
+	default:
+		key = []interface{}{pk}
+	}
+
+	return m.pkFilter(key)
+}
+
+// structPk returns the values of the primary key fields of the structure
+func (m *BaseModel) structPk(row reflect.Value, fieldsNums map[string]int) ([]interface{}, error) {
+	key := make([]interface{}, len(m.pkFieldsNames))
+	for i, name := range m.pkFieldsNames {
+		num, exists := fieldsNums[name]
+		if !exists {
+			return nil, qerror.Errorf("There is no primary key field '%s' of model '%s' in structure '%s'", name, m.GetId(), row.Type())
+		}
+
+		value, ok := structValue(row.Field(num))
+		if !ok {
+			return nil, FieldErrorf(name, "Missed primary key field '%s' value in model '%s'", name, m.GetId())
+		}
+		key[i] = value
+	}
+
+	return key, nil
+}
+
+// structValue returns the value of the structure field, it is false for nil pointers
+func structValue(field reflect.Value) (interface{}, bool) {
+	for field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return nil, false
+		}
+		field = field.Elem()
+	}
+
+	return field.Interface(), true
+}
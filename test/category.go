@@ -0,0 +1,33 @@
+package test
+
+import (
+	"github.com/go-qbit/model"
+)
+
+type Category struct {
+	*model.BaseModel
+}
+
+func NewCategory(storage model.IStorage) *Category {
+	return &Category{
+		model.NewBaseModel(
+			"category",
+			[]model.IFieldDefinition{
+				&model.IntField{
+					Id:      "id",
+					Caption: "ID",
+				},
+
+				&model.StringField{
+					Id:       "name",
+					Caption:  "Name",
+					Required: true,
+				},
+			},
+			storage,
+			model.BaseModelOpts{
+				PkFieldsNames: []string{"id"},
+			},
+		),
+	}
+}
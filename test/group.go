@@ -0,0 +1,33 @@
+package test
+
+import (
+	"github.com/go-qbit/model"
+)
+
+type Group struct {
+	*model.BaseModel
+}
+
+func NewGroup(storage model.IStorage) *Group {
+	return &Group{
+		model.NewBaseModel(
+			"group",
+			[]model.IFieldDefinition{
+				&model.IntField{
+					Id:      "id",
+					Caption: "ID",
+				},
+
+				&model.StringField{
+					Id:       "name",
+					Caption:  "Name",
+					Required: true,
+				},
+			},
+			storage,
+			model.BaseModelOpts{
+				PkFieldsNames: []string{"id"},
+			},
+		),
+	}
+}
@@ -0,0 +1,26 @@
+package test
+
+import (
+	"github.com/go-qbit/model"
+)
+
+// Membership is a junction model of users and groups, the primary key is set by the relation
+type Membership struct {
+	*model.BaseModel
+}
+
+func NewMembership(storage model.IStorage) *Membership {
+	return &Membership{
+		model.NewBaseModel(
+			"membership",
+			[]model.IFieldDefinition{
+				&model.StringField{
+					Id:      "role",
+					Caption: "Role",
+				},
+			},
+			storage,
+			model.BaseModelOpts{},
+		),
+	}
+}
@@ -0,0 +1,192 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// TypedModel is the typed API of the model with rows of the structure type T, the fields are mapped like in GetAllToStruct.
+// The fields of T are inspected once by NewTypedModel.
+type TypedModel[T any] struct {
+	model       *BaseModel
+	fieldsNames []string
+}
+
+// NewTypedModel returns the typed API of the model, it panics if T is not a structure or has invalid fields
+func NewTypedModel[T any](m *BaseModel) *TypedModel[T] {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("Invalid type %s for model %s, must be a structure", t, m.GetId()))
+	}
+
+	fieldsNames, err := m.getFieldsFromStruct(t)
+	if err != nil {
+		panic(err)
+	}
+
+	return &TypedModel[T]{m, fieldsNames}
+}
+
+// Model returns the untyped model, e.g. for the relations and the options not covered by the typed API
+func (m *TypedModel[T]) Model() *BaseModel {
+	return m.model
+}
+
+// GetAll returns the rows matched the options, the fields of T are requested
+func (m *TypedModel[T]) GetAll(ctx context.Context, opts GetAllOptions) ([]T, error) {
+	data, err := m.model.GetAll(ctx, m.fieldsNames, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]T, data.Len())
+	for i, row := range data.Maps() {
+		if err := m.model.mapToVar(row, reflect.ValueOf(&res[i]).Elem()); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// GetOne returns the single row matched the filter, see BaseModel.GetOne
+func (m *TypedModel[T]) GetOne(ctx context.Context, filter IExpression) (T, error) {
+	return m.getOne(ctx, filter)
+}
+
+// GetByPK returns the row with the primary key values, see BaseModel.GetByPK
+func (m *TypedModel[T]) GetByPK(ctx context.Context, pk ...interface{}) (T, error) {
+	filter, err := m.model.pkFilter(pk)
+	if err != nil {
+		var res T
+		return res, err
+	}
+
+	return m.getOne(ctx, filter)
+}
+
+// Add adds the rows like AddFromStructs, the generated primary keys are set to the rows
+func (m *TypedModel[T]) Add(ctx context.Context, rows []T) (*Data, error) {
+	return m.model.AddFromStructs(ctx, rows, AddOptions{})
+}
+
+// Edit changes the rows matched the filter to the values of the patch, see BaseModel.Edit
+func (m *TypedModel[T]) Edit(ctx context.Context, filter IExpression, patch Patch[T]) error {
+	return m.model.Edit(ctx, filter, patch.values)
+}
+
+// Delete deletes the rows matched the filter, see BaseModel.Delete
+func (m *TypedModel[T]) Delete(ctx context.Context, filter IExpression) error {
+	return m.model.Delete(ctx, filter)
+}
+
+func (m *TypedModel[T]) getOne(ctx context.Context, filter IExpression) (T, error) {
+	var res T
+
+	data, err := m.model.getOne(ctx, m.fieldsNames, filter)
+	if err != nil {
+		return res, err
+	}
+
+	if err := m.model.mapToVar(data.Maps()[0], reflect.ValueOf(&res).Elem()); err != nil {
+		return res, err
+	}
+
+	return res, nil
+}
+
+// Field is the handle of the field with values of type V of the model with rows of type T
+type Field[T any, V any] struct {
+	model IModel
+	name  string
+}
+
+// NewField returns the handle of the field, it panics if the field is unknown or its type differs from V
+func NewField[T any, V any](m *TypedModel[T], name string) Field[T, V] {
+	field := m.model.GetFieldDefinition(name)
+	if field == nil || field.IsDerivable() {
+		panic(fmt.Sprintf("Unknown field %s in model %s", name, m.model.GetId()))
+	}
+
+	if vt := reflect.TypeOf((*V)(nil)).Elem(); derefType(vt) != derefType(field.GetType()) {
+		panic(fmt.Sprintf("Invalid type %s of field %s in model %s, must be %s", vt, name, m.model.GetId(), field.GetType()))
+	}
+
+	return Field[T, V]{m.model, name}
+}
+
+// Name returns the name of the field in the model
+func (f Field[T, V]) Name() string {
+	return f.name
+}
+
+// Expr returns the expression of the field for the filters
+func (f Field[T, V]) Expr() IExpression {
+	return &exprModelFieldS{f.model, f.name}
+}
+
+// Eq returns the filter "field = value"
+func (f Field[T, V]) Eq(value V) IExpression { return exprEq(f.Expr(), exprValue(value)) }
+
+// Ne returns the filter "field != value"
+func (f Field[T, V]) Ne(value V) IExpression { return exprNe(f.Expr(), exprValue(value)) }
+
+// Lt returns the filter "field < value"
+func (f Field[T, V]) Lt(value V) IExpression { return exprLt(f.Expr(), exprValue(value)) }
+
+// Le returns the filter "field <= value"
+func (f Field[T, V]) Le(value V) IExpression { return exprLe(f.Expr(), exprValue(value)) }
+
+// Gt returns the filter "field > value"
+func (f Field[T, V]) Gt(value V) IExpression { return exprGt(f.Expr(), exprValue(value)) }
+
+// Ge returns the filter "field >= value"
+func (f Field[T, V]) Ge(value V) IExpression { return exprGe(f.Expr(), exprValue(value)) }
+
+// IsNull returns the filter "field IS NULL"
+func (f Field[T, V]) IsNull() IExpression { return exprEq(f.Expr(), exprValue(nil)) }
+
+// IsNotNull returns the filter "field IS NOT NULL"
+func (f Field[T, V]) IsNotNull() IExpression { return exprNe(f.Expr(), exprValue(nil)) }
+
+// In returns the filter "field IN (values)"
+func (f Field[T, V]) In(values ...V) IExpression {
+	in := exprIn(f.Expr())
+	for _, value := range values {
+		in.Add(exprValue(value))
+	}
+
+	return in
+}
+
+// Set returns the new value of the field for Patch
+func (f Field[T, V]) Set(value V) Assignment[T] {
+	return Assignment[T]{f.name, value}
+}
+
+// SetNull returns the NULL value of the field for Patch
+func (f Field[T, V]) SetNull() Assignment[T] {
+	return Assignment[T]{f.name, nil}
+}
+
+// Assignment is the new value of the field of the model with rows of type T, see Field.Set
+type Assignment[T any] struct {
+	field string
+	value interface{}
+}
+
+// Patch is the set of the new values of the fields of the model with rows of type T
+type Patch[T any] struct {
+	values map[string]interface{}
+}
+
+// NewPatch returns the patch with the new values of the fields for TypedModel.Edit
+func NewPatch[T any](assignments ...Assignment[T]) Patch[T] {
+	values := make(map[string]interface{}, len(assignments))
+	for _, assignment := range assignments {
+		values[assignment.field] = assignment.value
+	}
+
+	return Patch[T]{values}
+}
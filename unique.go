@@ -0,0 +1,229 @@
+package model
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/go-qbit/qerror"
+)
+
+func (m *BaseModel) GetUniqueKeys() [][]string {
+	return m.uniqueKeys
+}
+
+// GetByKey returns the row with the values of the primary or a unique key fields, the result is empty if there is no such row
+func (m *BaseModel) GetByKey(ctx context.Context, key map[string]interface{}, fieldsNames []string) (*Data, error) {
+	keyFieldsNames := make([]string, 0, len(key))
+	for fieldName := range key {
+		keyFieldsNames = append(keyFieldsNames, fieldName)
+	}
+	sort.Strings(keyFieldsNames)
+
+	if !m.isKey(keyFieldsNames) {
+		return nil, qerror.Errorf("The fields '%s' are not the primary or a unique key of model '%s'",
+			strings.Join(keyFieldsNames, ", "), m.GetId())
+	}
+
+	eqs := make([]IExpression, len(keyFieldsNames))
+	for i, fieldName := range keyFieldsNames {
+		if isNilValue(key[fieldName]) {
+			return nil, FieldErrorf(fieldName, "Missed the key field '%s' value in model '%s'", fieldName, m.GetId())
+		}
+		eqs[i] = exprEq(m.FieldExpr(fieldName), exprValue(key[fieldName]))
+	}
+
+	filter := eqs[0]
+	if len(eqs) > 1 {
+		filter = exprAnd(eqs...)
+	}
+
+	return m.GetAll(ctx, fieldsNames, GetAllOptions{Filter: filter})
+}
+
+// isKey checks if the fields are the primary or a unique key in any order
+func (m *BaseModel) isKey(fieldsNames []string) bool {
+	if len(fieldsNames) == 0 {
+		return false
+	}
+
+	if sameFieldsSet(fieldsNames, m.GetPKFieldsNames()) {
+		return true
+	}
+
+	for _, key := range m.uniqueKeys {
+		if sameFieldsSet(fieldsNames, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checksUniqueKeys reports if the unique keys must be checked by the model, because the storage does not check them
+func (m *BaseModel) checksUniqueKeys() bool {
+	if len(m.uniqueKeys) == 0 {
+		return false
+	}
+
+	storage, ok := m.storage.(IUniqueStorage)
+
+	return !ok || !storage.SupportsUniqueKeys()
+}
+
+func (m *BaseModel) uniqueViolation(key []string) error {
+	return UniqueViolationErrorf(key, "Duplicate value of unique key '%s' in model '%s'", strings.Join(key, ", "), m.GetId())
+}
+
+// checkAddUniqueKeys checks the added rows do not have the same unique keys values with each other and with the existing rows.
+// The existing rows which the added ones are merged with by Replace or OnConflict are not the violations.
+func (m *BaseModel) checkAddUniqueKeys(ctx context.Context, data *Data, opts AddOptions) error {
+	target := m.GetPKFieldsNames()
+	if opts.OnConflict != nil && len(opts.OnConflict.Target) > 0 {
+		target = opts.OnConflict.Target
+	}
+	merged := opts.Replace || opts.OnConflict != nil
+
+	for _, key := range m.uniqueKeys {
+		// The missed fields are NULL, such keys are not unique
+		if !hasFields(data, key) {
+			continue
+		}
+
+		rowsKeys := data.GetFieldsData(key).Data()
+		keys := distinctKeys(rowsKeys)
+		if len(keys) == 0 {
+			continue
+		}
+
+		if len(keys) < countNotNil(rowsKeys) {
+			return m.uniqueViolation(key)
+		}
+
+		existing, err := m.storage.Query(ctx, m, append(append([]string{}, key...), target...), GetAllOptions{
+			Filter:    keysFilter(m, key, keys),
+			ForUpdate: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		if existing.Len() == 0 {
+			continue
+		}
+
+		if !merged {
+			return m.uniqueViolation(key)
+		}
+
+		existingTargets := make(map[string]string, existing.Len())
+		existingKeys := existing.GetFieldsData(key).Data()
+		for i, row := range existing.GetFieldsData(target).Data() {
+			existingTargets[linkKey(existingKeys[i])] = linkKey(row)
+		}
+
+		if !hasFields(data, target) {
+			return m.uniqueViolation(key)
+		}
+
+		rowsTargets := data.GetFieldsData(target).Data()
+		for i, row := range rowsKeys {
+			if existingTarget, exists := existingTargets[linkKey(row)]; exists && existingTarget != linkKey(rowsTargets[i]) {
+				return m.uniqueViolation(key)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkEditUniqueKeys checks the changed rows do not get the same unique keys values with each other and with the other rows
+func (m *BaseModel) checkEditUniqueKeys(ctx context.Context, filter IExpression, newValues map[string]interface{}) error {
+	pkFieldsNames := m.GetPKFieldsNames()
+	if len(pkFieldsNames) == 0 {
+		return nil
+	}
+
+	for _, key := range m.uniqueKeys {
+		changed := false
+		for _, fieldName := range key {
+			if _, exists := newValues[fieldName]; exists {
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		matched, err := m.storage.Query(ctx, m, append(append([]string{}, pkFieldsNames...), key...), GetAllOptions{
+			Filter:    filter,
+			ForUpdate: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		newKeys := matched.GetFieldsData(key).Data()
+		for _, row := range newKeys {
+			for i, fieldName := range key {
+				if value, exists := newValues[fieldName]; exists {
+					row[i] = value
+				}
+			}
+		}
+
+		keys := distinctKeys(newKeys)
+		if len(keys) == 0 {
+			continue
+		}
+
+		if len(keys) < countNotNil(newKeys) {
+			return m.uniqueViolation(key)
+		}
+
+		matchedPks := make(map[string]struct{}, matched.Len())
+		for _, row := range matched.GetFieldsData(pkFieldsNames).Data() {
+			matchedPks[linkKey(row)] = struct{}{}
+		}
+
+		others, err := m.storage.Query(ctx, m, pkFieldsNames, GetAllOptions{Filter: keysFilter(m, key, keys), ForUpdate: true})
+		if err != nil {
+			return err
+		}
+
+		for _, row := range others.GetFieldsData(pkFieldsNames).Data() {
+			if _, exists := matchedPks[linkKey(row)]; !exists {
+				return m.uniqueViolation(key)
+			}
+		}
+	}
+
+	return nil
+}
+
+func hasFields(data *Data, fieldsNames []string) bool {
+	for _, fieldName := range fieldsNames {
+		if data.FieldNum(fieldName) == -1 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// countNotNil returns the number of the rows without NULL values
+func countNotNil(rows [][]interface{}) int {
+	n := 0
+rows:
+	for _, row := range rows {
+		for _, value := range row {
+			if isNilValue(value) {
+				continue rows
+			}
+		}
+		n++
+	}
+
+	return n
+}
@@ -0,0 +1,82 @@
+package model
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/go-qbit/qerror"
+	"github.com/go-qbit/rbac"
+)
+
+// checkOnConflict checks the conflict target and the updates of the added rows
+func (m *BaseModel) checkOnConflict(ctx context.Context, opts AddOptions) error {
+	onConflict := opts.OnConflict
+
+	if opts.Replace {
+		return AddErrorf("Replace and OnConflict options cannot be used together")
+	}
+
+	if len(onConflict.Target) > 0 && !m.isKey(onConflict.Target) {
+		return AddErrorf("Invalid conflict target '%s' in model '%s', must be the primary or a unique key",
+			strings.Join(onConflict.Target, ", "), m.GetId())
+	}
+
+	if len(onConflict.Update) > 0 && m.editPermission != nil && !rbac.HasPermission(ctx, m.editPermission) {
+		return EditErrorf("You don't have permission")
+	}
+
+	// The update expressions cannot increment the version
+	if len(onConflict.Update) > 0 && m.versioned {
+		return AddErrorf("The conflicting rows of versioned model '%s' cannot be updated, only skipped", m.GetId())
+	}
+
+	names := make([]string, 0, len(onConflict.Update))
+	for name := range onConflict.Update {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field := m.GetFieldDefinition(name)
+		if field == nil || field.IsDerivable() {
+			return FieldErrorf(name, "Unknown field '%s' in model '%s'", name, m.GetId())
+		}
+
+		if perm := field.GetEditPermission(); perm != nil && !rbac.HasPermission(ctx, perm) {
+			return qerror.Errorf("Need permission '%s' to edit field '%s' in model '%s'",
+				perm.GetGroupId()+"."+perm.GetId(), name, m.GetId())
+		}
+
+		e := onConflict.Update[name]
+		if e == nil {
+			return FieldErrorf(name, "Missed the conflict update of field '%s' in model '%s'", name, m.GetId())
+		}
+
+		if t := e.GetProcessor(&exprValidator{scope: []IModel{m}, excluded: m}).(*exprType); t.err != nil {
+			return t.err
+		}
+	}
+
+	return nil
+}
+
+// sameFieldsSet checks if the slices contain the same fields in any order
+func sameFieldsSet(names1, names2 []string) bool {
+	if len(names1) != len(names2) {
+		return false
+	}
+
+	names := make(map[string]struct{}, len(names1))
+	for _, name := range names1 {
+		names[name] = struct{}{}
+	}
+
+	for _, name := range names2 {
+		if _, exists := names[name]; !exists {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,311 @@
+package model
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// Validate checks the filter against the fields definitions of the model before it reaches the storage.
+// It reports unknown fields, fields of models which are out of the scope of the filter,
+// comparisons of incompatible types and ordering of types which cannot be ordered.
+// The values of the filter are replaced with '?' in the errors.
+func Validate(m IModel, filter IExpression) error {
+	return validateFilter(m, filter, true)
+}
+
+// validate checks the filter like Validate, the values are written to the errors in the context of WithFilterValuesLogging
+func validate(ctx context.Context, m IModel, filter IExpression) error {
+	return validateFilter(m, filter, !isLogFilterValues(ctx))
+}
+
+func validateFilter(m IModel, filter IExpression, redact bool) error {
+	if filter == nil {
+		return nil
+	}
+
+	res := filter.GetProcessor(&exprValidator{scope: []IModel{m}, redact: redact}).(*exprType)
+	if res.err != nil {
+		if filterErr, ok := res.err.(*FilterError); ok {
+			filterErr.Message += " in the filter: " + (&ExprPrinter{RedactValues: redact}).Print(filter)
+		}
+		return res.err
+	}
+
+	if !res.isBool() {
+		return FilterErrorf("The filter of model '%s' must have bool type: %s",
+			m.GetId(), (&ExprPrinter{RedactValues: redact}).Print(filter))
+	}
+
+	return nil
+}
+
+type typeClass int8
+
+const (
+	typeClassUnknown typeClass = iota
+	typeClassNull
+	typeClassNumeric
+	typeClassString
+	typeClassBool
+	typeClassTime
+	typeClassOther
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// exprType is a result of the validation of an expression node
+type exprType struct {
+	t    reflect.Type
+	desc string
+	null bool
+	err  error
+}
+
+func (t *exprType) class() typeClass {
+	if t.null {
+		return typeClassNull
+	}
+
+	if t.t == nil {
+		return typeClassUnknown
+	}
+
+	rt := t.t
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+
+	switch rt.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return typeClassNumeric
+	case reflect.String:
+		return typeClassString
+	case reflect.Bool:
+		return typeClassBool
+	}
+
+	if rt == timeType {
+		return typeClassTime
+	}
+
+	return typeClassOther
+}
+
+func (t *exprType) isBool() bool {
+	c := t.class()
+	return c == typeClassBool || c == typeClassUnknown
+}
+
+func (t *exprType) String() string {
+	switch {
+	case t.null:
+		return t.desc
+	case t.t == nil:
+		return t.desc + " (unknown type)"
+	default:
+		return t.desc + " (" + t.t.String() + ")"
+	}
+}
+
+func boolExprType(desc string) *exprType {
+	return &exprType{t: reflect.TypeOf(true), desc: desc}
+}
+
+type exprValidator struct {
+	scope    []IModel
+	excluded IModel // The model of the added rows in OnConflict updates
+	redact   bool   // Print '?' instead of the values in the errors
+}
+
+func (v *exprValidator) eval(op IExpression) *exprType {
+	return op.GetProcessor(v).(*exprType)
+}
+
+func (v *exprValidator) compare(opName string, op1, op2 IExpression, needOrder bool) interface{} {
+	t1 := v.eval(op1)
+	if t1.err != nil {
+		return t1
+	}
+
+	t2 := v.eval(op2)
+	if t2.err != nil {
+		return t2
+	}
+
+	desc := t1.desc + " " + opName + " " + t2.desc
+
+	c1, c2 := t1.class(), t2.class()
+	if needOrder {
+		for _, t := range []*exprType{t1, t2} {
+			switch t.class() {
+			case typeClassUnknown, typeClassNumeric, typeClassString, typeClassTime:
+			default:
+				return &exprType{err: FilterErrorf("%s cannot be ordered in '%s'", t, desc)}
+			}
+		}
+	}
+
+	if c1 == typeClassUnknown || c2 == typeClassUnknown || c1 == typeClassNull || c2 == typeClassNull {
+		return boolExprType(desc)
+	}
+
+	// The times can be given as strings, the storages parse them like mapToVar does
+	if c1 == typeClassTime && c2 == typeClassString || c1 == typeClassString && c2 == typeClassTime {
+		return boolExprType(desc)
+	}
+
+	if c1 != c2 || c1 == typeClassOther && derefType(t1.t) != derefType(t2.t) {
+		return &exprType{err: FilterErrorf("%s and %s cannot be compared in '%s'", t1, t2, desc)}
+	}
+
+	return boolExprType(desc)
+}
+
+func (v *exprValidator) Eq(op1, op2 IExpression) interface{} { return v.compare("=", op1, op2, false) }
+func (v *exprValidator) Ne(op1, op2 IExpression) interface{} { return v.compare("!=", op1, op2, false) }
+func (v *exprValidator) Lt(op1, op2 IExpression) interface{} { return v.compare("<", op1, op2, true) }
+func (v *exprValidator) Le(op1, op2 IExpression) interface{} { return v.compare("<=", op1, op2, true) }
+func (v *exprValidator) Gt(op1, op2 IExpression) interface{} { return v.compare(">", op1, op2, true) }
+func (v *exprValidator) Ge(op1, op2 IExpression) interface{} { return v.compare(">=", op1, op2, true) }
+
+func (v *exprValidator) In(op IExpression, arr []IExpression) interface{} {
+	var res interface{}
+
+	for _, value := range arr {
+		res = v.compare("IN", op, value, false)
+		if res.(*exprType).err != nil {
+			return res
+		}
+	}
+
+	if res == nil {
+		t := v.eval(op)
+		if t.err != nil {
+			return t
+		}
+		return boolExprType(t.desc + " IN ()")
+	}
+
+	return res
+}
+
+func (v *exprValidator) logical(opName string, operands []IExpression) interface{} {
+	for _, op := range operands {
+		t := v.eval(op)
+		if t.err != nil {
+			return t
+		}
+
+		if !t.isBool() {
+			return &exprType{err: FilterErrorf("The operand %s of %s must have bool type", t, opName)}
+		}
+	}
+
+	return boolExprType(opName)
+}
+
+func (v *exprValidator) And(operands []IExpression) interface{} { return v.logical("AND", operands) }
+func (v *exprValidator) Or(operands []IExpression) interface{}  { return v.logical("OR", operands) }
+
+func (v *exprValidator) Any(localModel IModel, relationName string, filter IExpression) interface{} {
+	if !v.inScope(localModel) {
+		return &exprType{err: FilterErrorf("The model '%s' is out of the filter scope", localModel.GetId())}
+	}
+
+	relation := localModel.GetRelation(relationName)
+	if relation == nil {
+		return &exprType{err: FilterErrorf("There is no relation '%s' in model '%s'", relationName, localModel.GetId())}
+	}
+	extModel := relation.ExtModel
+
+	if filter == nil {
+		return boolExprType("ANY " + relationName)
+	}
+
+	scope := make([]IModel, len(v.scope), len(v.scope)+1)
+	copy(scope, v.scope)
+
+	t := filter.GetProcessor(&exprValidator{scope: append(scope, extModel), redact: v.redact}).(*exprType)
+	if t.err != nil {
+		return t
+	}
+
+	if !t.isBool() {
+		return &exprType{err: FilterErrorf("The filter of ANY %s must have bool type, not %s", relationName, t)}
+	}
+
+	return boolExprType("ANY " + relationName)
+}
+
+func (v *exprValidator) ModelField(m IModel, fieldName string) interface{} {
+	desc := m.GetId() + "." + fieldName
+
+	if !v.inScope(m) {
+		return &exprType{err: FilterErrorf("The field %s is out of the filter scope", desc)}
+	}
+
+	field := m.GetFieldDefinition(fieldName)
+	if field == nil {
+		return &exprType{err: FieldErrorf(fieldName, "Unknown field '%s' in model '%s'", fieldName, m.GetId())}
+	}
+
+	if field.IsDerivable() {
+		return &exprType{err: FieldErrorf(fieldName, "The field '%s' is derivable in model '%s', it cannot be used in filter", fieldName, m.GetId())}
+	}
+
+	return &exprType{t: field.GetType(), desc: desc}
+}
+
+func (v *exprValidator) Value(value interface{}) interface{} {
+	if value == nil {
+		return &exprType{desc: "NULL", null: true}
+	}
+
+	return &exprType{t: reflect.TypeOf(value), desc: formatExprValue(value, v.redact)}
+}
+
+func (v *exprValidator) Func(name string, params ...IExpression) interface{} {
+	for _, param := range params {
+		if t := v.eval(param); t.err != nil {
+			return t
+		}
+	}
+
+	return &exprType{desc: name + "()"}
+}
+
+func (v *exprValidator) Excluded(fieldName string) interface{} {
+	desc := "excluded." + fieldName
+
+	if v.excluded == nil {
+		return &exprType{err: FilterErrorf("The field %s can be used in the conflict updates only", desc)}
+	}
+
+	field := v.excluded.GetFieldDefinition(fieldName)
+	if field == nil || field.IsDerivable() {
+		return &exprType{err: FieldErrorf(fieldName, "Unknown field '%s' in model '%s'", fieldName, v.excluded.GetId())}
+	}
+
+	return &exprType{t: field.GetType(), desc: desc}
+}
+
+func (v *exprValidator) inScope(m IModel) bool {
+	for _, scopeModel := range v.scope {
+		if scopeModel.GetId() == m.GetId() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t
+}
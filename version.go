@@ -0,0 +1,155 @@
+package model
+
+import (
+	"context"
+
+	"github.com/go-qbit/timelog"
+)
+
+// VERSION_FIELD is the field added to the models with the Versioned option, it is 1 for the new rows
+const VERSION_FIELD = "version"
+
+// EditWithVersion changes the rows matched the filter if they have the expected version and increments the version.
+// ConflictError is returned if there are no such rows, e.g. the row was changed by another request after it was read.
+// The other edits increment the version too but do not check it.
+func (m *BaseModel) EditWithVersion(ctx context.Context, filter IExpression, version int, newValues map[string]interface{}) error {
+	logMessage := newFilterLogMessage(ctx, m.GetId()+": EditWithVersion")
+	ctx = timelog.Start(ctx, logMessage)
+	defer timelog.Finish(ctx)
+
+	if !m.versioned {
+		return EditErrorf("Model '%s' is not versioned", m.GetId())
+	}
+
+	count, _, err := m.edit(ctx, logMessage, andFilter(exprEq(m.FieldExpr(VERSION_FIELD), exprValue(version)), filter), newValues, nil)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ConflictErrorf("There are no rows of model '%s' with version %d, they were changed or deleted", m.GetId(), version)
+	}
+
+	return nil
+}
+
+func withInitialVersion(data *Data) *Data {
+	rows := make([][]interface{}, data.Len())
+	for i, row := range data.Data() {
+		rows[i] = append(append(make([]interface{}, 0, len(row)+1), row...), 1)
+	}
+
+	return NewData(append(append([]string{}, data.Fields()...), VERSION_FIELD), rows)
+}
+
+// versionFieldError is returned on writing the version field, it is changed automatically
+func (m *BaseModel) versionFieldError() error {
+	return FieldErrorf(VERSION_FIELD, "The field '%s' of model '%s' is changed automatically", VERSION_FIELD, m.GetId())
+}
+
+// storageEditVersioned changes the rows in the storage and increments the versions of the versioned models.
+// The rows are changed by the groups of the same version from the newest one, so every version is incremented once.
+func (m *BaseModel) storageEditVersioned(ctx context.Context, filter IExpression, newValues map[string]interface{}, returning []string) (uint64, *Data, error) {
+	if !m.versioned {
+		return m.storageEdit(ctx, filter, newValues, returning)
+	}
+
+	var (
+		count uint64
+		data  *Data
+	)
+	err := m.inTransaction(ctx, func(ctx context.Context) error {
+		versions, err := m.storage.Query(ctx, m, []string{VERSION_FIELD}, GetAllOptions{
+			Distinct:  true,
+			Filter:    filter,
+			OrderBy:   []Order{{FieldName: VERSION_FIELD, Desc: true}},
+			ForUpdate: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(returning) > 0 {
+			data = NewEmptyData(returning)
+		}
+
+		for _, row := range versions.Data() {
+			values := make(map[string]interface{}, len(newValues)+1)
+			for name, value := range newValues {
+				values[name] = value
+			}
+			if values[VERSION_FIELD], err = nextVersion(row[0]); err != nil {
+				return err
+			}
+
+			versionFilter := andFilter(exprEq(m.FieldExpr(VERSION_FIELD), exprValue(row[0])), filter)
+			versionCount, versionData, err := m.storageEdit(ctx, versionFilter, values, returning)
+			if err != nil {
+				return err
+			}
+
+			count += versionCount
+			if versionData != nil {
+				for _, row := range versionData.GetFieldsData(returning).Data() {
+					if err := data.Add(row); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return count, data, nil
+}
+
+// withNextVersions returns the data of EditMulti with the incremented versions of the rows
+func (m *BaseModel) withNextVersions(ctx context.Context, data *Data, filter IExpression) (*Data, error) {
+	keys := data.GetFieldsData(m.pkFieldsNames).Data()
+
+	versions, err := m.storage.Query(ctx, m, append(append([]string{}, m.pkFieldsNames...), VERSION_FIELD), GetAllOptions{
+		Filter:    andFilter(keysFilter(m, m.pkFieldsNames, distinctKeys(keys)), filter),
+		ForUpdate: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	versionsByKey := make(map[string]interface{}, versions.Len())
+	for _, row := range versions.GetFieldsData(append(append([]string{}, m.pkFieldsNames...), VERSION_FIELD)).Data() {
+		versionsByKey[linkKey(row[:len(m.pkFieldsNames)])] = row[len(m.pkFieldsNames)]
+	}
+
+	rows := make([][]interface{}, data.Len())
+	for i, row := range data.Data() {
+		version, exists := versionsByKey[linkKey(keys[i])]
+		if exists {
+			if version, err = nextVersion(version); err != nil {
+				return nil, err
+			}
+		}
+
+		// The missed rows are not changed, so their version does not matter
+		rows[i] = append(append(make([]interface{}, 0, len(row)+1), row...), version)
+	}
+
+	return NewData(append(append([]string{}, data.Fields()...), VERSION_FIELD), rows), nil
+}
+
+// nextVersion returns the incremented version, the rows added before the model became versioned get the initial one
+func nextVersion(version interface{}) (int, error) {
+	if isNilValue(version) {
+		return 1, nil
+	}
+
+	n, err := toUint64(version)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n) + 1, nil
+}